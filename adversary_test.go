@@ -0,0 +1,578 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// This file implements a framework for testing the soundness of the
+// interactive proofs against a malicious prover. The adversary sits between
+// the honest prover and the verifier, like a Recorder, and replaces each of
+// the prover's messages with the output of a tamperer. New proofs are covered
+// by adding them to adversarialProofs. Non-interactive proofs are covered by
+// adding them to adversarialNIProofs, whose test replaces each value of the
+// proof in turn.
+
+// A tamperer outputs the message to send in place of the k-th message of the
+// honest prover, honest, given the messages exchanged before it. Returning nil
+// closes the channel. The tamperer may modify honest, which is a copy.
+type tamperer func(k int, honest []big.Int, history []Message) []big.Int
+
+// cloneMsg returns a deep copy of msg, preserving nil.
+func cloneMsg(msg []big.Int) []big.Int {
+	if msg == nil {
+		return nil
+	}
+	out := make([]big.Int, len(msg))
+	for i := range msg {
+		out[i].Set(&msg[i])
+	}
+	return out
+}
+
+// runAdversary runs prove and verify with the adversary in the middle and
+// returns the verifier's decision and the messages the verifier saw. If
+// either party stops early, the adversary unblocks the other by closing the
+// channel, so that neither goroutine leaks.
+func runAdversary(prove func(msg chan []big.Int) error, verify func(msg chan []big.Int) (bool, error), tamper tamperer) (bool, []Message) {
+	proverMsg, verifierMsg := make(chan []big.Int), make(chan []big.Int)
+	proverDone, result := make(chan bool), make(chan bool, 1)
+	go func() {
+		prove(proverMsg)
+		close(proverDone)
+	}()
+	go func() {
+		ok, _ := verify(verifierMsg)
+		result <- ok
+	}()
+
+	// finish waits for the prover to stop, closing the channel if it is
+	// waiting for the verifier.
+	var history []Message
+	finish := func(ok bool) (bool, []Message) {
+		for {
+			select {
+			case <-proverMsg:
+			case proverMsg <- nil:
+			case <-proverDone:
+				return ok, history
+			}
+		}
+	}
+
+	for k := 0; ; {
+		select {
+		case msg := <-proverMsg:
+			msg = tamper(k, cloneMsg(msg), history)
+			k++
+			history = append(history, Message{From: FromProver, Values: copyInts(msg)})
+			select {
+			case verifierMsg <- msg:
+			case ok := <-result:
+				return finish(ok)
+			}
+		case msg := <-verifierMsg:
+			history = append(history, Message{From: FromVerifier, Values: copyInts(msg)})
+			select {
+			case proverMsg <- msg:
+			case <-proverDone:
+				select {
+				case verifierMsg <- nil:
+				case ok := <-result:
+					return finish(ok)
+				}
+			}
+		case ok := <-result:
+			return finish(ok)
+		}
+	}
+}
+
+// proverMessages returns the prover's messages in history.
+func proverMessages(history []Message) [][]big.Int {
+	var out [][]big.Int
+	for _, m := range history {
+		if m.From == FromProver {
+			vals, _ := fromInts(m.Values)
+			out = append(out, vals)
+		}
+	}
+	return out
+}
+
+// honestTamperer forwards every message unchanged.
+func honestTamperer(k int, honest []big.Int, history []Message) []big.Int {
+	return honest
+}
+
+// tamperAt returns a tamperer that applies f to the m-th message of the
+// prover and forwards the others unchanged.
+func tamperAt(m int, f func(msg []big.Int) []big.Int) tamperer {
+	return func(k int, honest []big.Int, history []Message) []big.Int {
+		if k != m {
+			return honest
+		}
+		return f(honest)
+	}
+}
+
+// messageTampers are the modifications of a single prover message.
+func messageTampers(params *KeyParameters) []struct {
+	name string
+	f    func(msg []big.Int) []big.Int
+} {
+	// set sets the first element from the i-th on that is not X to X, so
+	// that the message always changes.
+	set := func(i int, X *big.Int) func(msg []big.Int) []big.Int {
+		return func(msg []big.Int) []big.Int {
+			for j := range msg {
+				if V := &msg[(i+j)%len(msg)]; V.Cmp(X) != 0 {
+					V.Set(X)
+					return msg
+				}
+			}
+			return append(msg, *X)
+		}
+	}
+	return []struct {
+		name string
+		f    func(msg []big.Int) []big.Int
+	}{
+		{"nil", func(msg []big.Int) []big.Int { return nil }},
+		{"empty", func(msg []big.Int) []big.Int { return []big.Int{} }},
+		{"truncated", func(msg []big.Int) []big.Int { return msg[:len(msg)-1] }},
+		{"extended", func(msg []big.Int) []big.Int { return append(msg, *new(big.Int).Set(&msg[0])) }},
+		{"zero", set(0, new(big.Int))},
+		{"one", set(1, big.NewInt(1))},
+		{"order two", set(0, new(big.Int).Sub(params.P, params.one))},
+		{"P", set(0, params.P)},
+		{"Q", set(1, params.Q)},
+		{"negative", func(msg []big.Int) []big.Int {
+			for i := range msg {
+				if msg[i].Sign() != 0 {
+					msg[i].Neg(&msg[i])
+					return msg
+				}
+			}
+			msg[0].SetInt64(-1)
+			return msg
+		}},
+		{"plus Q", func(msg []big.Int) []big.Int {
+			msg[len(msg)-1].Add(&msg[len(msg)-1], params.Q)
+			return msg
+		}},
+		{"swapped elements", func(msg []big.Int) []big.Int {
+			for i := 1; i < len(msg); i++ {
+				if msg[i].Cmp(&msg[0]) != 0 {
+					msg[0], msg[i] = msg[i], msg[0]
+					return msg
+				}
+			}
+			return msg[:len(msg)-1]
+		}},
+	}
+}
+
+// sessionTampers are the attacks that replay the prover's messages prev from
+// an earlier session of the same proof, or echo earlier messages of this one.
+func sessionTampers(prev [][]big.Int) []struct {
+	name   string
+	target bool
+	f      func(m int) tamperer
+} {
+	return []struct {
+		name   string
+		target bool
+		f      func(m int) tamperer
+	}{
+		{"replayed message", true, func(m int) tamperer {
+			return tamperAt(m, func([]big.Int) []big.Int { return cloneMsg(prev[m]) })
+		}},
+		{"replayed session", false, func(int) tamperer {
+			return func(k int, honest []big.Int, history []Message) []big.Int { return cloneMsg(prev[k]) }
+		}},
+		{"swapped messages", false, func(int) tamperer {
+			return func(k int, honest []big.Int, history []Message) []big.Int {
+				return cloneMsg(prev[len(prev)-1-k])
+			}
+		}},
+		{"echoed message", true, func(m int) tamperer {
+			return func(k int, honest []big.Int, history []Message) []big.Int {
+				if k != m {
+					return honest
+				}
+				if len(history) == 0 {
+					return []big.Int{}
+				}
+				vals, _ := fromInts(history[len(history)-1].Values)
+				return vals
+			}
+		}},
+	}
+}
+
+// adversarialProof is an interactive proof of a true statement for the
+// adversarial tests. It has the honest prover, the verifier, the number of
+// messages the prover sends, and a constructor for a tamperer that ignores
+// the honest prover and guesses the verifier's challenges, so that it would
+// be accepted if the guess were right.
+type adversarialProof struct {
+	name     string
+	messages int
+	prove    func(msg chan []big.Int) error
+	verify   func(msg chan []big.Int) (bool, error)
+	predict  func(t *testing.T) tamperer
+}
+
+// adversarialProofs returns the proofs covered by the adversarial tests.
+func adversarialProofs(t *testing.T, params *KeyParameters) []adversarialProof {
+	// ILMP
+	x, y, X, Y := benchILMPInstance(t, params, 4)
+	guess := big.NewInt(1)
+	ilmp := adversarialProof{
+		name:     "ILMP",
+		messages: 2,
+		prove:    func(msg chan []big.Int) error { return params.ILMPProve(x, y, msg) },
+		verify:   func(msg chan []big.Int) (bool, error) { return params.ILMPVerify(X, Y, msg) },
+		predict: func(t *testing.T) tamperer {
+			A, r, err := params.ILMPSimulate(X, Y, guess)
+			if err != nil {
+				t.Fatal("ILMPSimulate() fails:", err)
+			}
+			return func(k int, honest []big.Int, history []Message) []big.Int {
+				return [][]big.Int{A, r}[k]
+			}
+		},
+	}
+
+	// Shuffle0
+	x0, y0, c0, d0, X0, Y0, C0, D0 := testShuffle0Instance(t, params, 3)
+	shuffle0 := adversarialProof{
+		name:     "Shuffle0",
+		messages: 2,
+		prove:    func(msg chan []big.Int) error { return params.Shuffle0Prove(x0, y0, c0, d0, msg) },
+		verify:   func(msg chan []big.Int) (bool, error) { return params.Shuffle0Verify(X0, Y0, C0, D0, msg) },
+		predict: func(t *testing.T) tamperer {
+			var r []big.Int
+			return func(k int, honest []big.Int, history []Message) []big.Int {
+				if k == 1 {
+					return r
+				}
+				A, r0, err := params.Shuffle0Simulate(X0, Y0, C0, D0, history[0].Values[0], guess)
+				if err != nil {
+					t.Error("Shuffle0Simulate() fails:", err)
+					return nil
+				}
+				r = r0
+				return A
+			}
+		},
+	}
+
+	// Sako-Kilian, with enough rounds that guessing every challenge bit
+	// succeeds with negligible probability.
+	pk, _ := params.GenerateKeys()
+	N, rounds := 2, 40
+	R := make([]*big.Int, N)
+	C := make([]*big.Int, N)
+	for i := range R {
+		R[i], C[i], _ = pk.EncryptExp(big.NewInt(int64(i + 2)))
+	}
+	perm := testPerm(t, N)
+	R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMix() fails:", err)
+	}
+	sakoKilian := adversarialProof{
+		name:     "ReEncryptionShuffle",
+		messages: 2,
+		prove: func(msg chan []big.Int) error {
+			return pk.ReEncryptionShuffleProve(R, C, R2, C2, perm, rands, rounds, msg)
+		},
+		verify: func(msg chan []big.Int) (bool, error) {
+			return pk.ReEncryptionShuffleVerify(R, C, R2, C2, rounds, msg)
+		},
+		// Guess that every challenge bit is 0, so that each round only
+		// needs a shuffle of the inputs.
+		predict: func(t *testing.T) tamperer {
+			E := make([]big.Int, 0, 2*N*rounds)
+			open := make([]big.Int, 0, 2*N*rounds)
+			for j := 0; j < rounds; j++ {
+				phi := testPerm(t, N)
+				ER, EC, u, err := pk.ReEncryptionMix(R, C, phi)
+				if err != nil {
+					t.Fatal("ReEncryptionMix() fails:", err)
+				}
+				for _, V := range append(ER, EC...) {
+					E = append(E, *V)
+				}
+				for _, h := range phi {
+					open = append(open, *big.NewInt(int64(h)))
+				}
+				for _, v := range u {
+					open = append(open, *v)
+				}
+			}
+			return func(k int, honest []big.Int, history []Message) []big.Int {
+				return cloneMsg([][]big.Int{E, open}[k])
+			}
+		},
+	}
+
+	return []adversarialProof{ilmp, shuffle0, sakoKilian}
+}
+
+// Test that the verifier of each proof accepts the honest prover through the
+// adversary, and rejects every tampered, replayed, or predicted transcript.
+func TestAdversarialProver(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	for _, p := range adversarialProofs(t, params) {
+		ok, history := runAdversary(p.prove, p.verify, honestTamperer)
+		if !ok {
+			t.Fatalf("%s: honest prover is rejected", p.name)
+		}
+		prev := proverMessages(history)
+		if len(prev) != p.messages {
+			t.Fatalf("%s: honest prover sends %d messages, expected %d", p.name, len(prev), p.messages)
+		}
+
+		reject := func(name string, tamper tamperer) {
+			if ok, history := runAdversary(p.prove, p.verify, tamper); ok {
+				t.Errorf("%s: %s: verifier accepts %d messages", p.name, name, len(history))
+			}
+		}
+		for m := 0; m < p.messages; m++ {
+			for _, tm := range messageTampers(params) {
+				reject(fmt.Sprintf("%s message %d", tm.name, m), tamperAt(m, tm.f))
+			}
+		}
+		for _, ts := range sessionTampers(prev) {
+			if !ts.target {
+				reject(ts.name, ts.f(0))
+				continue
+			}
+			for m := 0; m < p.messages; m++ {
+				reject(fmt.Sprintf("%s %d", ts.name, m), ts.f(m))
+			}
+		}
+		reject("predicted challenges", p.predict(t))
+	}
+}
+
+// An adversarialNIProof is a non-interactive proof of a true statement for the
+// adversarial tests. proof points to the honest proof and other to a valid
+// proof of another statement of the same size; verify checks a proof of the
+// type of proof against the statement for the given context.
+type adversarialNIProof struct {
+	name         string
+	proof, other interface{}
+	verify       func(proof interface{}, context []byte) bool
+}
+
+// adversarialNIProofs returns the non-interactive proofs covered by the
+// adversarial tests.
+func adversarialNIProofs(t *testing.T, params *KeyParameters, context []byte) []adversarialNIProof {
+	// Bayer-Groth, with more than one row so that the Hadamard argument is
+	// used.
+	N := 4
+	pk, R, C, R2, C2, perm, rands := testBayerGrothInstance(t, params, N)
+	bg, err := pk.BayerGrothProve(R, C, R2, C2, perm, rands, context)
+	if err != nil {
+		t.Fatal("BayerGrothProve() fails:", err)
+	}
+	pk1, R1, C1, R12, C12, perm1, rands1 := testBayerGrothInstance(t, params, N)
+	bg1, err := pk1.BayerGrothProve(R1, C1, R12, C12, perm1, rands1, context)
+	if err != nil {
+		t.Fatal("BayerGrothProve() fails:", err)
+	}
+
+	// Terelius-Wikstrom, for the same shuffle.
+	U, r, err := params.CommitPermutation(perm)
+	if err != nil {
+		t.Fatal("CommitPermutation() fails:", err)
+	}
+	tw, err := pk.TereliusWikstromProve(U, perm, r, R, C, R2, C2, rands, context)
+	if err != nil {
+		t.Fatal("TereliusWikstromProve() fails:", err)
+	}
+	U1, r1, err := params.CommitPermutation(perm1)
+	if err != nil {
+		t.Fatal("CommitPermutation() fails:", err)
+	}
+	tw1, err := pk1.TereliusWikstromProve(U1, perm1, r1, R1, C1, R12, C12, rands1, context)
+	if err != nil {
+		t.Fatal("TereliusWikstromProve() fails:", err)
+	}
+
+	// Schnorr and Chaum-Pedersen.
+	x, x1, h := testSample(t, params), testSample(t, params), testSample(t, params)
+	Y := new(big.Int).Exp(params.G, x, params.P)
+	H := new(big.Int).Exp(params.G, h, params.P)
+	Z := new(big.Int).Exp(H, x, params.P)
+	schnorr, err := params.SchnorrProveNI(x, context)
+	if err != nil {
+		t.Fatal("SchnorrProveNI() fails:", err)
+	}
+	schnorr1, err := params.SchnorrProveNI(x1, context)
+	if err != nil {
+		t.Fatal("SchnorrProveNI() fails:", err)
+	}
+	cp, err := params.ChaumPedersenProve(x, H, context)
+	if err != nil {
+		t.Fatal("ChaumPedersenProve() fails:", err)
+	}
+	cp1, err := params.ChaumPedersenProve(x1, H, context)
+	if err != nil {
+		t.Fatal("ChaumPedersenProve() fails:", err)
+	}
+
+	return []adversarialNIProof{
+		{"BayerGroth", bg, bg1, func(proof interface{}, context []byte) bool {
+			return pk.BayerGrothVerify(R, C, R2, C2, proof.(*BayerGrothProof), context)
+		}},
+		{"TereliusWikstrom", tw, tw1, func(proof interface{}, context []byte) bool {
+			return pk.TereliusWikstromVerify(U, R, C, R2, C2, proof.(*TereliusWikstromProof), context)
+		}},
+		{"SchnorrNI", schnorr, schnorr1, func(proof interface{}, context []byte) bool {
+			return params.SchnorrVerifyNI(Y, proof.(*SchnorrProof), context)
+		}},
+		{"ChaumPedersen", cp, cp1, func(proof interface{}, context []byte) bool {
+			return params.ChaumPedersenVerify(Y, H, Z, proof.(*ChaumPedersenProof), context)
+		}},
+	}
+}
+
+// proofFields calls visit with the name and the settable value of each
+// *big.Int, []*big.Int, and pointer to a sub-argument reachable from the
+// struct that v points to, and of the first and last entries of the slices.
+func proofFields(name string, v reflect.Value, visit func(name string, f reflect.Value)) {
+	v = v.Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f, fname := v.Field(i), name+"."+v.Type().Field(i).Name
+		visit(fname, f)
+		switch {
+		case f.Type() == reflect.TypeOf([]*big.Int{}):
+			for j := 0; j < f.Len(); j++ {
+				if j == 0 || j == f.Len()-1 {
+					visit(fmt.Sprintf("%s[%d]", fname, j), f.Index(j))
+				}
+			}
+		case f.Kind() == reflect.Ptr && f.Type().Elem().Kind() == reflect.Struct &&
+			f.Type() != reflect.TypeOf(new(big.Int)) && !f.IsNil():
+			proofFields(fname, f, visit)
+		}
+	}
+}
+
+// Test that the verifier of each non-interactive proof accepts the honest
+// proof, and rejects the proof with any one of its values or slices replaced,
+// a missing proof, and a proof for another context or statement.
+func TestAdversarialNIProver(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	context := []byte("test")
+	values := func(V *big.Int) []struct {
+		name string
+		V    *big.Int
+	} {
+		return []struct {
+			name string
+			V    *big.Int
+		}{
+			{"nil", nil},
+			{"zero", new(big.Int)},
+			{"one", big.NewInt(1)},
+			{"order two", new(big.Int).Sub(params.P, params.one)},
+			{"Q", params.Q},
+			{"negative", new(big.Int).Neg(V)},
+			{"plus one", new(big.Int).Add(V, params.one)},
+			{"plus Q", new(big.Int).Add(V, params.Q)},
+		}
+	}
+
+	for _, p := range adversarialNIProofs(t, params, context) {
+		if !p.verify(p.proof, context) {
+			t.Fatalf("%s: honest proof is rejected", p.name)
+		}
+		reject := func(name string) {
+			if p.verify(p.proof, context) {
+				t.Errorf("%s: verifier accepts %s", p.name, name)
+			}
+		}
+
+		// Replace each value and slice in turn, restoring it afterwards.
+		proofFields(p.name, reflect.ValueOf(p.proof), func(name string, f reflect.Value) {
+			old := reflect.ValueOf(f.Interface())
+			defer f.Set(old)
+			switch V := f.Interface().(type) {
+			case *big.Int:
+				for _, tv := range values(V) {
+					if tv.V != nil && V != nil && tv.V.Cmp(V) == 0 {
+						continue
+					}
+					f.Set(reflect.ValueOf(tv.V))
+					reject(fmt.Sprintf("%s %s", tv.name, name))
+				}
+			case []*big.Int:
+				f.Set(reflect.ValueOf(append(append([]*big.Int{}, V...), params.G)))
+				reject("extended " + name)
+				if len(V) == 0 {
+					return
+				}
+				f.Set(reflect.ValueOf([]*big.Int(nil)))
+				reject("nil " + name)
+				f.Set(reflect.ValueOf(V[:len(V)-1]))
+				reject("truncated " + name)
+				if len(V) > 1 {
+					f.Set(reflect.ValueOf(append([]*big.Int{V[len(V)-1]}, V[:len(V)-1]...)))
+					reject("rotated " + name)
+				}
+			default:
+				f.Set(reflect.Zero(f.Type()))
+				reject("nil " + name)
+			}
+		})
+		if !p.verify(p.proof, context) {
+			t.Fatalf("%s: honest proof is rejected after restoring it", p.name)
+		}
+
+		if p.verify(reflect.Zero(reflect.TypeOf(p.proof)).Interface(), context) {
+			t.Errorf("%s: verifier accepts a nil proof", p.name)
+		}
+		if p.verify(p.proof, []byte("other")) {
+			t.Errorf("%s: verifier accepts a proof for another context", p.name)
+		}
+		if p.verify(p.other, context) {
+			t.Errorf("%s: verifier accepts a proof of another statement", p.name)
+		}
+	}
+}
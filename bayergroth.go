@@ -0,0 +1,916 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"math/big"
+)
+
+// This file implements the shuffle argument of Bayer and Groth (EUROCRYPT
+// 2012), made non-interactive with the Fiat-Shamir transform. Like
+// ReEncryptionShuffleProve, it proves that a sequence of ciphertexts is a
+// re-encryption shuffle of another, but its size grows with sqrt(N) rather
+// than N times the number of rounds.
+//
+// The N ciphertexts are arranged in a matrix with m = floor(sqrt(N)) rows of
+// n = ceil(N/m) columns, and vectors of length n are committed with Pedersen
+// vector commitments. If N < mn, both sequences are padded to mn ciphertexts
+// with the trivial encryption (1, 1) of 1, which the permutation leaves in
+// place. The prover commits to the permutation as a = (pi(1), ..., pi(N)) and,
+// given a challenge x, to b = (x^pi(1), ..., x^pi(N)). A product argument then
+// shows that prod (y a_i + b_i - z) = prod (y i + x^i - z) for random y and z,
+// which implies that a is a permutation and b its image under x^i. Finally, a
+// multi-exponentiation argument shows that prod C_i^{x^i} is a re-encryption of
+// prod C'_i^{b_i}. The sub-arguments are those of the paper, without the
+// optimizations of its section 5.
+//
+// The arguments compute with exponents mod Q, so every component of every
+// ciphertext must be an element of <G>. This holds for exponential encryptions
+// (see EncryptExp), but not in general for encryptions of Encode's output.
+
+// powers outputs x^0, ..., x^(n-1).
+func (params *KeyParameters) powers(x *big.Int, n int) []*big.Int {
+	xs := make([]*big.Int, n)
+	for i := range xs {
+		if i == 0 {
+			xs[i] = new(big.Int).Set(params.one)
+		} else {
+			xs[i] = new(big.Int).Mul(xs[i-1], x)
+			xs[i].Mod(xs[i], params.Q)
+		}
+	}
+	return xs
+}
+
+// sampleVec outputs n random elements of Z/q.
+func (params *KeyParameters) sampleVec(n int) ([]*big.Int, error) {
+	v := make([]*big.Int, n)
+	for i := range v {
+		var err error
+		if v[i], err = params.Sample(); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// combine outputs sum_i e[i] v[i] mod Q.
+func (params *KeyParameters) combine(v, e []*big.Int) *big.Int {
+	z := new(big.Int)
+	var t big.Int
+	for i := range v {
+		z.Add(z, t.Mul(e[i], v[i]))
+	}
+	return z.Mod(z, params.Q)
+}
+
+// combineVecs outputs sum_i e[i] v[i] mod Q for vectors v[i].
+func (params *KeyParameters) combineVecs(v [][]*big.Int, e []*big.Int) []*big.Int {
+	z := make([]*big.Int, len(v[0]))
+	col := make([]*big.Int, len(v))
+	for l := range z {
+		for i := range v {
+			col[i] = v[i][l]
+		}
+		z[l] = params.combine(col, e)
+	}
+	return z
+}
+
+// bilinear outputs sum_j a[j] b[j] y^(j+1) mod Q, the bilinear map used by
+// the zero argument.
+func (params *KeyParameters) bilinear(a, b []*big.Int, y *big.Int) *big.Int {
+	z := new(big.Int)
+	yj := new(big.Int).Set(y)
+	var t big.Int
+	for j := range a {
+		t.Mul(a[j], b[j])
+		t.Mul(&t, yj)
+		z.Add(z, &t)
+		yj.Mul(yj, y)
+		yj.Mod(yj, params.Q)
+	}
+	return z.Mod(z, params.Q)
+}
+
+// expProd outputs prod_i X[i]^e[i] mod P.
+func (params *KeyParameters) expProd(X, e []*big.Int) *big.Int {
+	Z := new(big.Int).Set(params.one)
+	var t big.Int
+	for i := range X {
+		t.Exp(X[i], e[i], params.P)
+		Z.Mul(Z, &t)
+		Z.Mod(Z, params.P)
+	}
+	return Z
+}
+
+// mulCt multiplies the ciphertext (R, C) by (R2, C2) in place.
+func (params *KeyParameters) mulCt(R, C, R2, C2 *big.Int) {
+	R.Mul(R, R2)
+	R.Mod(R, params.P)
+	C.Mul(C, C2)
+	C.Mod(C, params.P)
+}
+
+// encryptWith outputs (G^tau, M Y^tau).
+func (pk *PublicKey) encryptWith(M, tau *big.Int) (R, C *big.Int) {
+	R = new(big.Int).Exp(pk.G, tau, pk.P)
+	C = new(big.Int).Exp(pk.Y, tau, pk.P)
+	C.Mul(C, M)
+	C.Mod(C, pk.P)
+	return
+}
+
+// areElements reports whether each of X is an element of <G>.
+func (params *KeyParameters) areElements(X ...*big.Int) bool {
+	for _, Z := range X {
+		if Z == nil || !params.IsElement(Z) {
+			return false
+		}
+	}
+	return true
+}
+
+// areScalars reports whether each of v is an element of Z/q.
+func (params *KeyParameters) areScalars(v ...*big.Int) bool {
+	for _, z := range v {
+		if z == nil || z.Sign() < 0 || z.Cmp(params.Q) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// split arranges v as a matrix with m rows.
+func split(v []*big.Int, m int) [][]*big.Int {
+	n := len(v) / m
+	rows := make([][]*big.Int, m)
+	for k := range rows {
+		rows[k] = v[k*n : (k+1)*n]
+	}
+	return rows
+}
+
+// bayerGrothDims chooses the dimensions of the matrix for N >= 2 ciphertexts:
+// m = floor(sqrt(N)) and n = ceil(N/m) >= 2, so that mn - N < m.
+func bayerGrothDims(N int) (m, n int) {
+	m = 1
+	for (m+1)*(m+1) <= N {
+		m++
+	}
+	return m, (N + m - 1) / m
+}
+
+// padCiphertexts appends copies of the trivial encryption (1, 1) to R and C
+// up to length L.
+func (params *KeyParameters) padCiphertexts(R, C []*big.Int, L int) (Rp, Cp []*big.Int) {
+	Rp = append(make([]*big.Int, 0, L), R...)
+	Cp = append(make([]*big.Int, 0, L), C...)
+	for len(Rp) < L {
+		Rp = append(Rp, params.one)
+		Cp = append(Cp, params.one)
+	}
+	return Rp, Cp
+}
+
+// BayerGrothProof is a non-interactive proof that a sequence of ciphertexts is
+// a re-encryption shuffle of another. CA and CB commit to the rows of the
+// permutation and of its image under the challenge x.
+type BayerGrothProof struct {
+	CA, CB   []*big.Int
+	Product  *ProductArgument
+	MultiExp *MultiExpArgument
+}
+
+// ProductArgument shows that the product of the committed values is a given
+// value. If there is more than one row, Cb commits to the product of the rows
+// and Hadamard shows that it is correct; SingleValue shows that the product of
+// the entries of Cb is the given value.
+type ProductArgument struct {
+	Cb          *big.Int
+	Hadamard    *HadamardArgument
+	SingleValue *SingleValueProductArgument
+}
+
+// HadamardArgument shows that Cb commits to the entry-wise product of the
+// rows. CB commits to the intermediate products.
+type HadamardArgument struct {
+	CB   []*big.Int
+	Zero *ZeroArgument
+}
+
+// ZeroArgument shows that sum_i a_i * b_i = 0 for committed vectors a_i and
+// b_i, where * is a bilinear map.
+type ZeroArgument struct {
+	CA0, CBm *big.Int
+	CD       []*big.Int
+	A, B     []*big.Int
+	R, S, T  *big.Int
+}
+
+// SingleValueProductArgument shows that the product of the entries of a
+// committed vector is a given value.
+type SingleValueProductArgument struct {
+	Cd, Cdelta, CDelta *big.Int
+	A, B               []*big.Int
+	R, S               *big.Int
+}
+
+// MultiExpArgument shows that a ciphertext is a re-encryption of the product
+// of the rows of a matrix of ciphertexts raised to the committed exponents.
+type MultiExpArgument struct {
+	CA0          *big.Int
+	CB, ER, EC   []*big.Int
+	A            []*big.Int
+	R, B, S, Tau *big.Int
+}
+
+// Len outputs the number of group elements and the number of elements of Z/q
+// in the proof.
+func (proof *BayerGrothProof) Len() (elements, scalars int) {
+	elements = len(proof.CA) + len(proof.CB)
+	p := proof.Product
+	if p.Hadamard != nil {
+		z := p.Hadamard.Zero
+		elements += 1 + len(p.Hadamard.CB) + 2 + len(z.CD)
+		scalars += len(z.A) + len(z.B) + 3
+	}
+	sv := p.SingleValue
+	elements += 3
+	scalars += len(sv.A) + len(sv.B) + 2
+	me := proof.MultiExp
+	elements += 1 + len(me.CB) + len(me.ER) + len(me.EC)
+	scalars += len(me.A) + 4
+	return
+}
+
+// bayerGrothTranscript starts the Fiat-Shamir transcript with the statement.
+func (pk *PublicKey) bayerGrothTranscript(R, C, R2, C2 []*big.Int, context []byte) *transcriptHash {
+	th := pk.newTranscriptHash("bayer-groth")
+	th.writeInts(pk.Y)
+	th.writeBytes(context)
+	th.writeInts(R...)
+	th.writeInts(C...)
+	th.writeInts(R2...)
+	th.writeInts(C2...)
+	return th
+}
+
+// bayerGrothProductStatement computes the commitments to the rows of y a + b
+// - z and the value prod_i (y i + x^i - z) for the product argument.
+func (pk *PublicKey) bayerGrothProductStatement(ck *PedersenKey, CA, CB []*big.Int, N int, x, y, z *big.Int) (cE []*big.Int, prod *big.Int) {
+	n := len(ck.G)
+	negZ := make([]*big.Int, n)
+	for l := range negZ {
+		negZ[l] = new(big.Int).Sub(pk.Q, z)
+	}
+	cZ := ck.commit(negZ, new(big.Int))
+	cE = make([]*big.Int, len(CA))
+	for k := range CA {
+		cE[k] = new(big.Int).Exp(CA[k], y, pk.P)
+		cE[k].Mul(cE[k], CB[k])
+		cE[k].Mod(cE[k], pk.P)
+		cE[k].Mul(cE[k], cZ)
+		cE[k].Mod(cE[k], pk.P)
+	}
+
+	prod = new(big.Int).Set(pk.one)
+	xi := new(big.Int).Set(pk.one)
+	var t big.Int
+	for i := 1; i <= N; i++ {
+		xi.Mul(xi, x)
+		xi.Mod(xi, pk.Q)
+		t.SetInt64(int64(i))
+		t.Mul(&t, y)
+		t.Add(&t, xi)
+		t.Sub(&t, z)
+		prod.Mul(prod, &t)
+		prod.Mod(prod, pk.Q)
+	}
+	return cE, prod
+}
+
+// BayerGrothProve outputs a proof that (R2, C2) is a re-encryption shuffle of
+// (R, C), given the permutation and randomness output by ReEncryptionMix. The
+// proof is bound to context. There must be at least two ciphertexts, each an
+// element of <G> x <G>.
+func (pk *PublicKey) BayerGrothProve(R, C, R2, C2 []*big.Int, perm Permutation, rands []*big.Int, context []byte) (*BayerGrothProof, error) {
+	N := len(R)
+	if len(C) != N || len(R2) != N || len(C2) != N || len(rands) != N {
+		return nil, errors.New("input lengths do not match")
+	}
+	if N < 2 {
+		return nil, errors.New("need at least two ciphertexts")
+	}
+	if err := perm.Validate(N); err != nil {
+		return nil, err
+	}
+	params := &pk.KeyParameters
+	if !params.areElements(R...) || !params.areElements(C...) ||
+		!params.areElements(R2...) || !params.areElements(C2...) {
+		return nil, errors.New("ciphertext is not an element of <G> x <G>")
+	}
+	m, n := bayerGrothDims(N)
+	ck := params.NewPedersenKey("bayer-groth", n)
+	th := pk.bayerGrothTranscript(R, C, R2, C2, context)
+
+	// Pad the statement to mn ciphertexts. The padding is its own
+	// re-encryption with randomness 0.
+	N = m * n
+	R2, C2 = params.padCiphertexts(R2, C2, N)
+	pad := IdentityPermutation(N)
+	copy(pad, perm)
+	padRands := make([]*big.Int, N)
+	copy(padRands, rands)
+	for j := len(rands); j < N; j++ {
+		padRands[j] = new(big.Int)
+	}
+
+	// Output j is a re-encryption of input pi[j] with randomness rho[j].
+	pi, rho := pad.Inverse(), pad.Apply(padRands)
+
+	var err error
+	proof := &BayerGrothProof{CA: make([]*big.Int, m), CB: make([]*big.Int, m)}
+	a := make([]*big.Int, N)
+	for j := range a {
+		a[j] = big.NewInt(int64(pi[j] + 1))
+	}
+	A := split(a, m)
+	r, err := params.sampleVec(m)
+	if err != nil {
+		return nil, err
+	}
+	for k := range A {
+		proof.CA[k] = ck.commit(A[k], r[k])
+	}
+	th.writeInts(proof.CA...)
+	x := th.challenge(params)
+
+	xs := params.powers(x, N+1)
+	b := make([]*big.Int, N)
+	for j := range b {
+		b[j] = xs[pi[j]+1]
+	}
+	B := split(b, m)
+	s, err := params.sampleVec(m)
+	if err != nil {
+		return nil, err
+	}
+	for k := range B {
+		proof.CB[k] = ck.commit(B[k], s[k])
+	}
+	th.writeInts(proof.CB...)
+	th.writeBytes([]byte("y"))
+	y := th.challenge(params)
+	th.writeBytes([]byte("z"))
+	z := th.challenge(params)
+
+	// Product argument for the rows of e = y a + b - z.
+	cE, prod := pk.bayerGrothProductStatement(ck, proof.CA, proof.CB, N, x, y, z)
+	e := make([]*big.Int, N)
+	for j := range e {
+		e[j] = new(big.Int).Mul(y, a[j])
+		e[j].Add(e[j], b[j])
+		e[j].Sub(e[j], z)
+		e[j].Mod(e[j], pk.Q)
+	}
+	t := make([]*big.Int, m)
+	for k := range t {
+		t[k] = new(big.Int).Mul(y, r[k])
+		t[k].Add(t[k], s[k])
+		t[k].Mod(t[k], pk.Q)
+	}
+	if proof.Product, err = params.productProve(ck, th, cE, split(e, m), t, prod); err != nil {
+		return nil, err
+	}
+
+	// Multi-exponentiation argument: prod C_i^{x^i} = E(1; -<rho, b>) prod
+	// C'_j^{b_j}.
+	negRho := params.combine(rho, b)
+	negRho.Sub(pk.Q, negRho)
+	negRho.Mod(negRho, pk.Q)
+	if proof.MultiExp, err = pk.multiExpProve(ck, th, split(R2, m), split(C2, m), B, s, negRho); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
+
+// BayerGrothVerify verifies a proof output by BayerGrothProve that (R2, C2)
+// is a re-encryption shuffle of (R, C).
+func (pk *PublicKey) BayerGrothVerify(R, C, R2, C2 []*big.Int, proof *BayerGrothProof, context []byte) bool {
+	N := len(R)
+	if len(C) != N || len(R2) != N || len(C2) != N || N < 2 {
+		return false
+	}
+	if proof == nil || proof.Product == nil || proof.MultiExp == nil {
+		return false
+	}
+	params := &pk.KeyParameters
+	m, n := bayerGrothDims(N)
+	if len(proof.CA) != m || len(proof.CB) != m ||
+		!params.areElements(proof.CA...) || !params.areElements(proof.CB...) {
+		return false
+	}
+	if !params.areElements(R...) || !params.areElements(C...) ||
+		!params.areElements(R2...) || !params.areElements(C2...) {
+		return false
+	}
+	ck := params.NewPedersenKey("bayer-groth", n)
+	th := pk.bayerGrothTranscript(R, C, R2, C2, context)
+	N = m * n
+	R, C = params.padCiphertexts(R, C, N)
+	R2, C2 = params.padCiphertexts(R2, C2, N)
+
+	th.writeInts(proof.CA...)
+	x := th.challenge(params)
+	th.writeInts(proof.CB...)
+	th.writeBytes([]byte("y"))
+	y := th.challenge(params)
+	th.writeBytes([]byte("z"))
+	z := th.challenge(params)
+
+	cE, prod := pk.bayerGrothProductStatement(ck, proof.CA, proof.CB, N, x, y, z)
+	if !params.productVerify(ck, th, cE, prod, proof.Product) {
+		return false
+	}
+
+	xs := params.powers(x, N+1)
+	TR := params.expProd(R, xs[1:])
+	TC := params.expProd(C, xs[1:])
+	return pk.multiExpVerify(ck, th, split(R2, m), split(C2, m), proof.CB, TR, TC, proof.MultiExp)
+}
+
+// productProve proves that the product of the entries of the rows A, committed
+// as cA with randomness r, is b.
+func (params *KeyParameters) productProve(ck *PedersenKey, th *transcriptHash, cA []*big.Int, A [][]*big.Int, r []*big.Int, b *big.Int) (*ProductArgument, error) {
+	var err error
+	arg := new(ProductArgument)
+	if len(A) == 1 {
+		arg.SingleValue, err = params.singleValueProve(ck, th, cA[0], A[0], r[0], b)
+		return arg, err
+	}
+
+	n := len(A[0])
+	p := make([]*big.Int, n)
+	for l := range p {
+		p[l] = new(big.Int).Set(params.one)
+		for k := range A {
+			p[l].Mul(p[l], A[k][l])
+			p[l].Mod(p[l], params.Q)
+		}
+	}
+	s, err := params.Sample()
+	if err != nil {
+		return nil, err
+	}
+	arg.Cb = ck.commit(p, s)
+	th.writeInts(arg.Cb)
+	if arg.Hadamard, err = params.hadamardProve(ck, th, cA, A, r, arg.Cb, p, s); err != nil {
+		return nil, err
+	}
+	if arg.SingleValue, err = params.singleValueProve(ck, th, arg.Cb, p, s, b); err != nil {
+		return nil, err
+	}
+	return arg, nil
+}
+
+// productVerify verifies a product argument that the product of the values
+// committed by cA is b.
+func (params *KeyParameters) productVerify(ck *PedersenKey, th *transcriptHash, cA []*big.Int, b *big.Int, arg *ProductArgument) bool {
+	if arg.SingleValue == nil {
+		return false
+	}
+	if len(cA) == 1 {
+		return arg.Cb == nil && arg.Hadamard == nil &&
+			params.singleValueVerify(ck, th, cA[0], b, arg.SingleValue)
+	}
+	if arg.Hadamard == nil || !params.areElements(arg.Cb) {
+		return false
+	}
+	th.writeInts(arg.Cb)
+	return params.hadamardVerify(ck, th, cA, arg.Cb, arg.Hadamard) &&
+		params.singleValueVerify(ck, th, arg.Cb, b, arg.SingleValue)
+}
+
+// hadamardStatement computes the commitments for the zero argument that shows
+// that cB[i] = cB[i-1] o cA[i] for each i, where cB[0] = cA[0] and o is the
+// entry-wise product: the zero argument is over cA[1], ..., cA[m-1], com(-1)
+// and cB[0]^x, ..., cB[m-2]^(x^(m-1)), prod_i cB[i]^(x^i).
+func (params *KeyParameters) hadamardStatement(ck *PedersenKey, cA, cB []*big.Int, x *big.Int) (cZA, cZB []*big.Int) {
+	m := len(cA)
+	n := len(ck.G)
+	negOne := make([]*big.Int, n)
+	for l := range negOne {
+		negOne[l] = new(big.Int).Sub(params.Q, params.one)
+	}
+	cZA = append(append([]*big.Int{}, cA[1:]...), ck.commit(negOne, new(big.Int)))
+
+	xs := params.powers(x, m)
+	cZB = make([]*big.Int, m)
+	for i := 1; i < m; i++ {
+		cZB[i-1] = new(big.Int).Exp(cB[i-1], xs[i], params.P)
+	}
+	cZB[m-1] = params.expProd(cB[1:], xs[1:])
+	return cZA, cZB
+}
+
+// hadamardProve proves that b, committed as cb with randomness s, is the
+// entry-wise product of the rows A.
+func (params *KeyParameters) hadamardProve(ck *PedersenKey, th *transcriptHash, cA []*big.Int, A [][]*big.Int, r []*big.Int, cb *big.Int, b []*big.Int, s *big.Int) (*HadamardArgument, error) {
+	m, n := len(A), len(A[0])
+	B := make([][]*big.Int, m)
+	sB := make([]*big.Int, m)
+	cB := make([]*big.Int, m)
+	B[0], sB[0], cB[0] = A[0], r[0], cA[0]
+	for k := 1; k < m; k++ {
+		B[k] = make([]*big.Int, n)
+		for l := range B[k] {
+			B[k][l] = new(big.Int).Mul(B[k-1][l], A[k][l])
+			B[k][l].Mod(B[k][l], params.Q)
+		}
+		if k < m-1 {
+			var err error
+			if sB[k], err = params.Sample(); err != nil {
+				return nil, err
+			}
+			cB[k] = ck.commit(B[k], sB[k])
+		}
+	}
+	B[m-1], sB[m-1], cB[m-1] = b, s, cb
+
+	arg := &HadamardArgument{CB: append([]*big.Int{}, cB[1:m-1]...)}
+	th.writeInts(arg.CB...)
+	th.writeBytes([]byte("x"))
+	x := th.challenge(params)
+	th.writeBytes([]byte("y"))
+	y := th.challenge(params)
+
+	cZA, cZB := params.hadamardStatement(ck, cA, cB, x)
+	xs := params.powers(x, m)
+	negOne := make([]*big.Int, n)
+	for l := range negOne {
+		negOne[l] = new(big.Int).Sub(params.Q, params.one)
+	}
+	ZA := append(append([][]*big.Int{}, A[1:]...), negOne)
+	rZA := append(append([]*big.Int{}, r[1:]...), new(big.Int))
+	ZB := make([][]*big.Int, m)
+	sZB := make([]*big.Int, m)
+	for i := 1; i < m; i++ {
+		ZB[i-1] = params.combineVecs(B[i-1:i], xs[i:i+1])
+		sZB[i-1] = params.combine(sB[i-1:i], xs[i:i+1])
+	}
+	ZB[m-1] = params.combineVecs(B[1:], xs[1:])
+	sZB[m-1] = params.combine(sB[1:], xs[1:])
+
+	var err error
+	if arg.Zero, err = params.zeroProve(ck, th, cZA, ZA, rZA, cZB, ZB, sZB, y); err != nil {
+		return nil, err
+	}
+	return arg, nil
+}
+
+// hadamardVerify verifies a Hadamard argument that cb commits to the
+// entry-wise product of the rows committed by cA.
+func (params *KeyParameters) hadamardVerify(ck *PedersenKey, th *transcriptHash, cA []*big.Int, cb *big.Int, arg *HadamardArgument) bool {
+	m := len(cA)
+	if len(arg.CB) != m-2 || !params.areElements(arg.CB...) || arg.Zero == nil {
+		return false
+	}
+	cB := append(append([]*big.Int{cA[0]}, arg.CB...), cb)
+	th.writeInts(arg.CB...)
+	th.writeBytes([]byte("x"))
+	x := th.challenge(params)
+	th.writeBytes([]byte("y"))
+	y := th.challenge(params)
+
+	cZA, cZB := params.hadamardStatement(ck, cA, cB, x)
+	return params.zeroVerify(ck, th, cZA, cZB, y, arg.Zero)
+}
+
+// zeroProve proves that sum_i A[i] * B[i] = 0, where * is the bilinear map
+// with parameter y and the vectors are committed as cA and cB with randomness
+// r and s.
+func (params *KeyParameters) zeroProve(ck *PedersenKey, th *transcriptHash, cA []*big.Int, A [][]*big.Int, r []*big.Int, cB []*big.Int, B [][]*big.Int, s []*big.Int, y *big.Int) (*ZeroArgument, error) {
+	m, n := len(A), len(A[0])
+	a0, err := params.sampleVec(n)
+	if err != nil {
+		return nil, err
+	}
+	bm, err := params.sampleVec(n)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := params.sampleVec(2)
+	if err != nil {
+		return nil, err
+	}
+	// AA[i] for i = 0, ..., m and BB[j-1] for j = 1, ..., m+1.
+	AA := append([][]*big.Int{a0}, A...)
+	rA := append([]*big.Int{rs[0]}, r...)
+	BB := append(append([][]*big.Int{}, B...), bm)
+	sB := append(append([]*big.Int{}, s...), rs[1])
+
+	arg := &ZeroArgument{CA0: ck.commit(a0, rs[0]), CBm: ck.commit(bm, rs[1])}
+	d := make([]*big.Int, 2*m+1)
+	for k := range d {
+		d[k] = new(big.Int)
+	}
+	for i := 0; i <= m; i++ {
+		for j := 1; j <= m+1; j++ {
+			k := i + m + 1 - j
+			d[k].Add(d[k], params.bilinear(AA[i], BB[j-1], y))
+			d[k].Mod(d[k], params.Q)
+		}
+	}
+	t, err := params.sampleVec(2*m + 1)
+	if err != nil {
+		return nil, err
+	}
+	t[m+1].SetInt64(0)
+	arg.CD = make([]*big.Int, 2*m+1)
+	for k := range d {
+		arg.CD[k] = ck.commit(d[k:k+1], t[k])
+	}
+	th.writeInts(arg.CA0, arg.CBm)
+	th.writeInts(arg.CD...)
+	x := th.challenge(params)
+
+	xs := params.powers(x, 2*m+1)
+	rev := make([]*big.Int, m+1) // x^(m+1-j) for j = 1, ..., m+1
+	for j := 1; j <= m+1; j++ {
+		rev[j-1] = xs[m+1-j]
+	}
+	arg.A = params.combineVecs(AA, xs[:m+1])
+	arg.R = params.combine(rA, xs[:m+1])
+	arg.B = params.combineVecs(BB, rev)
+	arg.S = params.combine(sB, rev)
+	arg.T = params.combine(t, xs)
+	return arg, nil
+}
+
+// zeroVerify verifies a zero argument for the commitments cA and cB.
+func (params *KeyParameters) zeroVerify(ck *PedersenKey, th *transcriptHash, cA, cB []*big.Int, y *big.Int, arg *ZeroArgument) bool {
+	m, n := len(cA), len(ck.G)
+	if len(arg.CD) != 2*m+1 || len(arg.A) != n || len(arg.B) != n ||
+		!params.areElements(arg.CA0, arg.CBm) || !params.areElements(arg.CD...) ||
+		!params.areScalars(arg.A...) || !params.areScalars(arg.B...) ||
+		!params.areScalars(arg.R, arg.S, arg.T) {
+		return false
+	}
+	// The commitment to d_(m+1) = sum_i a_i * b_i must be com(0; 0) = 1.
+	if arg.CD[m+1].Cmp(params.one) != 0 {
+		return false
+	}
+	th.writeInts(arg.CA0, arg.CBm)
+	th.writeInts(arg.CD...)
+	x := th.challenge(params)
+
+	xs := params.powers(x, 2*m+1)
+	rev := make([]*big.Int, m+1)
+	for j := 1; j <= m+1; j++ {
+		rev[j-1] = xs[m+1-j]
+	}
+	cAA := append([]*big.Int{arg.CA0}, cA...)
+	cBB := append(append([]*big.Int{}, cB...), arg.CBm)
+	return params.expProd(cAA, xs[:m+1]).Cmp(ck.commit(arg.A, arg.R)) == 0 &&
+		params.expProd(cBB, rev).Cmp(ck.commit(arg.B, arg.S)) == 0 &&
+		params.expProd(arg.CD, xs).Cmp(ck.commit([]*big.Int{params.bilinear(arg.A, arg.B, y)}, arg.T)) == 0
+}
+
+// singleValueProve proves that the product of the entries of a, committed as
+// ca with randomness r, is b.
+func (params *KeyParameters) singleValueProve(ck *PedersenKey, th *transcriptHash, ca *big.Int, a []*big.Int, r, b *big.Int) (*SingleValueProductArgument, error) {
+	n := len(a)
+	// bs[i] = a[0] ... a[i].
+	bs := make([]*big.Int, n)
+	bs[0] = a[0]
+	for i := 1; i < n; i++ {
+		bs[i] = new(big.Int).Mul(bs[i-1], a[i])
+		bs[i].Mod(bs[i], params.Q)
+	}
+	d, err := params.sampleVec(n)
+	if err != nil {
+		return nil, err
+	}
+	delta, err := params.sampleVec(n)
+	if err != nil {
+		return nil, err
+	}
+	delta[0].Set(d[0])
+	delta[n-1].SetInt64(0)
+	rs, err := params.sampleVec(3)
+	if err != nil {
+		return nil, err
+	}
+	rd, s1, sx := rs[0], rs[1], rs[2]
+
+	v1 := make([]*big.Int, n-1)
+	v2 := make([]*big.Int, n-1)
+	var t big.Int
+	for i := 0; i < n-1; i++ {
+		v1[i] = new(big.Int).Mul(delta[i], d[i+1])
+		v1[i].Neg(v1[i])
+		v1[i].Mod(v1[i], params.Q)
+		v2[i] = new(big.Int).Set(delta[i+1])
+		v2[i].Sub(v2[i], t.Mul(a[i+1], delta[i]))
+		v2[i].Sub(v2[i], t.Mul(bs[i], d[i+1]))
+		v2[i].Mod(v2[i], params.Q)
+	}
+	arg := &SingleValueProductArgument{
+		Cd:     ck.commit(d, rd),
+		Cdelta: ck.commit(v1, s1),
+		CDelta: ck.commit(v2, sx),
+	}
+	th.writeInts(arg.Cd, arg.Cdelta, arg.CDelta)
+	x := th.challenge(params)
+
+	arg.A = make([]*big.Int, n)
+	arg.B = make([]*big.Int, n)
+	for i := range a {
+		arg.A[i] = new(big.Int).Mul(x, a[i])
+		arg.A[i].Add(arg.A[i], d[i])
+		arg.A[i].Mod(arg.A[i], params.Q)
+		arg.B[i] = new(big.Int).Mul(x, bs[i])
+		arg.B[i].Add(arg.B[i], delta[i])
+		arg.B[i].Mod(arg.B[i], params.Q)
+	}
+	arg.R = new(big.Int).Mul(x, r)
+	arg.R.Add(arg.R, rd)
+	arg.R.Mod(arg.R, params.Q)
+	arg.S = new(big.Int).Mul(x, sx)
+	arg.S.Add(arg.S, s1)
+	arg.S.Mod(arg.S, params.Q)
+	return arg, nil
+}
+
+// singleValueVerify verifies a single value product argument that the product
+// of the entries committed by ca is b.
+func (params *KeyParameters) singleValueVerify(ck *PedersenKey, th *transcriptHash, ca, b *big.Int, arg *SingleValueProductArgument) bool {
+	n := len(ck.G)
+	if len(arg.A) != n || len(arg.B) != n ||
+		!params.areElements(arg.Cd, arg.Cdelta, arg.CDelta) ||
+		!params.areScalars(arg.A...) || !params.areScalars(arg.B...) ||
+		!params.areScalars(arg.R, arg.S) {
+		return false
+	}
+	th.writeInts(arg.Cd, arg.Cdelta, arg.CDelta)
+	x := th.challenge(params)
+
+	L := new(big.Int).Exp(ca, x, params.P)
+	L.Mul(L, arg.Cd)
+	L.Mod(L, params.P)
+	if L.Cmp(ck.commit(arg.A, arg.R)) != 0 {
+		return false
+	}
+	w := make([]*big.Int, n-1)
+	var t big.Int
+	for i := range w {
+		w[i] = new(big.Int).Mul(x, arg.B[i+1])
+		w[i].Sub(w[i], t.Mul(arg.B[i], arg.A[i+1]))
+		w[i].Mod(w[i], params.Q)
+	}
+	L.Exp(arg.CDelta, x, params.P)
+	L.Mul(L, arg.Cdelta)
+	L.Mod(L, params.P)
+	if L.Cmp(ck.commit(w, arg.S)) != 0 {
+		return false
+	}
+	xb := new(big.Int).Mul(x, b)
+	xb.Mod(xb, params.Q)
+	return arg.B[0].Cmp(arg.A[0]) == 0 && arg.B[n-1].Cmp(xb) == 0
+}
+
+// multiExpProve proves that E(1; rho) prod_i (R2[i], C2[i])^A[i] is the
+// target ciphertext, where the rows A are committed with randomness r and each
+// (R2[i], C2[i])^A[i] is the product of the row's ciphertexts raised to the
+// entries of A[i].
+func (pk *PublicKey) multiExpProve(ck *PedersenKey, th *transcriptHash, R2, C2, A [][]*big.Int, r []*big.Int, rho *big.Int) (*MultiExpArgument, error) {
+	params := &pk.KeyParameters
+	m, n := len(A), len(A[0])
+	a0, err := params.sampleVec(n)
+	if err != nil {
+		return nil, err
+	}
+	r0, err := params.Sample()
+	if err != nil {
+		return nil, err
+	}
+	b, err := params.sampleVec(2 * m)
+	if err != nil {
+		return nil, err
+	}
+	s, err := params.sampleVec(2 * m)
+	if err != nil {
+		return nil, err
+	}
+	tau, err := params.sampleVec(2 * m)
+	if err != nil {
+		return nil, err
+	}
+	b[m].SetInt64(0)
+	s[m].SetInt64(0)
+	tau[m].Set(rho)
+	AA := append([][]*big.Int{a0}, A...)
+	rA := append([]*big.Int{r0}, r...)
+
+	arg := &MultiExpArgument{
+		CA0: ck.commit(a0, r0),
+		CB:  make([]*big.Int, 2*m),
+		ER:  make([]*big.Int, 2*m),
+		EC:  make([]*big.Int, 2*m),
+	}
+	for k := 0; k < 2*m; k++ {
+		arg.CB[k] = ck.commit(b[k:k+1], s[k])
+		arg.ER[k], arg.EC[k] = pk.encryptWith(new(big.Int).Exp(pk.G, b[k], pk.P), tau[k])
+		for i := 1; i <= m; i++ {
+			if j := k - m + i; 0 <= j && j <= m {
+				arg.ER[k].Mul(arg.ER[k], params.expProd(R2[i-1], AA[j]))
+				arg.EC[k].Mul(arg.EC[k], params.expProd(C2[i-1], AA[j]))
+				arg.ER[k].Mod(arg.ER[k], pk.P)
+				arg.EC[k].Mod(arg.EC[k], pk.P)
+			}
+		}
+	}
+	th.writeInts(arg.CA0)
+	th.writeInts(arg.CB...)
+	th.writeInts(arg.ER...)
+	th.writeInts(arg.EC...)
+	x := th.challenge(params)
+
+	xs := params.powers(x, 2*m)
+	arg.A = params.combineVecs(AA, xs[:m+1])
+	arg.R = params.combine(rA, xs[:m+1])
+	arg.B = params.combine(b, xs)
+	arg.S = params.combine(s, xs)
+	arg.Tau = params.combine(tau, xs)
+	return arg, nil
+}
+
+// multiExpVerify verifies a multi-exponentiation argument that (TR, TC) is a
+// re-encryption of prod_i (R2[i], C2[i])^A[i] for the rows A committed by cA.
+func (pk *PublicKey) multiExpVerify(ck *PedersenKey, th *transcriptHash, R2, C2 [][]*big.Int, cA []*big.Int, TR, TC *big.Int, arg *MultiExpArgument) bool {
+	params := &pk.KeyParameters
+	m, n := len(cA), len(ck.G)
+	if len(arg.CB) != 2*m || len(arg.ER) != 2*m || len(arg.EC) != 2*m || len(arg.A) != n ||
+		!params.areElements(arg.CA0) || !params.areElements(arg.CB...) ||
+		!params.areElements(arg.ER...) || !params.areElements(arg.EC...) ||
+		!params.areScalars(arg.A...) || !params.areScalars(arg.R, arg.B, arg.S, arg.Tau) {
+		return false
+	}
+	if arg.CB[m].Cmp(params.one) != 0 || arg.ER[m].Cmp(TR) != 0 || arg.EC[m].Cmp(TC) != 0 {
+		return false
+	}
+	th.writeInts(arg.CA0)
+	th.writeInts(arg.CB...)
+	th.writeInts(arg.ER...)
+	th.writeInts(arg.EC...)
+	x := th.challenge(params)
+
+	xs := params.powers(x, 2*m)
+	cAA := append([]*big.Int{arg.CA0}, cA...)
+	if params.expProd(cAA, xs[:m+1]).Cmp(ck.commit(arg.A, arg.R)) != 0 {
+		return false
+	}
+	if params.expProd(arg.CB, xs).Cmp(ck.commit([]*big.Int{arg.B}, arg.S)) != 0 {
+		return false
+	}
+	LR, LC := params.expProd(arg.ER, xs), params.expProd(arg.EC, xs)
+	RR, RC := pk.encryptWith(new(big.Int).Exp(pk.G, arg.B, pk.P), arg.Tau)
+	e := make([]*big.Int, n)
+	for i := 1; i <= m; i++ {
+		for l := range e {
+			e[l] = new(big.Int).Mul(xs[m-i], arg.A[l])
+			e[l].Mod(e[l], params.Q)
+		}
+		params.mulCt(RR, RC, params.expProd(R2[i-1], e), params.expProd(C2[i-1], e))
+	}
+	return LR.Cmp(RR) == 0 && LC.Cmp(RC) == 0
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// testBayerGrothInstance returns a key pair, exponential encryptions of 1,
+// ..., N, and a re-encryption shuffle of them with its witness.
+func testBayerGrothInstance(t *testing.T, params *KeyParameters, N int) (pk *PublicKey, R, C, R2, C2 []*big.Int, perm []int, rands []*big.Int) {
+	pk, _ = params.GenerateKeys()
+	R = make([]*big.Int, N)
+	C = make([]*big.Int, N)
+	var err error
+	for i := range R {
+		if R[i], C[i], err = pk.EncryptExp(big.NewInt(int64(i + 1))); err != nil {
+			t.Fatal("EncryptExp() fails:", err)
+		}
+	}
+	perm = testPerm(t, N)
+	if R2, C2, rands, err = pk.ReEncryptionMix(R, C, perm); err != nil {
+		t.Fatal("ReEncryptionMix() fails:", err)
+	}
+	return
+}
+
+// Test that the matrix has about sqrt(N) rows and columns, with at least two
+// columns, whether or not N factors.
+func TestBayerGrothDims(t *testing.T) {
+	for _, test := range []struct{ N, m, n int }{
+		{2, 1, 2}, {3, 1, 3}, {4, 2, 2}, {6, 2, 3}, {7, 2, 4}, {12, 3, 4}, {13, 3, 5},
+		{16, 4, 4}, {97, 9, 11}, {100, 10, 10},
+	} {
+		if m, n := bayerGrothDims(test.N); m != test.m || n != test.n {
+			t.Errorf("bayerGrothDims(%d) = %d, %d; want %d, %d", test.N, m, n, test.m, test.n)
+		}
+	}
+}
+
+// Test that honest proofs verify for various dimensions, including a single
+// row.
+func TestBayerGrothProveVerify(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	context := []byte("test")
+	for _, N := range []int{2, 3, 4, 5, 7, 9, 12} {
+		pk, R, C, R2, C2, perm, rands := testBayerGrothInstance(t, params, N)
+		proof, err := pk.BayerGrothProve(R, C, R2, C2, perm, rands, context)
+		if err != nil {
+			t.Fatalf("N=%d: BayerGrothProve() fails: %s", N, err)
+		}
+		if !pk.BayerGrothVerify(R, C, R2, C2, proof, context) {
+			t.Errorf("N=%d: BayerGrothVerify() rejects a valid proof", N)
+		}
+		if pk.BayerGrothVerify(R, C, R2, C2, proof, []byte("other")) {
+			t.Errorf("N=%d: BayerGrothVerify() accepts a proof for another context", N)
+		}
+	}
+}
+
+// Test that the proof does not verify for outputs that are not a shuffle of
+// the inputs.
+func TestBadBayerGrothProveVerify(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	context := []byte("test")
+	N := 6
+	pk, R, C, R2, C2, perm, rands := testBayerGrothInstance(t, params, N)
+
+	// Replace an output with an encryption of another message.
+	M := new(big.Int).Exp(params.G, big.NewInt(1000), params.P)
+	bad := append([]*big.Int{}, C2...)
+	badR := append([]*big.Int{}, R2...)
+	badR[perm[0]], bad[perm[0]] = pk.encryptWith(M, rands[0])
+	proof, err := pk.BayerGrothProve(R, C, badR, bad, perm, rands, context)
+	if err != nil {
+		t.Fatal("BayerGrothProve() fails:", err)
+	}
+	if pk.BayerGrothVerify(R, C, badR, bad, proof, context) {
+		t.Error("BayerGrothVerify() accepts a substituted output")
+	}
+
+	// Prove with the wrong permutation.
+	wrong := append([]int{}, perm...)
+	wrong[0], wrong[1] = wrong[1], wrong[0]
+	if proof, err = pk.BayerGrothProve(R, C, R2, C2, wrong, rands, context); err != nil {
+		t.Fatal("BayerGrothProve() fails:", err)
+	}
+	if pk.BayerGrothVerify(R, C, R2, C2, proof, context) {
+		t.Error("BayerGrothVerify() accepts a proof with the wrong permutation")
+	}
+
+	// Tamper with a valid proof.
+	if proof, err = pk.BayerGrothProve(R, C, R2, C2, perm, rands, context); err != nil {
+		t.Fatal("BayerGrothProve() fails:", err)
+	}
+	proof.MultiExp.Tau.Add(proof.MultiExp.Tau, params.one)
+	if pk.BayerGrothVerify(R, C, R2, C2, proof, context) {
+		t.Error("BayerGrothVerify() accepts a modified proof")
+	}
+}
+
+// Test that the proof is sublinear in N.
+func TestBayerGrothProofSize(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 16
+	pk, R, C, R2, C2, perm, rands := testBayerGrothInstance(t, params, N)
+	proof, err := pk.BayerGrothProve(R, C, R2, C2, perm, rands, nil)
+	if err != nil {
+		t.Fatal("BayerGrothProve() fails:", err)
+	}
+	elements, scalars := proof.Len()
+	// m = n = 4: 2m commitments, the product argument with 3m+5 elements
+	// and 4n+5 scalars, and the multi-exponentiation argument with 6m+1
+	// elements and n+4 scalars.
+	if elements != 2*4+3*4+5+6*4+1 || scalars != 4*4+5+4+4 {
+		t.Errorf("Len() = %d, %d", elements, scalars)
+	}
+}
+
+// Test that the proof for a prime number of ciphertexts, which is padded, is
+// sublinear in N and does not verify for a shorter or longer statement.
+func TestBayerGrothPrime(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 13
+	pk, R, C, R2, C2, perm, rands := testBayerGrothInstance(t, params, N)
+	proof, err := pk.BayerGrothProve(R, C, R2, C2, perm, rands, nil)
+	if err != nil {
+		t.Fatal("BayerGrothProve() fails:", err)
+	}
+	if !pk.BayerGrothVerify(R, C, R2, C2, proof, nil) {
+		t.Fatal("BayerGrothVerify() rejects a valid proof")
+	}
+	// m = 3, n = 5, as in TestBayerGrothProofSize.
+	elements, scalars := proof.Len()
+	if elements != 2*3+3*3+5+6*3+1 || scalars != 4*5+5+5+4 {
+		t.Errorf("Len() = %d, %d", elements, scalars)
+	}
+
+	// Appending the padding to the statement changes the transcript.
+	one := params.one
+	Rp, Cp := append(R, one), append(C, one)
+	R2p, C2p := append(R2, one), append(C2, one)
+	if pk.BayerGrothVerify(Rp, Cp, R2p, C2p, proof, nil) {
+		t.Error("BayerGrothVerify() accepts the proof for a padded statement")
+	}
+	if pk.BayerGrothVerify(R[:N-1], C[:N-1], R2[:N-1], C2[:N-1], proof, nil) {
+		t.Error("BayerGrothVerify() accepts the proof for a truncated statement")
+	}
+}
+
+// Test that ciphertexts outside of <G> x <G> are rejected.
+func TestBayerGrothNotElement(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, R, C, R2, C2, perm, rands := testBayerGrothInstance(t, params, 4)
+	X, _ := params.Encode([]byte("1"))
+	if params.IsElement(X) {
+		t.Skip("encoded message happens to be in <G>")
+	}
+	R[0], C[0] = pk.Encrypt(X)
+	if _, err := pk.BayerGrothProve(R, C, R2, C2, perm, rands, nil); err == nil {
+		t.Error("BayerGrothProve() accepts ciphertexts outside of <G> x <G>")
+	}
+}
@@ -0,0 +1,398 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// Batch sizes for the benchmarks of Mix and GeneratePerm.
+var benchMixSizes = []int{10, 100, 1000}
+
+// Batch sizes for the benchmarks of the proofs.
+var benchProofSizes = []int{10, 100}
+
+// Test that the benchmark parameters are well-formed.
+func TestBenchParams(t *testing.T) {
+	one := big.NewInt(1)
+	for _, bp := range benchParams {
+		params := NewKeyParametersFromStrings(bp.p, bp.g, bp.q)
+		if params == nil {
+			t.Fatalf("%s: NewKeyParametersFromStrings() = nil", bp.name)
+		}
+		if !params.P.ProbablyPrime(20) {
+			t.Errorf("%s: primality test fails for P", bp.name)
+		}
+		if !params.Q.ProbablyPrime(20) {
+			t.Errorf("%s: primality test fails for Q", bp.name)
+		}
+		if new(big.Int).Mod(new(big.Int).Sub(params.P, one), params.Q).Sign() != 0 {
+			t.Errorf("%s: Q does not divide P-1", bp.name)
+		}
+		if params.G.Cmp(one) == 0 || new(big.Int).Exp(params.G, params.Q, params.P).Cmp(one) != 0 {
+			t.Errorf("%s: G does not have order Q", bp.name)
+		}
+	}
+}
+
+// benchEachParams runs f as a sub-benchmark for each parameter set.
+func benchEachParams(b *testing.B, f func(b *testing.B, params *KeyParameters)) {
+	for _, bp := range benchParams {
+		params := NewKeyParametersFromStrings(bp.p, bp.g, bp.q)
+		b.Run(bp.name, func(b *testing.B) {
+			f(b, params)
+		})
+	}
+}
+
+// benchEachSize runs f as a sub-benchmark for each parameter set and batch
+// size.
+func benchEachSize(b *testing.B, sizes []int, f func(b *testing.B, params *KeyParameters, N int)) {
+	benchEachParams(b, func(b *testing.B, params *KeyParameters) {
+		for _, N := range sizes {
+			b.Run(fmt.Sprintf("N=%d", N), func(b *testing.B) {
+				f(b, params, N)
+			})
+		}
+	})
+}
+
+// benchCiphertexts returns a key pair and the encryptions of N messages.
+func benchCiphertexts(b *testing.B, params *KeyParameters, N int) (pk *PublicKey, sk *SecretKey, R, C []*big.Int) {
+	pk, sk = params.GenerateKeys()
+	R = make([]*big.Int, N)
+	C = make([]*big.Int, N)
+	for i := 0; i < N; i++ {
+		M, err := params.Encode([]byte(fmt.Sprintf("message %d", i)))
+		if err != nil {
+			b.Fatal("params.Encode() fails:", err)
+		}
+		R[i], C[i] = pk.Encrypt(M)
+	}
+	return
+}
+
+func BenchmarkGenerateKeys(b *testing.B) {
+	benchEachParams(b, func(b *testing.B, params *KeyParameters) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			params.GenerateKeys()
+		}
+	})
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	benchEachParams(b, func(b *testing.B, params *KeyParameters) {
+		pk, _, _, _ := benchCiphertexts(b, params, 0)
+		M, _ := params.Encode([]byte("hello, world!"))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			pk.Encrypt(M)
+		}
+	})
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	benchEachParams(b, func(b *testing.B, params *KeyParameters) {
+		_, sk, R, C := benchCiphertexts(b, params, 1)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			sk.Decrypt(R[0], C[0])
+		}
+	})
+}
+
+func BenchmarkEncode(b *testing.B) {
+	benchEachParams(b, func(b *testing.B, params *KeyParameters) {
+		msg := make([]byte, params.MaxMsgBytes())
+		b.SetBytes(int64(len(msg)))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := params.Encode(msg); err != nil {
+				b.Fatal("params.Encode() fails:", err)
+			}
+		}
+	})
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchEachParams(b, func(b *testing.B, params *KeyParameters) {
+		msg := make([]byte, params.MaxMsgBytes())
+		M, _ := params.Encode(msg)
+		b.SetBytes(int64(len(msg)))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := params.Decode(M); err != nil {
+				b.Fatal("params.Decode() fails:", err)
+			}
+		}
+	})
+}
+
+func BenchmarkMix(b *testing.B) {
+	benchEachSize(b, benchMixSizes, func(b *testing.B, params *KeyParameters, N int) {
+		_, sk, R, C := benchCiphertexts(b, params, N)
+		perm := testPerm(b, N)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := sk.Mix(R, C, perm); err != nil {
+				b.Fatal("sk.Mix() fails:", err)
+			}
+		}
+	})
+}
+
+func BenchmarkGeneratePerm(b *testing.B) {
+	for _, N := range benchMixSizes {
+		b.Run(fmt.Sprintf("N=%d", N), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := GeneratePerm(N); err != nil {
+					b.Fatal("GeneratePerm() fails:", err)
+				}
+			}
+		})
+	}
+}
+
+// benchILMPInstance returns an instance of ILMP of length N in which
+// y is a permutation of x.
+func benchILMPInstance(t testing.TB, params *KeyParameters, N int) (x, y, X, Y []big.Int) {
+	x = make([]big.Int, N)
+	y = make([]big.Int, N)
+	X = make([]big.Int, N)
+	Y = make([]big.Int, N)
+	pi := testPerm(t, N)
+	for i := 0; i < N; i++ {
+		x[i].Set(testSample(t, params))
+	}
+	for i := 0; i < N; i++ {
+		y[i].Set(&x[pi[i]])
+		X[i].Exp(params.G, &x[i], params.P)
+		Y[i].Exp(params.G, &y[i], params.P)
+	}
+	return
+}
+
+// The ILMP and Shuffle0 benchmarks measure a complete run of the protocol,
+// i.e., the time spent by both the prover and verifier.
+
+func BenchmarkILMPProveVerify(b *testing.B) {
+	benchEachSize(b, benchProofSizes, func(b *testing.B, params *KeyParameters, N int) {
+		x, y, X, Y := benchILMPInstance(b, params, N)
+		msg := make(chan []big.Int)
+		done := make(chan error)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			go func() {
+				done <- params.ILMPProve(x, y, msg)
+			}()
+			if ok, err := params.ILMPVerify(X, Y, msg); err != nil {
+				b.Fatal("verifier:", err)
+			} else if !ok {
+				b.Fatal("failed to verify")
+			}
+			if err := <-done; err != nil {
+				b.Fatal("prover:", err)
+			}
+		}
+	})
+}
+
+// benchMessageBytes returns the total length of the messages of an
+// interactive proof.
+func benchMessageBytes(msgs []Message) int {
+	n := 0
+	for _, m := range msgs {
+		for _, v := range m.Values {
+			n += len(v.Bytes())
+		}
+	}
+	return n
+}
+
+func BenchmarkShuffle0ProveVerify(b *testing.B) {
+	benchEachSize(b, benchProofSizes, func(b *testing.B, params *KeyParameters, N int) {
+		x, y, c, d, X, Y, C, D := testShuffle0Instance(b, params, N)
+
+		rec := NewRecorder()
+		go params.Shuffle0Prove(x, y, c, d, rec.Prover)
+		if ok, err := params.Shuffle0Verify(X, Y, C, D, rec.Verifier); !ok || err != nil {
+			b.Fatal("failed to verify:", err)
+		}
+		size := benchMessageBytes(rec.Close())
+
+		msg := make(chan []big.Int)
+		done := make(chan error)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			go func() {
+				done <- params.Shuffle0Prove(x, y, c, d, msg)
+			}()
+			if ok, err := params.Shuffle0Verify(X, Y, C, D, msg); err != nil {
+				b.Fatal("verifier:", err)
+			} else if !ok {
+				b.Fatal("failed to verify")
+			}
+			if err := <-done; err != nil {
+				b.Fatal("prover:", err)
+			}
+		}
+		b.ReportMetric(float64(size), "proof-bytes")
+	})
+}
+
+// BenchmarkShuffle0ProveVerifyScratch is like BenchmarkShuffle0ProveVerify,
+// except that the prover and verifier reuse their Scratch across runs.
+func BenchmarkShuffle0ProveVerifyScratch(b *testing.B) {
+	benchEachSize(b, benchProofSizes, func(b *testing.B, params *KeyParameters, N int) {
+		x, y, c, d, X, Y, C, D := testShuffle0Instance(b, params, N)
+		ps, vs := NewScratch(), NewScratch()
+		msg := make(chan []big.Int)
+		done := make(chan error)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			go func() {
+				done <- params.Shuffle0ProveScratch(x, y, c, d, msg, ps)
+			}()
+			if ok, err := params.Shuffle0VerifyScratch(X, Y, C, D, msg, vs); err != nil {
+				b.Fatal("verifier:", err)
+			} else if !ok {
+				b.Fatal("failed to verify")
+			}
+			if err := <-done; err != nil {
+				b.Fatal("prover:", err)
+			}
+		}
+	})
+}
+
+// benchGroupCiphertexts returns a key pair and exponential encryptions of N
+// messages, which are elements of <G> x <G> as re-encryption requires.
+func benchGroupCiphertexts(b *testing.B, params *KeyParameters, N int) (pk *PublicKey, R, C []*big.Int) {
+	pk, _ = params.GenerateKeys()
+	R = make([]*big.Int, N)
+	C = make([]*big.Int, N)
+	for i := range R {
+		var err error
+		if R[i], C[i], err = pk.EncryptExp(big.NewInt(int64(i))); err != nil {
+			b.Fatal("EncryptExp() fails:", err)
+		}
+	}
+	return
+}
+
+func BenchmarkReEncryptionShuffleProveVerify(b *testing.B) {
+	benchEachSize(b, benchProofSizes, func(b *testing.B, params *KeyParameters, N int) {
+		pk, R, C := benchGroupCiphertexts(b, params, N)
+		perm := testPerm(b, N)
+		R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+		if err != nil {
+			b.Fatal("ReEncryptionMix() fails:", err)
+		}
+		rounds := DefaultShuffleRounds
+		var msgs []Message
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			rec := NewRecorder()
+			go pk.ReEncryptionShuffleProve(R, C, R2, C2, perm, rands, rounds, rec.Prover)
+			if ok, err := pk.ReEncryptionShuffleVerify(R, C, R2, C2, rounds, rec.Verifier); !ok || err != nil {
+				b.Fatal("failed to verify:", err)
+			}
+			msgs = rec.Close()
+		}
+		b.ReportMetric(float64(benchMessageBytes(msgs)), "proof-bytes")
+	})
+}
+
+func BenchmarkBayerGrothProveVerify(b *testing.B) {
+	benchEachSize(b, benchProofSizes, func(b *testing.B, params *KeyParameters, N int) {
+		pk, R, C := benchGroupCiphertexts(b, params, N)
+		perm := testPerm(b, N)
+		R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+		if err != nil {
+			b.Fatal("ReEncryptionMix() fails:", err)
+		}
+		var proof *BayerGrothProof
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if proof, err = pk.BayerGrothProve(R, C, R2, C2, perm, rands, nil); err != nil {
+				b.Fatal("BayerGrothProve() fails:", err)
+			}
+			if !pk.BayerGrothVerify(R, C, R2, C2, proof, nil) {
+				b.Fatal("failed to verify")
+			}
+		}
+		elements, scalars := proof.Len()
+		size := elements*((params.P.BitLen()+7)/8) + scalars*((params.Q.BitLen()+7)/8)
+		b.ReportMetric(float64(size), "proof-bytes")
+	})
+}
+
+// The permutation commitment is computed before the timer starts, since it can
+// be precomputed offline.
+func BenchmarkTereliusWikstromProveVerify(b *testing.B) {
+	benchEachSize(b, benchProofSizes, func(b *testing.B, params *KeyParameters, N int) {
+		pk, R, C := benchGroupCiphertexts(b, params, N)
+		perm := testPerm(b, N)
+		U, r, err := params.CommitPermutation(perm)
+		if err != nil {
+			b.Fatal("CommitPermutation() fails:", err)
+		}
+		R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+		if err != nil {
+			b.Fatal("ReEncryptionMix() fails:", err)
+		}
+		var proof *TereliusWikstromProof
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if proof, err = pk.TereliusWikstromProve(U, perm, r, R, C, R2, C2, rands, nil); err != nil {
+				b.Fatal("TereliusWikstromProve() fails:", err)
+			}
+			if !pk.TereliusWikstromVerify(U, R, C, R2, C2, proof, nil) {
+				b.Fatal("failed to verify")
+			}
+		}
+		elements, scalars := proof.Len()
+		size := elements*((params.P.BitLen()+7)/8) + scalars*((params.Q.BitLen()+7)/8)
+		b.ReportMetric(float64(size), "proof-bytes")
+	})
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Cascade is a decryption mixnet composed of a chain of mix servers, each
+// holding its own key pair. Senders encrypt under the joint key Y_1 ... Y_k,
+// so that each server's key adds a layer to the ciphertext:
+//
+//	(R, C) = (G^r, M Y_1^r ... Y_k^r).
+//
+// The j-th server re-encrypts and shuffles the batch under the joint key of
+// the remaining servers Y_j ... Y_k, then peels its own layer by dividing each
+// C by R^{X_j}. It proves the shuffle with ReEncryptionShuffleProve and the
+// peeling with a batch proof of decryption. After the last server, the batch
+// consists of the plaintexts.
+//
+// The servers do not peel their layers with SecretKey.Mix. Peeling a layer
+// leaves R unchanged, so an output of Mix could be linked to its input by R,
+// and Mix gives no way to prove that its output is correct. Re-encrypting
+// under the joint key of the remaining servers re-randomizes R and makes the
+// shuffle provable; peeling is then a deterministic function of the shuffled
+// batch, proven with Chaum-Pedersen.
+type Cascade struct {
+	KeyParameters
+	Keys []*PublicKey
+
+	// Number of rounds of the shuffle proof (see DefaultShuffleRounds).
+	Rounds int
+
+	joint []*PublicKey // joint[j] is the joint key of servers j, ..., k-1.
+}
+
+// CascadeKeyContext returns the context that the j-th server of a cascade
+// (counting from 0) binds its proof of knowledge of its secret key to.
+func CascadeKeyContext(j int) []byte {
+	return []byte(fmt.Sprintf("cascade server %d", j))
+}
+
+// NewCascade returns a cascade of the servers with the given public keys. Each
+// server must prove that it knows its secret key (see SecretKey.ProveKnowledge
+// and CascadeKeyContext), since otherwise the last server to announce its key
+// could choose it so as to control the joint key.
+func NewCascade(keys []*PublicKey, proofs []*SchnorrProof) (*Cascade, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("cascade has no servers")
+	}
+	if len(proofs) != len(keys) {
+		return nil, errors.New("number of proofs does not match number of keys")
+	}
+	params := keys[0].KeyParameters
+	for j, pk := range keys {
+		if pk.P.Cmp(params.P) != 0 || pk.G.Cmp(params.G) != 0 || pk.Q.Cmp(params.Q) != 0 {
+			return nil, errors.New(fmt.Sprintf("key %d: parameters do not match", j))
+		}
+		if !pk.VerifyKnowledge(proofs[j], CascadeKeyContext(j)) {
+			return nil, errors.New(fmt.Sprintf("key %d: invalid proof of knowledge", j))
+		}
+	}
+
+	c := &Cascade{
+		KeyParameters: params,
+		Keys:          keys,
+		Rounds:        DefaultShuffleRounds,
+		joint:         make([]*PublicKey, len(keys)),
+	}
+	Y := new(big.Int).Set(params.one)
+	for j := len(keys) - 1; j >= 0; j-- {
+		Y.Mul(Y, keys[j].Y)
+		Y.Mod(Y, params.P)
+		c.joint[j] = &PublicKey{KeyParameters: params, Y: new(big.Int).Set(Y)}
+	}
+	return c, nil
+}
+
+// PublicKey returns the joint key under which senders encrypt their messages.
+func (c *Cascade) PublicKey() *PublicKey {
+	return c.joint[0]
+}
+
+// Encrypt encrypts a message for the cascade. M must be an element of <G>
+// (see GroupEncoder), since the servers re-encrypt the batch.
+func (c *Cascade) Encrypt(M *big.Int) (R, C *big.Int, err error) {
+	if !c.IsElement(M) {
+		return nil, nil, errors.New("M is not an element of <G>")
+	}
+	if R, C = c.joint[0].Encrypt(M); R == nil {
+		return nil, nil, errors.New("failed to sample randomness")
+	}
+	return R, C, nil
+}
+
+// Hop is the output a server of the cascade publishes: its re-encryption
+// shuffle (R, C) of its input batch and the result Peeled of removing its
+// layer from each C, together with a proof that Peeled is correct. The input
+// of the next server is (R, Peeled).
+type Hop struct {
+	R, C   []*big.Int
+	Peeled []*big.Int
+	Proof  *ChaumPedersenProof
+}
+
+// HopSecrets is the permutation and re-encryption randomness a server used in
+// a hop. The server needs them to prove the shuffle and must otherwise keep
+// them secret.
+type HopSecrets struct {
+	Perm  Permutation
+	Rands []*big.Int
+}
+
+// Mix runs the j-th server of the cascade on its input batch (R, C) with the
+// server's secret key and the specified permutation. Like ReEncryptionMix, it
+// returns a *CiphertextError if a component of a ciphertext is not an element
+// of <G>.
+func (c *Cascade) Mix(j int, sk *SecretKey, R, C []*big.Int, perm Permutation) (*Hop, *HopSecrets, error) {
+	if j < 0 || j >= len(c.Keys) {
+		return nil, nil, errors.New(fmt.Sprintf("no server %d", j))
+	}
+	if new(big.Int).Exp(sk.G, sk.X, sk.P).Cmp(c.Keys[j].Y) != 0 {
+		return nil, nil, errors.New(fmt.Sprintf("secret key does not belong to server %d", j))
+	}
+	R2, C2, rands, err := c.joint[j].ReEncryptionMix(R, C, perm)
+	if err != nil {
+		return nil, nil, err
+	}
+	peeled, proof, err := sk.DecryptBatchWithProof(R2, C2)
+	if err != nil {
+		return nil, nil, err
+	}
+	hop := &Hop{R: R2, C: C2, Peeled: peeled, Proof: proof}
+	return hop, &HopSecrets{Perm: perm, Rands: rands}, nil
+}
+
+// ProveHop implements the prover role of the j-th server in the interactive
+// proof that hop was computed correctly from the input batch (R, C). It uses
+// the same transport as ILMPProve.
+func (c *Cascade) ProveHop(j int, R, C []*big.Int, hop *Hop, secrets *HopSecrets, msg chan []big.Int) error {
+	if j < 0 || j >= len(c.Keys) {
+		msg <- nil
+		return errors.New(fmt.Sprintf("no server %d", j))
+	}
+	if hop == nil {
+		msg <- nil
+		return errors.New("no hop")
+	}
+	if secrets == nil {
+		msg <- nil
+		return errors.New("no hop secrets")
+	}
+	return c.joint[j].ReEncryptionShuffleProve(R, C, hop.R, hop.C,
+		secrets.Perm, secrets.Rands, c.Rounds, msg)
+}
+
+// VerifyHop implements the verifier role in the interactive proof that the
+// j-th server computed hop correctly from the input batch (R, C). It runs the
+// verifier of the shuffle proof, then checks the proof that the server peeled
+// its layer.
+func (c *Cascade) VerifyHop(j int, R, C []*big.Int, hop *Hop, msg chan []big.Int) (bool, error) {
+	if j < 0 || j >= len(c.Keys) {
+		msg <- nil
+		return false, errors.New(fmt.Sprintf("no server %d", j))
+	}
+	if hop == nil {
+		msg <- nil
+		return false, errors.New("no hop")
+	}
+	ok, err := c.joint[j].ReEncryptionShuffleVerify(R, C, hop.R, hop.C, c.Rounds, msg)
+	if !ok || err != nil {
+		return ok, err
+	}
+	return len(hop.Peeled) == len(hop.R) &&
+		c.Keys[j].VerifyDecryptionBatch(hop.R, hop.C, hop.Peeled, hop.Proof), nil
+}
+
+// HopError is returned by Run when a server's hop fails verification or the
+// server fails to produce one.
+type HopError struct {
+	Hop int
+	Err error
+}
+
+func (e *HopError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("hop %d: verification failed", e.Hop)
+	}
+	return fmt.Sprintf("hop %d: %v", e.Hop, e.Err)
+}
+
+// Run passes the batch (R, C) through every server of the cascade, given the
+// servers' secret keys in order, and outputs the plaintexts. Each server uses
+// a fresh random permutation. Each hop is verified before the next server
+// starts; if a hop fails, Run returns a *HopError identifying the server.
+func (c *Cascade) Run(sks []*SecretKey, R, C []*big.Int) ([]*big.Int, error) {
+	if len(sks) != len(c.Keys) {
+		return nil, errors.New("number of secret keys does not match number of servers")
+	}
+	for j, sk := range sks {
+		perm, err := GeneratePerm(len(R))
+		if err != nil {
+			return nil, &HopError{j, err}
+		}
+		hop, secrets, err := c.Mix(j, sk, R, C, perm)
+		if err != nil {
+			return nil, &HopError{j, err}
+		}
+
+		if err := c.runHop(j, R, C, hop, secrets); err != nil {
+			return nil, err
+		}
+		R, C = hop.R, hop.Peeled
+	}
+	return C, nil
+}
+
+// runHop runs the proof that the j-th server computed hop correctly from the
+// input batch (R, C). If it fails, runHop returns a *HopError, whose Err is
+// the prover's error if the prover aborted.
+func (c *Cascade) runHop(j int, R, C []*big.Int, hop *Hop, secrets *HopSecrets) error {
+	msg := make(chan []big.Int)
+	proved := make(chan error, 1)
+	go func() {
+		proved <- c.ProveHop(j, R, C, hop, secrets, msg)
+	}()
+	ok, err := c.VerifyHop(j, R, C, hop, msg)
+	if perr := <-proved; perr != nil {
+		return &HopError{j, errors.New(fmt.Sprintf("prover: %v", perr))}
+	}
+	if err != nil {
+		return &HopError{j, err}
+	} else if !ok {
+		return &HopError{j, nil}
+	}
+	return nil
+}
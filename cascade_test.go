@@ -0,0 +1,293 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testCascade returns a cascade of k servers and their secret keys.
+func testCascade(t *testing.T, params *KeyParameters, k int) (*Cascade, []*SecretKey) {
+	keys := make([]*PublicKey, k)
+	sks := make([]*SecretKey, k)
+	proofs := make([]*SchnorrProof, k)
+	for j := 0; j < k; j++ {
+		var err error
+		keys[j], sks[j] = params.GenerateKeys()
+		proofs[j], err = sks[j].ProveKnowledge(CascadeKeyContext(j))
+		if err != nil {
+			t.Fatal("ProveKnowledge() fails:", err)
+		}
+	}
+	c, err := NewCascade(keys, proofs)
+	if err != nil {
+		t.Fatal("NewCascade() fails:", err)
+	}
+	c.Rounds = testShuffleRounds
+	return c, sks
+}
+
+// testCascadeInputs returns the encryptions for the cascade of the messages
+// "1", ..., "N" as encoded by testGroupEncoder.
+func testCascadeInputs(t *testing.T, c *Cascade, N int) (R, C []*big.Int) {
+	enc := testGroupEncoder(t, &c.KeyParameters)
+	R = make([]*big.Int, N)
+	C = make([]*big.Int, N)
+	for i := 0; i < N; i++ {
+		M, err := enc.Encode([]byte(strconv.Itoa(i + 1)))
+		if err != nil {
+			t.Fatal("Encode() fails:", err)
+		}
+		if R[i], C[i], err = c.Encrypt(M); err != nil {
+			t.Fatal("Encrypt() fails:", err)
+		}
+	}
+	return
+}
+
+// Test that a cascade outputs a permutation of the plaintexts.
+func TestCascadeRun(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 5
+	c, sks := testCascade(t, params, 3)
+	R, C := testCascadeInputs(t, c, N)
+	enc := testGroupEncoder(t, params)
+
+	M, err := c.Run(sks, R, C)
+	if err != nil {
+		t.Fatal("Run() fails:", err)
+	}
+	if len(M) != N {
+		t.Fatalf("Run() output %d plaintexts, want %d", len(M), N)
+	}
+	got := make([]int, N)
+	for i := range M {
+		msg, err := enc.Decode(M[i])
+		if err != nil {
+			t.Fatal("Decode() fails:", err)
+		}
+		if got[i], err = strconv.Atoi(string(msg)); err != nil {
+			t.Fatalf("output %d is %q", i, msg)
+		}
+	}
+	sort.Ints(got)
+	for i := range got {
+		if got[i] != i+1 {
+			t.Fatal("Run() output is not a permutation of the inputs:", got)
+		}
+	}
+}
+
+// Test that a cascade with a single server decrypts.
+func TestCascadeSingle(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	c, sks := testCascade(t, params, 1)
+	R, C := testCascadeInputs(t, c, 1)
+
+	M, err := c.Run(sks, R, C)
+	if err != nil {
+		t.Fatal("Run() fails:", err)
+	}
+	if msg, err := testGroupEncoder(t, params).Decode(M[0]); err != nil || string(msg) != "1" {
+		t.Errorf("Run() output %q, %v", msg, err)
+	}
+}
+
+// Test that NewCascade rejects keys without a valid proof of knowledge.
+func TestNewCascadeRogueKey(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk0, sk0 := params.GenerateKeys()
+	pk1, sk1 := params.GenerateKeys()
+	proof0, _ := sk0.ProveKnowledge(CascadeKeyContext(0))
+	proof1, _ := sk1.ProveKnowledge(CascadeKeyContext(1))
+
+	if _, err := NewCascade([]*PublicKey{pk0, pk1}, []*SchnorrProof{proof0, proof1}); err != nil {
+		t.Fatal("NewCascade() fails:", err)
+	}
+	// Proofs bound to the wrong positions.
+	if _, err := NewCascade([]*PublicKey{pk1, pk0}, []*SchnorrProof{proof1, proof0}); err == nil {
+		t.Error("NewCascade() accepts proofs for the wrong positions")
+	}
+	// Server 1 replaces its key by G^a / Y_0 to control the joint key.
+	a, _ := params.Sample()
+	Y0Inv, _ := inverse(new(big.Int), pk0.Y, params.P)
+	rogue := &PublicKey{KeyParameters: *params, Y: new(big.Int).Exp(params.G, a, params.P)}
+	rogue.Y.Mul(rogue.Y, Y0Inv)
+	rogue.Y.Mod(rogue.Y, params.P)
+	if _, err := NewCascade([]*PublicKey{pk0, rogue}, []*SchnorrProof{proof0, proof1}); err == nil {
+		t.Error("NewCascade() accepts a rogue key")
+	}
+	if _, err := NewCascade(nil, nil); err == nil {
+		t.Error("NewCascade() accepts an empty cascade")
+	}
+}
+
+// Test that a hop computed with a permutation other than the proven one is
+// rejected.
+func TestCascadeBadShuffle(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 4
+	c, sks := testCascade(t, params, 2)
+	R, C := testCascadeInputs(t, c, N)
+
+	hop, secrets, err := c.Mix(0, sks[0], R, C, testPerm(t, N))
+	if err != nil {
+		t.Fatal("Mix() fails:", err)
+	}
+	// Replace one output by a fresh ciphertext and re-prove the peeling.
+	M, _ := testGroupEncoder(t, params).Encode([]byte("ev"))
+	hop.R[0], hop.C[0] = c.joint[1].Encrypt(M)
+	hop.Peeled, hop.Proof, err = sks[0].DecryptBatchWithProof(hop.R, hop.C)
+	if err != nil {
+		t.Fatal("DecryptBatchWithProof() fails:", err)
+	}
+
+	msg := make(chan []big.Int)
+	go c.ProveHop(0, R, C, hop, secrets, msg)
+	if ok, _ := c.VerifyHop(0, R, C, hop, msg); ok {
+		t.Error("VerifyHop() accepts a hop that replaced a ciphertext")
+	}
+}
+
+// Test that a hop whose peeling is incorrect is rejected.
+func TestCascadeBadPeel(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 4
+	c, sks := testCascade(t, params, 2)
+	R, C := testCascadeInputs(t, c, N)
+
+	hop, secrets, err := c.Mix(0, sks[0], R, C, testPerm(t, N))
+	if err != nil {
+		t.Fatal("Mix() fails:", err)
+	}
+	hop.Peeled[1] = new(big.Int).Mul(hop.Peeled[1], params.G)
+	hop.Peeled[1].Mod(hop.Peeled[1], params.P)
+
+	msg := make(chan []big.Int)
+	go c.ProveHop(0, R, C, hop, secrets, msg)
+	if ok, _ := c.VerifyHop(0, R, C, hop, msg); ok {
+		t.Error("VerifyHop() accepts an incorrect peeling")
+	}
+}
+
+// Test that Mix rejects a secret key that does not belong to the server.
+func TestCascadeWrongKey(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	c, sks := testCascade(t, params, 2)
+	R, C := testCascadeInputs(t, c, 2)
+
+	if _, _, err := c.Mix(0, sks[1], R, C, testPerm(t, 2)); err == nil {
+		t.Error("Mix() accepts the key of another server")
+	}
+	if _, err := c.Run([]*SecretKey{sks[1], sks[0]}, R, C); err == nil {
+		t.Error("Run() accepts keys in the wrong order")
+	} else if e, ok := err.(*HopError); !ok || e.Hop != 0 {
+		t.Errorf("Run() returns %v, want a *HopError for hop 0", err)
+	}
+}
+
+// Test that the cascade refuses messages and ciphertexts outside of <G>.
+func TestCascadeOutsideGroup(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 3
+	c, sks := testCascade(t, params, 2)
+	R, C := testCascadeInputs(t, c, N)
+
+	X, err := params.Encode([]byte("1"))
+	if err != nil {
+		t.Fatal("Encode() fails:", err)
+	}
+	if params.IsElement(X) {
+		t.Skip("Encode() output is in <G>")
+	}
+	if _, _, err := c.Encrypt(X); err == nil {
+		t.Error("Encrypt() accepts M not in <G>")
+	}
+
+	R[1], C[1] = c.PublicKey().Encrypt(X)
+	_, _, err = c.Mix(0, sks[0], R, C, testPerm(t, N))
+	if e, ok := err.(*CiphertextError); !ok || e.Index != 1 {
+		t.Errorf("Mix() returns %v, want a *CiphertextError for index 1", err)
+	}
+	if _, err := c.Run(sks, R, C); err == nil {
+		t.Error("Run() accepts a ciphertext not in <G>")
+	}
+}
+
+// Test that when the prover of a hop aborts, Run reports the prover's error.
+func TestCascadeProverError(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 3
+	c, sks := testCascade(t, params, 2)
+	R, C := testCascadeInputs(t, c, N)
+
+	hop, secrets, err := c.Mix(0, sks[0], R, C, testPerm(t, N))
+	if err != nil {
+		t.Fatal("Mix() fails:", err)
+	}
+	secrets.Rands = secrets.Rands[1:]
+	err = c.runHop(0, R, C, hop, secrets)
+	if e, ok := err.(*HopError); !ok || e.Hop != 0 || e.Err == nil ||
+		!strings.HasPrefix(e.Err.Error(), "prover: ") {
+		t.Errorf("runHop() returns %v, want a *HopError with the prover's error", err)
+	}
+}
+
+// Test that the prover refuses a missing hop rather than panicking.
+func TestCascadeProveNoHop(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 3
+	c, sks := testCascade(t, params, 2)
+	R, C := testCascadeInputs(t, c, N)
+	hop, secrets, err := c.Mix(0, sks[0], R, C, testPerm(t, N))
+	if err != nil {
+		t.Fatal("Mix() fails:", err)
+	}
+
+	for _, tc := range []struct {
+		hop     *Hop
+		secrets *HopSecrets
+	}{{nil, secrets}, {hop, nil}} {
+		msg := make(chan []big.Int)
+		done := make(chan error)
+		go func() {
+			done <- c.ProveHop(0, R, C, tc.hop, tc.secrets, msg)
+		}()
+		if m := <-msg; m != nil {
+			t.Error("prover sends a message: expected nil")
+		}
+		if err := <-done; err == nil {
+			t.Error("prover succeeds: expected error")
+		}
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"math/big"
+)
+
+// transcriptHash accumulates the inputs to a Fiat-Shamir challenge. Each input
+// is prefixed with its length so that distinct sequences of inputs never hash
+// the same.
+type transcriptHash struct {
+	h hash.Hash
+}
+
+// newTranscriptHash starts a hash for the given domain, which should name the
+// protocol and its role (e.g., "schnorr"). The public parameters are always
+// included.
+func (params *KeyParameters) newTranscriptHash(domain string) *transcriptHash {
+	th := &transcriptHash{h: sha256.New()}
+	th.writeBytes([]byte("github.com/cjpatton/shuffle"))
+	th.writeBytes([]byte(domain))
+	th.writeInts(params.P, params.G, params.Q)
+	return th
+}
+
+func (th *transcriptHash) writeBytes(b []byte) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(b)))
+	th.h.Write(n[:])
+	th.h.Write(b)
+}
+
+func (th *transcriptHash) writeInts(vals ...*big.Int) {
+	for _, v := range vals {
+		th.writeBytes(v.Bytes())
+	}
+}
+
+// challenge outputs the challenge, an element of Z/q.
+func (th *transcriptHash) challenge(params *KeyParameters) *big.Int {
+	return th.reduce(params.Q)
+}
+
+// reduce outputs an element of Z/m derived from the digest. The digest is
+// expanded to 128 bits more than the length of m before it is reduced, so that
+// the output is close to uniform.
+func (th *transcriptHash) reduce(m *big.Int) *big.Int {
+	seed := th.h.Sum(nil)
+	n := (m.BitLen()+7)/8 + 16
+	out := make([]byte, 0, n+sha256.Size)
+	for ctr := uint32(0); len(out) < n; ctr++ {
+		h := sha256.New()
+		var c [4]byte
+		binary.BigEndian.PutUint32(c[:], ctr)
+		h.Write(c[:])
+		h.Write(seed)
+		out = h.Sum(out)
+	}
+	e := new(big.Int).SetBytes(out[:n])
+	return e.Mod(e, m)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// Test that Fiat-Shamir challenges are in Z/q and depend on every input.
+func TestChallenge(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+
+	challenge := func(domain string, parts ...[]byte) *big.Int {
+		th := params.newTranscriptHash(domain)
+		for _, p := range parts {
+			th.writeBytes(p)
+		}
+		return th.challenge(params)
+	}
+
+	c := challenge("test", []byte("ab"), []byte("c"))
+	if c.Sign() < 0 || c.Cmp(params.Q) >= 0 {
+		t.Error("challenge is not in Z/q")
+	}
+	if c.Cmp(challenge("test", []byte("ab"), []byte("c"))) != 0 {
+		t.Error("challenge is not deterministic")
+	}
+	for i, other := range []*big.Int{
+		challenge("test2", []byte("ab"), []byte("c")),
+		challenge("test", []byte("a"), []byte("bc")),
+		challenge("test", []byte("abc")),
+		challenge("test", []byte("ab"), []byte("c"), nil),
+	} {
+		if c.Cmp(other) == 0 {
+			t.Errorf("%d: distinct inputs give the same challenge", i)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ChaumPedersenProof is a non-interactive proof that log_G Y = log_H Z for
+// elements Y, H, and Z of <G> [Chaum and Pedersen, CRYPTO 1992]. A and B are
+// the prover's commitments G^k and H^k and S is its response k + cx, where c
+// is the Fiat-Shamir challenge.
+type ChaumPedersenProof struct {
+	A, B, S *big.Int
+}
+
+// chaumPedersenChallenge derives the challenge for a proof that log_G Y =
+// log_H Z with commitments A and B.
+func (params *KeyParameters) chaumPedersenChallenge(Y, H, Z, A, B *big.Int, context []byte) *big.Int {
+	th := params.newTranscriptHash("chaum-pedersen")
+	th.writeInts(Y, H, Z, A, B)
+	th.writeBytes(context)
+	return th.challenge(params)
+}
+
+// ChaumPedersenProve outputs a proof that log_G G^x = log_H H^x. The proof is
+// bound to context.
+func (params *KeyParameters) ChaumPedersenProve(x, H *big.Int, context []byte) (*ChaumPedersenProof, error) {
+	if !params.IsElement(H) {
+		return nil, errors.New("H is not an element of <G>")
+	}
+	k, err := params.Sample()
+	if err != nil {
+		return nil, err
+	}
+	Y := new(big.Int).Exp(params.G, x, params.P)
+	Z := new(big.Int).Exp(H, x, params.P)
+	proof := new(ChaumPedersenProof)
+	proof.A = new(big.Int).Exp(params.G, k, params.P)
+	proof.B = new(big.Int).Exp(H, k, params.P)
+	c := params.chaumPedersenChallenge(Y, H, Z, proof.A, proof.B, context)
+	proof.S = c.Mul(c, x)
+	proof.S.Add(proof.S, k)
+	proof.S.Mod(proof.S, params.Q)
+	return proof, nil
+}
+
+// ChaumPedersenVerify verifies a proof that log_G Y = log_H Z bound to
+// context. It checks that G^S = A Y^c and H^S = B Z^c, that each of Y, H, and
+// Z is an element of <G>, and that S is in Z/q, so that the proof is not
+// malleable.
+func (params *KeyParameters) ChaumPedersenVerify(Y, H, Z *big.Int, proof *ChaumPedersenProof, context []byte) bool {
+	if proof == nil || proof.A == nil || proof.B == nil || !params.areScalars(proof.S) {
+		return false
+	}
+	for _, e := range []*big.Int{Y, H, Z, proof.A, proof.B} {
+		if !params.IsElement(e) {
+			return false
+		}
+	}
+	c := params.chaumPedersenChallenge(Y, H, Z, proof.A, proof.B, context)
+	var L, R big.Int
+	L.Exp(params.G, proof.S, params.P)
+	R.Exp(Y, c, params.P)
+	R.Mul(&R, proof.A)
+	R.Mod(&R, params.P)
+	if L.Cmp(&R) != 0 {
+		return false
+	}
+	L.Exp(H, proof.S, params.P)
+	R.Exp(Z, c, params.P)
+	R.Mul(&R, proof.B)
+	R.Mod(&R, params.P)
+	return L.Cmp(&R) == 0
+}
+
+// sharedSecret recovers the shared secret S = C / M of a ciphertext (R, C)
+// that decrypts to M. M must be in range, i.e., 0 < M < P; otherwise M + kP
+// would pass for M.
+func (params *KeyParameters) sharedSecret(C, M *big.Int) (*big.Int, error) {
+	if M == nil || C == nil {
+		return nil, errors.New("missing value")
+	}
+	if M.Sign() <= 0 || M.Cmp(params.P) >= 0 {
+		return nil, errors.New("M is out of range")
+	}
+	S, err := inverse(new(big.Int), M, params.P)
+	if err != nil {
+		return nil, err
+	}
+	S.Mul(S, C)
+	return S.Mod(S, params.P), nil
+}
+
+// DecryptWithProof decrypts the ciphertext (R, C) and outputs a proof that
+// the plaintext M is correct, i.e., that log_G Y = log_R (C / M), where Y is
+// the public key. The proof can be checked with VerifyDecryption by anyone
+// holding the public key.
+func (sk *SecretKey) DecryptWithProof(R, C *big.Int) (M *big.Int, proof *ChaumPedersenProof, err error) {
+	if !sk.IsElement(R) {
+		return nil, nil, errors.New("R is not an element of <G>")
+	}
+	M = sk.Decrypt(R, C)
+	if proof, err = sk.ChaumPedersenProve(sk.X, R, decryptionContext(C)); err != nil {
+		return nil, nil, err
+	}
+	return M, proof, nil
+}
+
+// decryptionContext binds a proof of decryption to the C component of the
+// ciphertext.
+func decryptionContext(C *big.Int) []byte {
+	return append([]byte("decrypt:"), C.Bytes()...)
+}
+
+// VerifyDecryption verifies a proof output by DecryptWithProof that M is the
+// decryption of (R, C).
+func (pk *PublicKey) VerifyDecryption(R, C, M *big.Int, proof *ChaumPedersenProof) bool {
+	S, err := pk.sharedSecret(C, M)
+	if err != nil {
+		return false
+	}
+	return pk.ChaumPedersenVerify(pk.Y, R, S, proof, decryptionContext(C))
+}
+
+// batchWeights derives the weights for the random linear combination used by
+// the batch proof of decryption. Each weight depends on the public key and on
+// every ciphertext and plaintext in the batch.
+func (params *KeyParameters) batchWeights(Y *big.Int, R, C, M []*big.Int) (seed []byte, e []*big.Int) {
+	th := params.newTranscriptHash("decryption batch")
+	th.writeInts(Y)
+	th.writeInts(R...)
+	th.writeInts(C...)
+	th.writeInts(M...)
+	seed = th.h.Sum(nil)
+
+	e = make([]*big.Int, len(R))
+	for i := range e {
+		th := params.newTranscriptHash("decryption batch weight")
+		th.writeBytes(seed)
+		th.writeInts(big.NewInt(int64(i)))
+		e[i] = th.challenge(params)
+	}
+	return seed, e
+}
+
+// batchCombine computes the products of R[i]^e[i] and S[i]^e[i].
+func (params *KeyParameters) batchCombine(R, S, e []*big.Int) (Rstar, Sstar *big.Int) {
+	Rstar = new(big.Int).Set(params.one)
+	Sstar = new(big.Int).Set(params.one)
+	var t big.Int
+	for i := range e {
+		t.Exp(R[i], e[i], params.P)
+		Rstar.Mul(Rstar, &t)
+		Rstar.Mod(Rstar, params.P)
+		t.Exp(S[i], e[i], params.P)
+		Sstar.Mul(Sstar, &t)
+		Sstar.Mod(Sstar, params.P)
+	}
+	return
+}
+
+// DecryptBatchWithProof decrypts a batch of ciphertexts {(R[i], C[i])}, such
+// as the output of a mix, and outputs a single proof that every plaintext is
+// correct. The proof shows that log_G Y = log_{R*} S*, where R* and S* are
+// random linear combinations (in the exponent) of the R[i] and the shared
+// secrets C[i] / M[i]. The weights are derived from the whole batch, so a
+// single wrong plaintext invalidates the proof except with negligible
+// probability.
+//
+// Note that the proof links each plaintext to its ciphertext; it hides nothing
+// about the correspondence between the ciphertexts and plaintexts.
+func (sk *SecretKey) DecryptBatchWithProof(R, C []*big.Int) (M []*big.Int, proof *ChaumPedersenProof, err error) {
+	if len(R) != len(C) {
+		return nil, nil, errors.New(fmt.Sprintf(
+			"sequence length mismatch: |R|=%d, |C|=%d", len(R), len(C)))
+	}
+	M = make([]*big.Int, len(R))
+	S := make([]*big.Int, len(R))
+	for i := range R {
+		if !sk.IsElement(R[i]) {
+			return nil, nil, errors.New(fmt.Sprintf("R[%d] is not an element of <G>", i))
+		}
+		S[i] = new(big.Int).Exp(R[i], sk.X, sk.P)
+		M[i] = sk.Decrypt(R[i], C[i])
+	}
+	Y := new(big.Int).Exp(sk.G, sk.X, sk.P)
+	seed, e := sk.batchWeights(Y, R, C, M)
+	Rstar, _ := sk.batchCombine(R, S, e)
+	if proof, err = sk.ChaumPedersenProve(sk.X, Rstar, seed); err != nil {
+		return nil, nil, err
+	}
+	return M, proof, nil
+}
+
+// VerifyDecryptionBatch verifies a proof output by DecryptBatchWithProof that
+// M[i] is the decryption of (R[i], C[i]) for each i.
+func (pk *PublicKey) VerifyDecryptionBatch(R, C, M []*big.Int, proof *ChaumPedersenProof) bool {
+	if len(R) != len(C) || len(R) != len(M) {
+		return false
+	}
+	S := make([]*big.Int, len(R))
+	for i := range R {
+		var err error
+		if R[i] == nil || !pk.IsElement(R[i]) {
+			return false
+		}
+		if S[i], err = pk.sharedSecret(C[i], M[i]); err != nil {
+			return false
+		}
+		// Each shared secret must be in <G>, or else a component of small
+		// order could cancel out in the linear combination.
+		if !pk.IsElement(S[i]) {
+			return false
+		}
+	}
+	seed, e := pk.batchWeights(pk.Y, R, C, M)
+	Rstar, Sstar := pk.batchCombine(R, S, e)
+	return pk.ChaumPedersenVerify(pk.Y, Rstar, Sstar, proof, seed)
+}
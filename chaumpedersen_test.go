@@ -0,0 +1,170 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"fmt"
+	"math/big"
+	"testing"
+)
+
+// Test the proof of equality of discrete logs.
+func TestChaumPedersen(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	x, _ := params.Sample()
+	H := testRandomElements(params, 1)[0]
+	Y := new(big.Int).Exp(params.G, x, params.P)
+	Z := new(big.Int).Exp(&H, x, params.P)
+
+	proof, err := params.ChaumPedersenProve(x, &H, []byte("test"))
+	if err != nil {
+		t.Fatal("ChaumPedersenProve() fails:", err)
+	}
+	if !params.ChaumPedersenVerify(Y, &H, Z, proof, []byte("test")) {
+		t.Error("failed to verify")
+	}
+	if params.ChaumPedersenVerify(Y, &H, Z, proof, []byte("other")) {
+		t.Error("proof accepted for the wrong context")
+	}
+	Z.Mul(Z, params.G).Mod(Z, params.P)
+	if params.ChaumPedersenVerify(Y, &H, Z, proof, []byte("test")) {
+		t.Error("proof accepted for unequal logs")
+	}
+	if _, err := params.ChaumPedersenProve(x, params.P, nil); err == nil {
+		t.Error("ChaumPedersenProve() succeeds for H not in <G>: expected error")
+	}
+}
+
+// Test decryption with a proof of correctness.
+func TestDecryptWithProof(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+
+	X, _ := params.Encode([]byte("hello, world!"))
+	R, C := pk.Encrypt(X)
+	M, proof, err := sk.DecryptWithProof(R, C)
+	if err != nil {
+		t.Fatal("DecryptWithProof() fails:", err)
+	}
+	if M.Cmp(X) != 0 {
+		t.Fatal("DecryptWithProof() outputs the wrong plaintext")
+	}
+	if !pk.VerifyDecryption(R, C, M, proof) {
+		t.Error("failed to verify")
+	}
+
+	// Wrong plaintext.
+	M1, _ := params.Encode([]byte("hello, world?"))
+	if pk.VerifyDecryption(R, C, M1, proof) {
+		t.Error("proof accepted for the wrong plaintext")
+	}
+
+	// Wrong ciphertext.
+	R1, C1 := pk.Encrypt(X)
+	if pk.VerifyDecryption(R1, C1, M, proof) {
+		t.Error("proof accepted for the wrong ciphertext")
+	}
+
+	// Wrong key.
+	pk1, _ := params.GenerateKeys()
+	if pk1.VerifyDecryption(R, C, M, proof) {
+		t.Error("proof accepted for the wrong key")
+	}
+
+	if pk.VerifyDecryption(R, C, new(big.Int), proof) {
+		t.Error("proof accepted for M = 0")
+	}
+
+	// M + P is congruent to M, but not a valid plaintext.
+	if pk.VerifyDecryption(R, C, new(big.Int).Add(M, params.P), proof) {
+		t.Error("proof accepted for M + P")
+	}
+}
+
+// Test decrypting the output of Mix with a batch proof.
+func TestDecryptBatchWithProof(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+
+	for _, N := range []int{0, 1, 10} {
+		R := make([]*big.Int, N)
+		C := make([]*big.Int, N)
+		for i := 0; i < N; i++ {
+			X, _ := params.Encode([]byte(fmt.Sprint(i)))
+			R[i], C[i] = pk.Encrypt(X)
+		}
+
+		M, proof, err := sk.DecryptBatchWithProof(R, C)
+		if err != nil {
+			t.Fatalf("%d: DecryptBatchWithProof() fails: %s", N, err)
+		}
+		for i := 0; i < N; i++ {
+			if msg, err := params.Decode(M[i]); err != nil || string(msg) != fmt.Sprint(i) {
+				t.Errorf("%d: M[%d] decodes to %q, %v", N, i, msg, err)
+			}
+		}
+		if !pk.VerifyDecryptionBatch(R, C, M, proof) {
+			t.Errorf("%d: failed to verify", N)
+		}
+		if N < 2 {
+			continue
+		}
+
+		// Swap two plaintexts.
+		M[0], M[1] = M[1], M[0]
+		if pk.VerifyDecryptionBatch(R, C, M, proof) {
+			t.Errorf("%d: proof accepted for swapped plaintexts", N)
+		}
+		M[0], M[1] = M[1], M[0]
+
+		// Compensating changes that preserve the product of the plaintexts.
+		M0, M1 := M[0], M[1]
+		M[0] = new(big.Int).Mul(M0, params.G)
+		M[0].Mod(M[0], params.P)
+		Ginv := new(big.Int).ModInverse(params.G, params.P)
+		M[1] = new(big.Int).Mul(M1, Ginv)
+		M[1].Mod(M[1], params.P)
+		if pk.VerifyDecryptionBatch(R, C, M, proof) {
+			t.Errorf("%d: proof accepted for compensating changes", N)
+		}
+		M[0], M[1] = M0, M1
+
+		// Plaintext out of range.
+		M[0] = new(big.Int).Add(M0, params.P)
+		if pk.VerifyDecryptionBatch(R, C, M, proof) {
+			t.Errorf("%d: proof accepted for M[0] + P", N)
+		}
+		M[0] = M0
+
+		// Wrong length.
+		if pk.VerifyDecryptionBatch(R, C, M[1:], proof) {
+			t.Errorf("%d: proof accepted for truncated plaintexts", N)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+// Command benchreport turns the output of "go test -bench" into a table that
+// can be compared across releases. Each input file is a column of the table;
+// if there are two or more, the last column gives the change from the first
+// input to the last. With no files, benchreport reads standard input.
+//
+//	go test -bench . -benchmem > v1.txt
+//	...
+//	go test -bench . -benchmem > v2.txt
+//	benchreport -metric ns/op v1.txt v2.txt
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Result stores the measurements parsed from a benchmark run. It maps the name
+// of each benchmark to the mean value of each metric reported for it.
+type Result struct {
+	Names  []string // Benchmark names in the order they first appear
+	Values map[string]map[string]float64
+
+	counts map[string]map[string]int
+}
+
+// procsSuffix matches the GOMAXPROCS suffix "go test" appends to benchmark
+// names.
+var procsSuffix = regexp.MustCompile(`-[0-9]+$`)
+
+// Parse reads the output of "go test -bench". Lines that are not benchmark
+// results are ignored. If a benchmark is reported more than once (as with
+// -count), the values are averaged.
+func Parse(r io.Reader) (*Result, error) {
+	res := &Result{
+		Values: make(map[string]map[string]float64),
+		counts: make(map[string]map[string]int),
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		// The name is followed by the number of iterations.
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		name := procsSuffix.ReplaceAllString(fields[0], "")
+		if (len(fields)-2)%2 != 0 {
+			return nil, errors.New(fmt.Sprintf("malformed line for %s", name))
+		}
+		if res.Values[name] == nil {
+			res.Names = append(res.Names, name)
+			res.Values[name] = make(map[string]float64)
+			res.counts[name] = make(map[string]int)
+		}
+		for i := 2; i < len(fields); i += 2 {
+			val, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("%s: %v", name, err))
+			}
+			unit := fields[i+1]
+			n := res.counts[name][unit]
+			res.Values[name][unit] = (res.Values[name][unit]*float64(n) + val) / float64(n+1)
+			res.counts[name][unit] = n + 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Table formats the metric of each benchmark as a Markdown table with one
+// column per result. The column headers are given by labels.
+func Table(w io.Writer, metric string, labels []string, results []*Result) {
+	var names []string
+	seen := make(map[string]bool)
+	for _, res := range results {
+		for _, name := range res.Names {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+
+	header := append([]string{"Benchmark"}, labels...)
+	if len(results) > 1 {
+		header = append(header, "delta")
+	}
+	fmt.Fprintf(w, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(w, "|%s\n", strings.Repeat(" --- |", len(header)))
+
+	for _, name := range names {
+		row := []string{strings.TrimPrefix(name, "Benchmark")}
+		for _, res := range results {
+			if val, ok := res.Values[name][metric]; ok {
+				row = append(row, formatValue(val))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		if len(results) > 1 {
+			first, ok1 := results[0].Values[name][metric]
+			last, ok2 := results[len(results)-1].Values[name][metric]
+			if ok1 && ok2 && first != 0 {
+				row = append(row, fmt.Sprintf("%+.1f%%", 100*(last-first)/first))
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintf(w, "| %s |\n", strings.Join(row, " | "))
+	}
+}
+
+// formatValue formats a measurement with at most three decimal places.
+func formatValue(val float64) string {
+	if val == float64(int64(val)) {
+		return strconv.FormatInt(int64(val), 10)
+	}
+	return strconv.FormatFloat(val, 'f', 3, 64)
+}
+
+func main() {
+	metric := flag.String("metric", "ns/op", "the metric to tabulate (e.g. ns/op, B/op, allocs/op)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-metric unit] [file ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var labels []string
+	var results []*Result
+	if flag.NArg() == 0 {
+		res, err := Parse(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "stdin:", err)
+			os.Exit(1)
+		}
+		labels = append(labels, *metric)
+		results = append(results, res)
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		res, err := Parse(f)
+		f.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			os.Exit(1)
+		}
+		labels = append(labels, path)
+		results = append(results, res)
+	}
+
+	Table(os.Stdout, *metric, labels, results)
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testOld = `goos: linux
+goarch: amd64
+BenchmarkMix/2048/N=10-8    	     200	   5575758 ns/op	  127440 B/op	     251 allocs/op
+BenchmarkMix/2048/N=10-8    	     200	   5575760 ns/op	  127440 B/op	     251 allocs/op
+BenchmarkEncode/2048-8      	  100000	      7094 ns/op	  35.52 MB/s	     832 B/op	       4 allocs/op
+PASS
+ok  	github.com/cjpatton/shuffle	16.544s
+`
+
+const testNew = `BenchmarkMix/2048/N=10-8    	     200	   2787880 ns/op	  127440 B/op	     251 allocs/op
+BenchmarkDecode/2048-8      	 1000000	       875 ns/op	 288.00 MB/s	     512 B/op	       2 allocs/op
+`
+
+// Test parsing benchmark output.
+func TestParse(t *testing.T) {
+	res, err := Parse(strings.NewReader(testOld))
+	if err != nil {
+		t.Fatal("Parse() fails:", err)
+	}
+	if len(res.Names) != 2 {
+		t.Fatalf("got %d benchmarks, expected 2", len(res.Names))
+	}
+	if res.Names[0] != "BenchmarkMix/2048/N=10" {
+		t.Errorf("got name %q, expected BenchmarkMix/2048/N=10", res.Names[0])
+	}
+	if got := res.Values["BenchmarkMix/2048/N=10"]["ns/op"]; got != 5575759 {
+		t.Errorf("got mean %v ns/op, expected 5575759", got)
+	}
+	if got := res.Values["BenchmarkEncode/2048"]["MB/s"]; got != 35.52 {
+		t.Errorf("got %v MB/s, expected 35.52", got)
+	}
+}
+
+// Test tabulating two sets of results.
+func TestTable(t *testing.T) {
+	old, _ := Parse(strings.NewReader(testOld))
+	cur, _ := Parse(strings.NewReader(testNew))
+	var buf bytes.Buffer
+	Table(&buf, "ns/op", []string{"old", "new"}, []*Result{old, cur})
+	expected := `| Benchmark | old | new | delta |
+| --- | --- | --- | --- |
+| Mix/2048/N=10 | 5575759 | 2787880 | -50.0% |
+| Encode/2048 | 7094 | - | - |
+| Decode/2048 | - | 875 | - |
+`
+	if buf.String() != expected {
+		t.Errorf("got table\n%s\nexpected\n%s", buf.String(), expected)
+	}
+}
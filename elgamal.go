@@ -29,7 +29,10 @@
 package shuffle
 
 import (
+	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
 	"errors"
 	"math/big"
 )
@@ -45,9 +48,21 @@ type KeyParameters struct {
 }
 
 // MaxMsgBytes returns the maximum number of message that may be encrypted
-// under the modulus P.
+// under the modulus P. This is encodingOverhead bytes less than the encoding
+// of a group element, e.g., 246 bytes for a 2048-bit P. It is negative if P is
+// too small to encode any message.
 func (params *KeyParameters) MaxMsgBytes() int {
-	return (params.P.BitLen() / 8) - 4
+	return params.encodedBytes() - encodingOverhead
+}
+
+// encodingOverhead is the number of bytes Encode adds to a message: the marker
+// byte, the 4-byte length and the 4-byte checksum.
+const encodingOverhead = 9
+
+// encodedBytes returns the length in bytes of the output of Encode, which is
+// chosen so that every encoding is less than P.
+func (params *KeyParameters) encodedBytes() int {
+	return params.P.BitLen()/8 - 1
 }
 
 // NewKeyParametersFromStrings creates a KeyParamters object from strings
@@ -154,33 +169,64 @@ func (sk *SecretKey) Decrypt(R, C *big.Int) (M *big.Int) {
 	return
 }
 
+// encodingChecksum outputs the first 4 bytes of the SHA-256 hash of b.
+func encodingChecksum(b []byte) []byte {
+	h := sha256.Sum256(b)
+	return h[:4]
+}
+
 // Encode takes as input a slice of bytes and outputs the corresponding
-// element of Z/p.
+// element of Z/p. The element is the integer with big-endian encoding
+//
+//	0xFF || len(msg) || msg || 0x00 ... 0x00 || checksum
+//
+// of length encodedBytes(), where len(msg) is 4 bytes long and checksum is the
+// first 4 bytes of the SHA-256 hash of everything before it.
 func (params *KeyParameters) Encode(msg []byte) (*big.Int, error) {
-	M := new(big.Int)
-	maxMsgBytes := params.MaxMsgBytes()
-	if len(msg) > maxMsgBytes {
+	if params.MaxMsgBytes() < 0 {
+		return nil, errors.New("modulus is too small to encode a message")
+	}
+	if len(msg) > params.MaxMsgBytes() {
 		return nil, errors.New("message too big")
 	}
-	paddedMsg := make([]byte, maxMsgBytes+2)
-	paddedMsg[0] = 0xFF
-	bytes := copy(paddedMsg[1:], msg)
-	paddedMsg[bytes+1] = 0xFF
-	M.SetBytes(paddedMsg)
-	return M, nil
+	n := params.encodedBytes()
+	framed := make([]byte, n)
+	framed[0] = 0xFF
+	binary.BigEndian.PutUint32(framed[1:5], uint32(len(msg)))
+	copy(framed[5:], msg)
+	copy(framed[n-4:], encodingChecksum(framed[:n-4]))
+	return new(big.Int).SetBytes(framed), nil
 }
 
 // Decode takes as input an element of Z/p and outputs the corresponding
-// message.
+// message. It returns an error unless M is the output of Encode for some
+// message, which for a random element of Z/p happens with probability about
+// 2^-32.
 func (params *KeyParameters) Decode(M *big.Int) ([]byte, error) {
-	paddedMsg := M.Bytes()
-	i := len(paddedMsg) - 1
-	for ; i >= 0; i-- {
-		if paddedMsg[i] != 0x00 {
-			break
+	if params.MaxMsgBytes() < 0 {
+		return nil, errors.New("modulus is too small to encode a message")
+	}
+	n := params.encodedBytes()
+	if M == nil || M.Sign() < 0 || M.BitLen() > 8*n {
+		return nil, errors.New("malformed encoding: out of range")
+	}
+	framed := M.FillBytes(make([]byte, n))
+	if framed[0] != 0xFF {
+		return nil, errors.New("malformed encoding: missing marker")
+	}
+	if !bytes.Equal(framed[n-4:], encodingChecksum(framed[:n-4])) {
+		return nil, errors.New("malformed encoding: checksum mismatch")
+	}
+	l := binary.BigEndian.Uint32(framed[1:5])
+	if uint64(l) > uint64(params.MaxMsgBytes()) {
+		return nil, errors.New("malformed encoding: length out of range")
+	}
+	for _, b := range framed[5+l : n-4] {
+		if b != 0x00 {
+			return nil, errors.New("malformed encoding: non-zero padding")
 		}
 	}
-	msg := make([]byte, i-1)
-	copy(msg, paddedMsg[1:])
+	msg := make([]byte, l)
+	copy(msg, framed[5:])
 	return msg, nil
 }
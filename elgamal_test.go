@@ -30,6 +30,7 @@ package shuffle
 
 import (
 	"bytes"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"math/big"
@@ -176,3 +177,87 @@ func testEncodeDecode(msg []byte, params *KeyParameters) error {
 	}
 	return nil
 }
+
+// Test that random messages of every length round-trip, including messages
+// with leading or trailing zeros or 0xFF bytes, for each parameter set.
+func TestEncodeDecodeRandom(t *testing.T) {
+	for _, set := range benchParams {
+		params := NewKeyParametersFromStrings(set.p, set.g, set.q)
+		for n := 0; n <= params.MaxMsgBytes(); n++ {
+			msg := make([]byte, n)
+			if _, err := rand.Read(msg); err != nil {
+				t.Fatal("rand.Read() fails:", err)
+			}
+			if err := testEncodeDecode(msg, params); err != nil {
+				t.Errorf("%s: n=%d: %s", set.name, n, err)
+			}
+			if n > 0 {
+				msg[0], msg[n-1] = 0x00, 0x00
+				if err := testEncodeDecode(msg, params); err != nil {
+					t.Errorf("%s: n=%d, zero ends: %s", set.name, n, err)
+				}
+				msg[0], msg[n-1] = 0xFF, 0xFF
+				if err := testEncodeDecode(msg, params); err != nil {
+					t.Errorf("%s: n=%d, 0xFF ends: %s", set.name, n, err)
+				}
+			}
+		}
+	}
+}
+
+// Test that Decode rejects elements that are not encodings, including
+// encodings with a flipped bit, instead of misdecoding or panicking.
+func TestDecodeMalformed(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	for _, M := range []*big.Int{
+		nil,
+		big.NewInt(-1),
+		big.NewInt(0),
+		big.NewInt(1),
+		big.NewInt(0xFF),
+		new(big.Int).Sub(params.P, params.one),
+		params.P,
+		new(big.Int).Lsh(params.one, uint(8*params.encodedBytes()-1)),
+	} {
+		if msg, err := params.Decode(M); err == nil {
+			t.Errorf("Decode(%v) = %q, expected error", M, msg)
+		}
+	}
+
+	M, err := params.Encode([]byte("hello, world!"))
+	if err != nil {
+		t.Fatal("Encode() fails:", err)
+	}
+	for i := 0; i < M.BitLen(); i++ {
+		M2 := new(big.Int).SetBit(M, i, M.Bit(i)^1)
+		if msg, err := params.Decode(M2); err == nil {
+			t.Errorf("Decode() accepts the encoding with bit %d flipped: %q", i, msg)
+		}
+	}
+
+	// A random element is an encoding with probability about 2^-32.
+	for i := 0; i < 100; i++ {
+		M, err := rand.Int(rand.Reader, params.P)
+		if err != nil {
+			t.Fatal("rand.Int() fails:", err)
+		}
+		if msg, err := params.Decode(M); err == nil {
+			t.Errorf("Decode(%v) = %q, expected error", M, msg)
+		}
+	}
+}
+
+// Test that Encode and Decode return an error, rather than panicking, if P is
+// too small to encode a message.
+func TestEncodeSmallModulus(t *testing.T) {
+	params := NewKeyParametersFromStrings("17", "2", "B")
+	if params.MaxMsgBytes() >= 0 {
+		t.Fatalf("MaxMsgBytes() = %d, expected a negative value", params.MaxMsgBytes())
+	}
+	if _, err := params.Encode(nil); err == nil {
+		t.Error("Encode() succeeds: expected error")
+	}
+	if _, err := params.Decode(big.NewInt(5)); err == nil {
+		t.Error("Decode() succeeds: expected error")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// This file implements exponential ElGamal, in which a message m in Z/q is
+// encrypted as G^m. Ciphertexts are additively homomorphic: the component-wise
+// product of encryptions of m1 and m2 is an encryption of m1 + m2. This makes
+// it possible to tally encrypted ballots, at the cost that decryption requires
+// computing a discrete logarithm, which is feasible only for small totals.
+
+// EncryptExp encrypts m, which must be in [0, Q), as G^m.
+func (pk *PublicKey) EncryptExp(m *big.Int) (R, C *big.Int, err error) {
+	if m.Sign() < 0 || m.Cmp(pk.Q) >= 0 {
+		return nil, nil, errors.New("message out of range")
+	}
+	R, C = pk.Encrypt(new(big.Int).Exp(pk.G, m, pk.P))
+	if R == nil {
+		return nil, nil, errors.New("failed to sample randomness")
+	}
+	return R, C, nil
+}
+
+// Add outputs (R1 R2, C1 C2). If (R1, C1) and (R2, C2) are exponential
+// encryptions of m1 and m2, then the output is an encryption of m1 + m2.
+func (params *KeyParameters) Add(R1, C1, R2, C2 *big.Int) (R, C *big.Int) {
+	R = new(big.Int).Mul(R1, R2)
+	R.Mod(R, params.P)
+	C = new(big.Int).Mul(C1, C2)
+	C.Mod(C, params.P)
+	return
+}
+
+// ScalarMul outputs (R^k, C^k). If (R, C) is an exponential encryption of m,
+// then the output is an encryption of km.
+func (params *KeyParameters) ScalarMul(R, C, k *big.Int) (R2, C2 *big.Int) {
+	e := new(big.Int).Mod(k, params.Q)
+	R2 = new(big.Int).Exp(R, e, params.P)
+	C2 = new(big.Int).Exp(C, e, params.P)
+	return
+}
+
+// Sum outputs the homomorphic sum of the ciphertexts {(R[i], C[i])}, such as
+// the tally of a sequence of encrypted ballots.
+func (params *KeyParameters) Sum(R, C []*big.Int) (Rsum, Csum *big.Int, err error) {
+	if len(R) != len(C) {
+		return nil, nil, errors.New(fmt.Sprintf(
+			"sequence length mismatch: |R|=%d, |C|=%d", len(R), len(C)))
+	}
+	Rsum = new(big.Int).Set(params.one)
+	Csum = new(big.Int).Set(params.one)
+	for i := range R {
+		Rsum.Mul(Rsum, R[i])
+		Rsum.Mod(Rsum, params.P)
+		Csum.Mul(Csum, C[i])
+		Csum.Mod(Csum, params.P)
+	}
+	return Rsum, Csum, nil
+}
+
+// DLogTable computes discrete logarithms base G of elements G^m with m in [0,
+// Max] by baby-step giant-step. The table of baby steps G^0, ..., G^{s-1},
+// where s = ceil(sqrt(Max+1)), is computed once by NewDLogTable, after which
+// each logarithm costs at most s multiplications. A table may be shared by
+// concurrent callers.
+type DLogTable struct {
+	Max uint64
+
+	params *KeyParameters
+	step   uint64
+	baby   map[string]uint64
+	giant  *big.Int // G^{-step}
+}
+
+// NewDLogTable precomputes a table for discrete logarithms in [0, max].
+func (params *KeyParameters) NewDLogTable(max uint64) (*DLogTable, error) {
+	if max >= 1<<62 {
+		return nil, errors.New("bound too large")
+	}
+	step := new(big.Int).Sqrt(new(big.Int).SetUint64(max)).Uint64() + 1
+
+	t := &DLogTable{
+		Max:    max,
+		params: params,
+		step:   step,
+		baby:   make(map[string]uint64, step),
+	}
+	Z := new(big.Int).Set(params.one)
+	for j := uint64(0); j < step; j++ {
+		t.baby[string(Z.Bytes())] = j
+		Z.Mul(Z, params.G)
+		Z.Mod(Z, params.P)
+	}
+	// Z = G^step.
+	giant, err := inverse(new(big.Int), Z, params.P)
+	if err != nil {
+		return nil, err
+	}
+	t.giant = giant
+	return t, nil
+}
+
+// Log outputs m in [0, Max] such that G^m = M, or an error if there is none.
+func (t *DLogTable) Log(M *big.Int) (uint64, error) {
+	Z := new(big.Int).Mod(M, t.params.P)
+	for i := uint64(0); i*t.step <= t.Max; i++ {
+		if j, ok := t.baby[string(Z.Bytes())]; ok {
+			if m := i*t.step + j; m <= t.Max {
+				return m, nil
+			}
+			break
+		}
+		Z.Mul(Z, t.giant)
+		Z.Mod(Z, t.params.P)
+	}
+	return 0, errors.New(fmt.Sprintf("discrete log not in [0, %d]", t.Max))
+}
+
+// DecryptExp decrypts an exponential encryption of a message in [0,
+// table.Max].
+func (sk *SecretKey) DecryptExp(R, C *big.Int, table *DLogTable) (uint64, error) {
+	return table.Log(sk.Decrypt(R, C))
+}
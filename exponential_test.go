@@ -0,0 +1,103 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// Test that the table computes every logarithm in range and rejects those out
+// of range.
+func TestDLogTable(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	for _, max := range []uint64{0, 1, 15, 16, 17, 100} {
+		table, err := params.NewDLogTable(max)
+		if err != nil {
+			t.Fatal("NewDLogTable() fails:", err)
+		}
+		for m := uint64(0); m <= max+3; m++ {
+			M := new(big.Int).Exp(params.G, new(big.Int).SetUint64(m), params.P)
+			got, err := table.Log(M)
+			if m <= max && (err != nil || got != m) {
+				t.Errorf("max=%d: Log(G^%d) = %d, %v", max, m, got, err)
+			} else if m > max && err == nil {
+				t.Errorf("max=%d: Log(G^%d) = %d, want error", max, m, got)
+			}
+		}
+	}
+}
+
+// Test tallying a sequence of encrypted ballots.
+func TestExpTally(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	table, err := params.NewDLogTable(1000)
+	if err != nil {
+		t.Fatal("NewDLogTable() fails:", err)
+	}
+
+	votes := []int64{1, 0, 1, 1, 0, 1, 0, 0, 1, 1}
+	R := make([]*big.Int, len(votes))
+	C := make([]*big.Int, len(votes))
+	want := uint64(0)
+	for i, v := range votes {
+		if R[i], C[i], err = pk.EncryptExp(big.NewInt(v)); err != nil {
+			t.Fatal("EncryptExp() fails:", err)
+		}
+		want += uint64(v)
+	}
+	Rsum, Csum, err := params.Sum(R, C)
+	if err != nil {
+		t.Fatal("Sum() fails:", err)
+	}
+	if got, err := sk.DecryptExp(Rsum, Csum, table); err != nil || got != want {
+		t.Errorf("DecryptExp() = %d, %v; want %d", got, err, want)
+	}
+
+	// Weight the tally by 7 and add 3.
+	R3, C3, _ := pk.EncryptExp(big.NewInt(3))
+	Rw, Cw := params.ScalarMul(Rsum, Csum, big.NewInt(7))
+	Rw, Cw = params.Add(Rw, Cw, R3, C3)
+	if got, err := sk.DecryptExp(Rw, Cw, table); err != nil || got != 7*want+3 {
+		t.Errorf("DecryptExp() = %d, %v; want %d", got, err, 7*want+3)
+	}
+}
+
+// Test that EncryptExp rejects messages out of range.
+func TestEncryptExpRange(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, _ := params.GenerateKeys()
+	if _, _, err := pk.EncryptExp(big.NewInt(-1)); err == nil {
+		t.Error("EncryptExp() accepts a negative message")
+	}
+	if _, _, err := pk.EncryptExp(params.Q); err == nil {
+		t.Error("EncryptExp() accepts Q")
+	}
+}
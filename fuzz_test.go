@@ -0,0 +1,166 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+// The fuzz targets below run on their seed corpora, in testdata/fuzz, as part
+// of go test. To search for new failures, run, for example,
+//
+//	go test -run XXX -fuzz FuzzILMPVerify
+
+// FuzzDecode checks that Decode never panics, that it accepts exactly the
+// outputs of Encode, and that Encode round-trips.
+func FuzzDecode(f *testing.F) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	f.Fuzz(func(t *testing.T, msg, raw []byte) {
+		if len(msg) > params.MaxMsgBytes() {
+			msg = msg[:params.MaxMsgBytes()]
+		}
+		M, err := params.Encode(msg)
+		if err != nil {
+			t.Fatal("Encode() fails:", err)
+		}
+		if msg2, err := params.Decode(M); err != nil {
+			t.Fatal("Decode() fails:", err)
+		} else if !bytes.Equal(msg, msg2) {
+			t.Fatalf("Decode(Encode(%x)) = %x", msg, msg2)
+		}
+
+		M = new(big.Int).SetBytes(raw)
+		msg2, err := params.Decode(M)
+		if err != nil {
+			return
+		}
+		if M2, err := params.Encode(msg2); err != nil || M2.Cmp(M) != 0 {
+			t.Fatalf("Decode() accepts %x, which is not the encoding of %x", raw, msg2)
+		}
+	})
+}
+
+// fuzzMessages parses data into n prover messages. Each message starts with a
+// header byte: 0xFF stands for nil (the peer closing the channel) and any
+// other value h for h%16 elements. Each element starts with a selector byte s
+// and is, according to s%8, one of 0, 1, P-1, P, Q, -1, the (s/8)-th element
+// of pool, or the integer encoded by the next 32 bytes. Messages missing from
+// data are nil.
+func fuzzMessages(params *KeyParameters, pool []big.Int, data []byte, n int) [][]big.Int {
+	next := func() (byte, bool) {
+		if len(data) == 0 {
+			return 0, false
+		}
+		b := data[0]
+		data = data[1:]
+		return b, true
+	}
+	msgs := make([][]big.Int, n)
+	for k := range msgs {
+		h, ok := next()
+		if !ok || h == 0xFF {
+			continue
+		}
+		msgs[k] = make([]big.Int, h%16)
+		for i := range msgs[k] {
+			s, _ := next()
+			X := &msgs[k][i]
+			switch s % 8 {
+			case 0:
+			case 1:
+				X.SetInt64(1)
+			case 2:
+				X.Sub(params.P, params.one)
+			case 3:
+				X.Set(params.P)
+			case 4:
+				X.Set(params.Q)
+			case 5:
+				X.SetInt64(-1)
+			case 6:
+				X.Set(&pool[int(s/8)%len(pool)])
+			case 7:
+				l := 32
+				if len(data) < l {
+					l = len(data)
+				}
+				X.SetBytes(data[:l])
+				data = data[l:]
+			}
+		}
+	}
+	return msgs
+}
+
+// fuzzProver plays the prover's role with the scripted messages, receiving
+// the verifier's message before each, except the first if first is set. It
+// stops after sending a nil message or receiving one.
+func fuzzProver(msg chan []big.Int, script [][]big.Int, first bool) {
+	for k, m := range script {
+		if (k > 0 || !first) && <-msg == nil {
+			return
+		}
+		msg <- m
+		if m == nil {
+			return
+		}
+	}
+}
+
+// FuzzILMPVerify checks that ILMPVerify never panics and never accepts
+// messages that do not depend on its challenge.
+func FuzzILMPVerify(f *testing.F) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	_, _, X, Y := benchILMPInstance(f, params, 4)
+	pool := append(append([]big.Int{}, X...), Y...)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := make(chan []big.Int)
+		go fuzzProver(msg, fuzzMessages(params, pool, data, 2), true)
+		if ok, _ := params.ILMPVerify(X, Y, msg); ok {
+			t.Fatalf("ILMPVerify() accepts %x", data)
+		}
+	})
+}
+
+// FuzzShuffle0Verify checks that Shuffle0Verify never panics and never
+// accepts messages that do not depend on its challenges.
+func FuzzShuffle0Verify(f *testing.F) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	_, _, _, _, X, Y, C, D := testShuffle0Instance(f, params, 3)
+	pool := append(append([]big.Int{*C, *D}, X...), Y...)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		msg := make(chan []big.Int)
+		go fuzzProver(msg, fuzzMessages(params, pool, data, 2), false)
+		if ok, _ := params.Shuffle0Verify(X, Y, C, D, msg); ok {
+			t.Fatalf("Shuffle0Verify() accepts %x", data)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// maxGroupEncoderBytes bounds the message length of a GroupEncoder. Its table
+// has about 2^(4 maxBytes) entries of the size of P.
+const maxGroupEncoderBytes = 4
+
+// GroupEncoder encodes short messages as elements of <G>. Encrypt the output
+// of a GroupEncoder, rather than of Encode, when the ciphertext is to be
+// re-encrypted: the output of Encode is in general not in <G>, and since
+// re-encryption multiplies C by an element of <G>, it would leave C^Q
+// unchanged and link the output to the input. ReEncrypt and the re-encryption
+// mixes reject such ciphertexts.
+//
+// A message msg is encoded as G^v, where v is the integer whose big-endian
+// encoding is 0x01 || msg; the leading byte makes the length of msg
+// unambiguous. Decoding computes the discrete logarithm of G^v with a
+// DLogTable, which is why the message space is small.
+type GroupEncoder struct {
+	MaxBytes int
+
+	table *DLogTable
+}
+
+// NewGroupEncoder returns an encoder for messages of at most maxBytes bytes,
+// which must be in [1, 4]. It precomputes about 2^(4 maxBytes) elements of
+// <G>.
+func (params *KeyParameters) NewGroupEncoder(maxBytes int) (*GroupEncoder, error) {
+	if maxBytes < 1 || maxBytes > maxGroupEncoderBytes {
+		return nil, errors.New(fmt.Sprintf(
+			"message length must be in [1, %d]", maxGroupEncoderBytes))
+	}
+	table, err := params.NewDLogTable(1<<uint(8*maxBytes+1) - 1)
+	if err != nil {
+		return nil, err
+	}
+	return &GroupEncoder{MaxBytes: maxBytes, table: table}, nil
+}
+
+// Encode outputs the encoding of msg as an element of <G>.
+func (e *GroupEncoder) Encode(msg []byte) (*big.Int, error) {
+	if len(msg) > e.MaxBytes {
+		return nil, errors.New("message too big")
+	}
+	v := new(big.Int).SetBytes(append([]byte{1}, msg...))
+	params := e.table.params
+	return new(big.Int).Exp(params.G, v, params.P), nil
+}
+
+// Decode outputs the message encoded by Encode as M.
+func (e *GroupEncoder) Decode(M *big.Int) ([]byte, error) {
+	if M == nil {
+		return nil, errors.New("missing value")
+	}
+	v, err := e.table.Log(M)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("malformed encoding: %v", err))
+	}
+	b := new(big.Int).SetUint64(v).Bytes()
+	if len(b) == 0 || b[0] != 1 {
+		return nil, errors.New("malformed encoding: bad prefix")
+	}
+	return b[1:], nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+// testGroupEncoder returns an encoder for messages of up to 2 bytes.
+func testGroupEncoder(t testing.TB, params *KeyParameters) *GroupEncoder {
+	enc, err := params.NewGroupEncoder(2)
+	if err != nil {
+		t.Fatal("NewGroupEncoder() fails:", err)
+	}
+	return enc
+}
+
+// Test that every message encodes to an element of <G> and round-trips.
+func TestGroupEncoder(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	enc := testGroupEncoder(t, params)
+	for _, msg := range [][]byte{{}, {0}, {1}, {0, 0}, {0xff}, {0xff, 0xff}, []byte("hi")} {
+		M, err := enc.Encode(msg)
+		if err != nil {
+			t.Fatalf("Encode(%x) fails: %s", msg, err)
+		}
+		if !params.IsElement(M) {
+			t.Errorf("Encode(%x) is not an element of <G>", msg)
+		}
+		if msg2, err := enc.Decode(M); err != nil || !bytes.Equal(msg, msg2) {
+			t.Errorf("Decode(Encode(%x)) = %x, %v", msg, msg2, err)
+		}
+	}
+
+	if _, err := enc.Encode([]byte("abc")); err == nil {
+		t.Error("Encode() accepts a message that is too long")
+	}
+	for _, v := range []int64{0, 2, 0x200} {
+		M := new(big.Int).Exp(params.G, big.NewInt(v), params.P)
+		if msg, err := enc.Decode(M); err == nil {
+			t.Errorf("Decode(G^%#x) = %x, want error", v, msg)
+		}
+	}
+	if msg, err := enc.Decode(new(big.Int).Sub(params.P, big.NewInt(1))); err == nil {
+		t.Errorf("Decode(P-1) = %x, want error", msg)
+	}
+	if _, err := enc.Decode(nil); err == nil {
+		t.Error("Decode(nil) succeeds: expected error")
+	}
+}
+
+// Test that NewGroupEncoder rejects message lengths out of range.
+func TestNewGroupEncoderRange(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	for _, n := range []int{-1, 0, maxGroupEncoderBytes + 1} {
+		if _, err := params.NewGroupEncoder(n); err == nil {
+			t.Errorf("NewGroupEncoder(%d) succeeds: expected error", n)
+		}
+	}
+}
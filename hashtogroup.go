@@ -0,0 +1,59 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"encoding/binary"
+	"math/big"
+)
+
+// HashToGroup deterministically derives the index-th element of <G> for the
+// given domain. It hashes the domain and index into Z/p and raises the result
+// to the cofactor (P-1)/Q, retrying with a counter in the unlikely case that
+// this yields 0 or 1. Since the outputs are computed from a hash rather than
+// as powers of G, nobody knows their discrete logs with respect to each other
+// or G, so they may serve as independent generators. Different domains yield
+// independent sequences of generators.
+func (params *KeyParameters) HashToGroup(domain string, index int) *big.Int {
+	cofactor := new(big.Int).Sub(params.P, params.one)
+	cofactor.Div(cofactor, params.Q)
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], uint64(index))
+	for ctr := uint64(0); ; ctr++ {
+		binary.BigEndian.PutUint64(buf[8:], ctr)
+		th := params.newTranscriptHash("hash to group")
+		th.writeBytes([]byte(domain))
+		th.writeBytes(buf[:])
+		Z := th.reduce(params.P)
+		Z.Exp(Z, cofactor, params.P)
+		if Z.Sign() != 0 && Z.Cmp(params.one) != 0 {
+			return Z
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"testing"
+)
+
+// Test that the outputs are elements of <G> other than 1 and G, for each
+// parameter set, and that they differ per index and per domain.
+func TestHashToGroup(t *testing.T) {
+	for _, set := range benchParams {
+		params := NewKeyParametersFromStrings(set.p, set.g, set.q)
+		seen := make(map[string]int)
+		for _, domain := range []string{"test", "other", ""} {
+			for _, index := range []int{0, 1, 2, 1000, -1} {
+				X := params.HashToGroup(domain, index)
+				if !params.IsElement(X) || X.Cmp(params.one) == 0 || X.Cmp(params.G) == 0 {
+					t.Errorf("%s: HashToGroup(%q, %d) is not a fresh element of <G>", set.name, domain, index)
+				}
+				if X.Cmp(params.HashToGroup(domain, index)) != 0 {
+					t.Errorf("%s: HashToGroup(%q, %d) is not deterministic", set.name, domain, index)
+				}
+				key := X.String()
+				if _, ok := seen[key]; ok {
+					t.Errorf("%s: HashToGroup(%q, %d) repeats an output", set.name, domain, index)
+				}
+				seen[key] = index
+			}
+		}
+	}
+}
+
+// Test that the output depends on the group.
+func TestHashToGroupParams(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	other := NewKeyParametersFromStrings(benchP1024, benchG1024, benchQ1024)
+	X := params.HashToGroup("test", 0)
+	Y := other.HashToGroup("test", 0)
+	if X.Cmp(Y) == 0 {
+		t.Error("HashToGroup() outputs the same element for different groups")
+	}
+}
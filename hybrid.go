@@ -0,0 +1,228 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// HybridCiphertext is a KEM/DEM encryption of a message of arbitrary length.
+// (R, C) is an ElGamal encryption of a random element K of <G>, and Payload is
+// the AES-GCM encryption of the message under a key derived from K with HKDF.
+//
+// The payload is bound to K rather than to (R, C): re-encrypting (R, C)
+// preserves K, so the payload still opens after a re-encryption mix, whereas
+// attached to any other ciphertext it fails to open. A re-encryption mix
+// (ReEncryptionMixHybrid) moves each payload along with its ElGamal component,
+// and the shuffle proof over the components (ReEncryptionShuffleProveHybrid)
+// thereby covers the payloads: a server that drops, alters, or swaps a payload
+// is caught when it fails to open.
+//
+// The payloads are carried unchanged, so anyone who sees the payloads of both
+// the input and the output of a server can match them. Only the ElGamal
+// components, over which the shuffle is proven, should be published.
+type HybridCiphertext struct {
+	R, C    *big.Int
+	Payload []byte
+}
+
+// hkdfSHA256 derives a key of n <= 32 bytes from secret and info with
+// HKDF-SHA256 (RFC 5869) and an empty salt.
+func hkdfSHA256(secret []byte, info string, n int) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(secret)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	expand.Write([]byte(info))
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:n]
+}
+
+// hybridAEAD derives the AES-256-GCM instance for the key encapsulated as K.
+func (params *KeyParameters) hybridAEAD(K *big.Int) (cipher.AEAD, error) {
+	secret := K.FillBytes(make([]byte, (params.P.BitLen()+7)/8))
+	block, err := aes.NewCipher(hkdfSHA256(secret, "cjpatton/shuffle hybrid", 32))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// EncryptHybrid encrypts a message of arbitrary length.
+func (pk *PublicKey) EncryptHybrid(msg []byte) (*HybridCiphertext, error) {
+	k, err := pk.Sample()
+	if err != nil {
+		return nil, err
+	}
+	K := new(big.Int).Exp(pk.G, k, pk.P)
+	aead, err := pk.hybridAEAD(K)
+	if err != nil {
+		return nil, err
+	}
+	R, C := pk.Encrypt(K)
+	if R == nil {
+		return nil, errors.New("failed to sample randomness")
+	}
+	// Each key encrypts a single message, so a fixed nonce is safe.
+	nonce := make([]byte, aead.NonceSize())
+	return &HybridCiphertext{R: R, C: C, Payload: aead.Seal(nil, nonce, msg, nil)}, nil
+}
+
+// DecryptHybrid decrypts a hybrid ciphertext. It returns an error if the
+// payload is not authentic.
+func (sk *SecretKey) DecryptHybrid(ct *HybridCiphertext) ([]byte, error) {
+	if ct == nil || ct.R == nil || ct.C == nil {
+		return nil, errors.New("missing value")
+	}
+	if err := sk.checkCiphertext(ct.R, ct.C, false); err != nil {
+		return nil, err
+	}
+	return sk.openHybrid(sk.Decrypt(ct.R, ct.C), ct.Payload)
+}
+
+// openHybrid decrypts payload under the key encapsulated as K.
+func (params *KeyParameters) openHybrid(K *big.Int, payload []byte) ([]byte, error) {
+	aead, err := params.hybridAEAD(K)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	return aead.Open(nil, nonce, payload, nil)
+}
+
+// HybridComponents outputs the ElGamal components {(R[i], C[i])} of a
+// sequence of hybrid ciphertexts, over which shuffles are proven.
+func HybridComponents(cts []*HybridCiphertext) (R, C []*big.Int) {
+	R = make([]*big.Int, len(cts))
+	C = make([]*big.Int, len(cts))
+	for i, ct := range cts {
+		R[i], C[i] = ct.R, ct.C
+	}
+	return
+}
+
+// checkHybrid returns a *CiphertextError if one of the hybrid ciphertexts is
+// missing.
+func checkHybrid(cts []*HybridCiphertext) error {
+	for i, ct := range cts {
+		if ct == nil {
+			return &CiphertextError{i, errors.New("missing ciphertext")}
+		}
+	}
+	return nil
+}
+
+// MixHybrid decrypts the ElGamal components of the sequence of hybrid
+// ciphertexts with Mix, applies the same permutation to the payloads, and
+// outputs the resulting sequence of messages. It returns the errors of Mix,
+// and a *CiphertextError if a payload does not open.
+func (sk *SecretKey) MixHybrid(cts []*HybridCiphertext, perm Permutation) ([][]byte, error) {
+	if err := checkHybrid(cts); err != nil {
+		return nil, err
+	}
+	R, C := HybridComponents(cts)
+	K, err := sk.Mix(R, C, perm)
+	if err != nil {
+		return nil, err
+	}
+	payloads := make([][]byte, len(cts))
+	for i, ct := range cts {
+		payloads[i] = ct.Payload
+	}
+	payloads = Permute(perm, payloads)
+
+	msgs := make([][]byte, len(cts))
+	for i := range msgs {
+		if msgs[i], err = sk.openHybrid(K[i], payloads[i]); err != nil {
+			return nil, &CiphertextError{perm.Inverse()[i], err}
+		}
+	}
+	return msgs, nil
+}
+
+// ReEncryptionMixHybrid re-encrypts the ElGamal components of the sequence of
+// hybrid ciphertexts and applies the specified permutation, as ReEncryptionMix
+// does, moving each payload along with its component. It also outputs the
+// randomness the mix server needs in order to prove the shuffle with
+// ReEncryptionShuffleProveHybrid.
+func (pk *PublicKey) ReEncryptionMixHybrid(cts []*HybridCiphertext, perm Permutation) (out []*HybridCiphertext, rands []*big.Int, err error) {
+	if err := checkHybrid(cts); err != nil {
+		return nil, nil, err
+	}
+	R, C := HybridComponents(cts)
+	R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+	if err != nil {
+		return nil, nil, err
+	}
+	out = make([]*HybridCiphertext, len(cts))
+	for i, ct := range cts {
+		out[perm[i]] = &HybridCiphertext{R: R2[perm[i]], C: C2[perm[i]], Payload: ct.Payload}
+	}
+	return out, rands, nil
+}
+
+// ReEncryptionShuffleProveHybrid implements the prover role in an interactive
+// proof that out is a re-encryption shuffle of the hybrid ciphertexts in. It
+// runs ReEncryptionShuffleProve on their ElGamal components; the payloads are
+// covered because each opens only under the key its component encapsulates.
+func (pk *PublicKey) ReEncryptionShuffleProveHybrid(in, out []*HybridCiphertext, perm Permutation, rands []*big.Int, rounds int, msg chan []big.Int) error {
+	if err := checkHybrid(in); err != nil {
+		msg <- nil
+		return errors.New(fmt.Sprintf("input %v", err))
+	}
+	if err := checkHybrid(out); err != nil {
+		msg <- nil
+		return errors.New(fmt.Sprintf("output %v", err))
+	}
+	R, C := HybridComponents(in)
+	R2, C2 := HybridComponents(out)
+	return pk.ReEncryptionShuffleProve(R, C, R2, C2, perm, rands, rounds, msg)
+}
+
+// ReEncryptionShuffleVerifyHybrid implements the verifier role in the
+// interactive proof that out is a re-encryption shuffle of the hybrid
+// ciphertexts in. It needs only the ElGamal components of the ciphertexts.
+func (pk *PublicKey) ReEncryptionShuffleVerifyHybrid(in, out []*HybridCiphertext, rounds int, msg chan []big.Int) (bool, error) {
+	if err := checkHybrid(in); err != nil {
+		msg <- nil
+		return false, errors.New(fmt.Sprintf("input %v", err))
+	}
+	if err := checkHybrid(out); err != nil {
+		msg <- nil
+		return false, errors.New(fmt.Sprintf("output %v", err))
+	}
+	R, C := HybridComponents(in)
+	R2, C2 := HybridComponents(out)
+	return pk.ReEncryptionShuffleVerify(R, C, R2, C2, rounds, msg)
+}
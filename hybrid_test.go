@@ -0,0 +1,199 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+// Test that messages longer than MaxMsgBytes round-trip.
+func TestHybridEncryptDecrypt(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	for _, n := range []int{0, 1, params.MaxMsgBytes() + 1, 1 << 16} {
+		msg := bytes.Repeat([]byte{'x'}, n)
+		ct, err := pk.EncryptHybrid(msg)
+		if err != nil {
+			t.Fatal("EncryptHybrid() fails:", err)
+		}
+		got, err := sk.DecryptHybrid(ct)
+		if err != nil {
+			t.Fatalf("DecryptHybrid() fails for %d bytes: %s", n, err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Errorf("DecryptHybrid() output is incorrect for %d bytes", n)
+		}
+	}
+}
+
+// Test that a modified payload or KEM component is rejected.
+func TestHybridTamper(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	ct, err := pk.EncryptHybrid([]byte("attack at dawn"))
+	if err != nil {
+		t.Fatal("EncryptHybrid() fails:", err)
+	}
+
+	bad := *ct
+	bad.Payload = append([]byte(nil), ct.Payload...)
+	bad.Payload[0] ^= 1
+	if _, err := sk.DecryptHybrid(&bad); err == nil {
+		t.Error("DecryptHybrid() accepts a modified payload")
+	}
+	bad = *ct
+	bad.C = new(big.Int).Mul(ct.C, params.G)
+	bad.C.Mod(bad.C, params.P)
+	if _, err := sk.DecryptHybrid(&bad); err == nil {
+		t.Error("DecryptHybrid() accepts a modified KEM component")
+	}
+	// A re-encryption of the ElGamal component encapsulates the same key, so
+	// the payload still opens, but not with any other ciphertext.
+	bad = *ct
+	if bad.R, bad.C, err = pk.ReEncrypt(ct.R, ct.C); err != nil {
+		t.Fatal("ReEncrypt() fails:", err)
+	}
+	if _, err := sk.DecryptHybrid(&bad); err != nil {
+		t.Error("DecryptHybrid() rejects the payload with a re-encrypted KEM component:", err)
+	}
+	other, err := pk.EncryptHybrid([]byte("attack at dusk"))
+	if err != nil {
+		t.Fatal("EncryptHybrid() fails:", err)
+	}
+	bad = *other
+	bad.Payload = ct.Payload
+	if _, err := sk.DecryptHybrid(&bad); err == nil {
+		t.Error("DecryptHybrid() accepts the payload with another KEM component")
+	}
+	_, otherSK := params.GenerateKeys()
+	if _, err := otherSK.DecryptHybrid(ct); err == nil {
+		t.Error("DecryptHybrid() accepts the wrong key")
+	}
+}
+
+// Test that MixHybrid outputs the permuted messages.
+func TestMixHybrid(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	N := 5
+	msgs := make([][]byte, N)
+	cts := make([]*HybridCiphertext, N)
+	for i := range cts {
+		msgs[i] = bytes.Repeat([]byte{byte('a' + i)}, 300+i)
+		var err error
+		if cts[i], err = pk.EncryptHybrid(msgs[i]); err != nil {
+			t.Fatal("EncryptHybrid() fails:", err)
+		}
+	}
+	perm := testPerm(t, N)
+	out, err := sk.MixHybrid(cts, perm)
+	if err != nil {
+		t.Fatal("MixHybrid() fails:", err)
+	}
+	for i := range msgs {
+		if !bytes.Equal(out[perm[i]], msgs[i]) {
+			t.Errorf("output %d is incorrect", perm[i])
+		}
+	}
+	if _, err := sk.MixHybrid(cts, []int{0, 0, 1, 2, 3}); err == nil {
+		t.Error("MixHybrid() accepts a non-permutation")
+	}
+}
+
+// testHybridCiphertexts returns hybrid encryptions of N distinct messages
+// longer than MaxMsgBytes.
+func testHybridCiphertexts(t *testing.T, pk *PublicKey, N int) (msgs [][]byte, cts []*HybridCiphertext) {
+	msgs = make([][]byte, N)
+	cts = make([]*HybridCiphertext, N)
+	for i := range cts {
+		msgs[i] = bytes.Repeat([]byte{byte('a' + i)}, pk.MaxMsgBytes()+i)
+		var err error
+		if cts[i], err = pk.EncryptHybrid(msgs[i]); err != nil {
+			t.Fatal("EncryptHybrid() fails:", err)
+		}
+	}
+	return
+}
+
+// Test a verifiable re-encryption mix of hybrid ciphertexts followed by a
+// decryption mix.
+func TestReEncryptionMixHybrid(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	N := 4
+	msgs, cts := testHybridCiphertexts(t, pk, N)
+
+	perm := testPerm(t, N)
+	out, rands, err := pk.ReEncryptionMixHybrid(cts, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMixHybrid() fails:", err)
+	}
+	msg := make(chan []big.Int)
+	go func() {
+		if err := pk.ReEncryptionShuffleProveHybrid(cts, out, perm, rands, testShuffleRounds, msg); err != nil {
+			t.Errorf("prover: %s", err)
+		}
+	}()
+	if ok, err := pk.ReEncryptionShuffleVerifyHybrid(cts, out, testShuffleRounds, msg); err != nil {
+		t.Fatal("verifier:", err)
+	} else if !ok {
+		t.Fatal("failed to verify")
+	}
+
+	perm2 := testPerm(t, N)
+	got, err := sk.MixHybrid(out, perm2)
+	if err != nil {
+		t.Fatal("MixHybrid() fails:", err)
+	}
+	for i := range msgs {
+		if !bytes.Equal(got[perm2[perm[i]]], msgs[i]) {
+			t.Errorf("message %d is output incorrectly", i)
+		}
+	}
+
+	// A server that swaps two payloads is caught when they fail to open.
+	out[0].Payload, out[1].Payload = out[1].Payload, out[0].Payload
+	if _, err := sk.MixHybrid(out, perm2); err == nil {
+		t.Error("MixHybrid() accepts swapped payloads")
+	} else if e, ok := err.(*CiphertextError); !ok || (e.Index != 0 && e.Index != 1) {
+		t.Errorf("MixHybrid() returns %v, want a *CiphertextError for 0 or 1", err)
+	}
+}
+
+// Test hkdfSHA256 against test case 3 of RFC 5869.
+func TestHKDF(t *testing.T) {
+	okm := hkdfSHA256(bytes.Repeat([]byte{0x0b}, 22), "", 32)
+	want := "8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d"
+	if got := hex.EncodeToString(okm); got != want {
+		t.Errorf("hkdfSHA256() = %s, want %s", got, want)
+	}
+}
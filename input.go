@@ -0,0 +1,102 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// A sender who copies someone else's ciphertext into the batch, possibly
+// re-encrypted, can trace it through Mix by looking for the plaintext that
+// appears twice in the output. To prevent this, each input ciphertext (R, C)
+// carries a proof of knowledge of the encryption randomness r = log_G R, bound
+// to the sender's identity. Since a copied ciphertext is, at best, a
+// re-encryption R G^s for which the copier does not know log_G R, it cannot be
+// submitted with a valid proof.
+
+// inputContext binds a proof of knowledge of the randomness of (R, C) to the
+// public key, the C component, and the sender's identity.
+func (pk *PublicKey) inputContext(C *big.Int, id []byte) []byte {
+	th := pk.newTranscriptHash("input")
+	th.writeInts(pk.Y, C)
+	th.writeBytes(id)
+	return th.h.Sum(nil)
+}
+
+// EncryptWithProof encrypts M and outputs a proof that the sender with
+// identity id knows the encryption randomness.
+func (pk *PublicKey) EncryptWithProof(M *big.Int, id []byte) (R, C *big.Int, proof *SchnorrProof, err error) {
+	r, err := pk.Sample()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	R = new(big.Int).Exp(pk.G, r, pk.P)
+	C = new(big.Int).Exp(pk.Y, r, pk.P)
+	C.Mul(C, M)
+	C.Mod(C, pk.P)
+	if proof, err = pk.SchnorrProveNI(r, pk.inputContext(C, id)); err != nil {
+		return nil, nil, nil, err
+	}
+	return R, C, proof, nil
+}
+
+// VerifyInput verifies a proof output by EncryptWithProof for the ciphertext
+// (R, C) and the sender with identity id.
+func (pk *PublicKey) VerifyInput(R, C *big.Int, proof *SchnorrProof, id []byte) bool {
+	if R == nil || C == nil || !pk.IsElement(R) {
+		return false
+	}
+	return pk.SchnorrVerifyNI(R, proof, pk.inputContext(C, id))
+}
+
+// FilterInputs checks a batch of input ciphertexts {(R[i], C[i])} before it is
+// passed to Mix, where proofs[i] and ids[i] are the proof and identity of the
+// i-th sender. It outputs the ciphertexts that are accepted and the indices of
+// those that are rejected: a ciphertext is rejected if its proof is invalid or
+// if its R component repeats that of an earlier ciphertext.
+func (pk *PublicKey) FilterInputs(R, C []*big.Int, proofs []*SchnorrProof, ids [][]byte) (R2, C2 []*big.Int, rejected []int, err error) {
+	if len(C) != len(R) || len(proofs) != len(R) || len(ids) != len(R) {
+		return nil, nil, nil, errors.New(fmt.Sprintf(
+			"sequence length mismatch: |R|=%d, |C|=%d, |proofs|=%d, |ids|=%d",
+			len(R), len(C), len(proofs), len(ids)))
+	}
+	seen := make(map[string]bool)
+	for i := range R {
+		if !pk.VerifyInput(R[i], C[i], proofs[i], ids[i]) || seen[string(R[i].Bytes())] {
+			rejected = append(rejected, i)
+			continue
+		}
+		seen[string(R[i].Bytes())] = true
+		R2 = append(R2, R[i])
+		C2 = append(C2, C[i])
+	}
+	return R2, C2, rejected, nil
+}
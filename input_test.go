@@ -0,0 +1,97 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+// Test that an honest sender's input is accepted and decrypts correctly.
+func TestEncryptWithProof(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	M, _ := params.Encode([]byte("hello"))
+	R, C, proof, err := pk.EncryptWithProof(M, []byte("alice"))
+	if err != nil {
+		t.Fatal("EncryptWithProof() fails:", err)
+	}
+	if sk.Decrypt(R, C).Cmp(M) != 0 {
+		t.Error("EncryptWithProof() output does not decrypt to M")
+	}
+	if !pk.VerifyInput(R, C, proof, []byte("alice")) {
+		t.Error("VerifyInput() rejects a valid input")
+	}
+	if pk.VerifyInput(R, C, proof, []byte("bob")) {
+		t.Error("VerifyInput() accepts a proof for another sender")
+	}
+	C2 := new(big.Int).Mul(C, params.G)
+	if pk.VerifyInput(R, C2.Mod(C2, params.P), proof, []byte("alice")) {
+		t.Error("VerifyInput() accepts a proof for another ciphertext")
+	}
+}
+
+// Test that the filter rejects copies of another sender's ciphertext.
+func TestFilterInputs(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, _ := params.GenerateKeys()
+	M, _ := params.Encode([]byte("vote"))
+	ids := [][]byte{[]byte("alice"), []byte("bob"), []byte("eve"), []byte("eve"), []byte("eve")}
+
+	R := make([]*big.Int, 5)
+	C := make([]*big.Int, 5)
+	proofs := make([]*SchnorrProof, 5)
+	var err error
+	for i := 0; i < 2; i++ {
+		if R[i], C[i], proofs[i], err = pk.EncryptWithProof(M, ids[i]); err != nil {
+			t.Fatal("EncryptWithProof() fails:", err)
+		}
+	}
+	// Eve replays Alice's ciphertext and proof under her own identity.
+	R[2], C[2], proofs[2] = R[0], C[0], proofs[0]
+	// Eve re-encrypts Alice's ciphertext and proves knowledge of the added
+	// randomness only.
+	s, _ := params.Sample()
+	R[3], C[3] = pk.reEncrypt(R[0], C[0], s)
+	proofs[3], _ = pk.SchnorrProveNI(s, pk.inputContext(C[3], ids[3]))
+	// Eve replays Bob's submission verbatim.
+	R[4], C[4], proofs[4], ids[4] = R[1], C[1], proofs[1], ids[1]
+
+	R2, C2, rejected, err := pk.FilterInputs(R, C, proofs, ids)
+	if err != nil {
+		t.Fatal("FilterInputs() fails:", err)
+	}
+	if !reflect.DeepEqual(rejected, []int{2, 3, 4}) {
+		t.Errorf("FilterInputs() rejected %v, want [2 3 4]", rejected)
+	}
+	if len(R2) != 2 || len(C2) != 2 || R2[0] != R[0] || R2[1] != R[1] {
+		t.Error("FilterInputs() did not output the accepted inputs")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// inverse sets z to the multiplicative inverse of a mod m and returns z. It
+// returns an error if a is not invertible, i.e., if a and m are not
+// relatively prime.
+func inverse(z, a, m *big.Int) (*big.Int, error) {
+	if z.ModInverse(a, m) == nil {
+		return nil, errors.New("element is not invertible")
+	}
+	return z, nil
+}
+
+// batchInverse sets z[i] to the inverse of a[i] mod m for each i using
+// Montgomery's trick: the running products of a are inverted all at once,
+// costing one inversion and 3(n-1) multiplications rather than n inversions.
+// It returns an error naming the first element that is not invertible. z may
+// alias a.
+func (s *Scratch) batchInverse(z, a []big.Int, m *big.Int) error {
+	n := len(a)
+	if len(z) != n {
+		return errors.New("input lengths do not match")
+	}
+	if n == 0 {
+		return nil
+	}
+
+	// prefix[i] = a[0] * ... * a[i] mod m.
+	s.prefix = ints(s.prefix, n)
+	prefix := s.prefix
+	s.mod(&prefix[0], &a[0], m)
+	for i := 1; i < n; i++ {
+		s.mulMod(&prefix[i], &prefix[i-1], &a[i], m)
+	}
+
+	inv := &s.inv
+	if _, err := inverse(inv, &prefix[n-1], m); err != nil {
+		// Find the culprit.
+		for i := 0; i < n; i++ {
+			if _, err := inverse(&s.prod, &a[i], m); err != nil {
+				return errors.New(fmt.Sprintf("element %d is not invertible", i))
+			}
+		}
+		return err
+	}
+
+	// At the start of each iteration, inv = (a[0] * ... * a[i])^-1.
+	next := &s.next
+	for i := n - 1; i > 0; i-- {
+		s.mulMod(next, inv, &a[i], m)
+		s.mulMod(&z[i], inv, &prefix[i-1], m)
+		inv, next = next, inv
+	}
+	z[0].Set(inv)
+	return nil
+}
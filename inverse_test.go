@@ -0,0 +1,117 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// Test computing inverses mod Q.
+func TestInverse(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+
+	a, _ := params.Sample()
+	var z, one big.Int
+	if _, err := inverse(&z, a, params.Q); err != nil {
+		t.Fatal("inverse(a) fails:", err)
+	}
+	one.Mul(&z, a)
+	one.Mod(&one, params.Q)
+	if one.Cmp(params.one) != 0 {
+		t.Error("a * inverse(a) != 1")
+	}
+
+	if _, err := inverse(&z, new(big.Int), params.Q); err == nil {
+		t.Error("inverse(0) succeeds: expected error")
+	}
+	if _, err := inverse(&z, params.Q, params.Q); err == nil {
+		t.Error("inverse(Q) succeeds: expected error")
+	}
+}
+
+// Test batch inversion against computing each inverse individually.
+func TestBatchInverse(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	s := NewScratch()
+
+	for _, N := range []int{0, 1, 2, 10} {
+		a := make([]big.Int, N)
+		for i := 0; i < N; i++ {
+			t, _ := params.Sample()
+			a[i].Set(t)
+		}
+		// Duplicates are fine.
+		if N > 2 {
+			a[2].Set(&a[1])
+		}
+
+		z := make([]big.Int, N)
+		if err := s.batchInverse(z, a, params.Q); err != nil {
+			t.Fatalf("%d: batchInverse() fails: %s", N, err)
+		}
+		var inv big.Int
+		for i := 0; i < N; i++ {
+			inv.ModInverse(&a[i], params.Q)
+			if z[i].Cmp(&inv) != 0 {
+				t.Errorf("%d: batchInverse() is wrong at %d", N, i)
+			}
+		}
+
+		// Invert in place.
+		if err := s.batchInverse(a, a, params.Q); err != nil {
+			t.Fatalf("%d: batchInverse() in place fails: %s", N, err)
+		}
+		for i := 0; i < N; i++ {
+			if a[i].Cmp(&z[i]) != 0 {
+				t.Errorf("%d: batchInverse() in place is wrong at %d", N, i)
+			}
+		}
+	}
+}
+
+// Test that batch inversion reports the element that is not invertible.
+func TestBatchInverseZero(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	s := NewScratch()
+
+	a := make([]big.Int, 5)
+	for i := range a {
+		a[i].SetInt64(int64(i) + 1)
+	}
+	a[3].Set(params.Q) // Congruent to 0.
+	z := make([]big.Int, len(a))
+	err := s.batchInverse(z, a, params.Q)
+	if err == nil {
+		t.Fatal("batchInverse() succeeds: expected error")
+	}
+	if err.Error() != "element 3 is not invertible" {
+		t.Errorf("batchInverse() fails with %q, expected element 3", err)
+	}
+}
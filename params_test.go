@@ -0,0 +1,103 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+// This file holds the parameter sets over which the tests and benchmarks
+// iterate.
+
+// Additional public parameters for benchmarking. Each is a prime P, a prime Q
+// dividing P-1, and a generator G of the subgroup of Z/p of order Q. They were
+// generated by choosing Q at random, searching for P = kQ + 1, and letting G =
+// H^((P-1)/Q) for the smallest H > 1 such that G != 1.
+
+// 1024-bit P with a 160-bit subgroup.
+const benchP1024 = "B7930B39B2D3115A20F8AE831E49DE2280D986242E910841" +
+	"EE8776B5A80549A6C40DFAA537FB4A9257830000659088AB" +
+	"35DCB7B61DA93346D8EA633ECFB45AD2372CF752023DD024" +
+	"A7DB18255929E1AB95153A1DB2FAC373A8DAB1E4C68E475F" +
+	"5EB9EA9D43C17A523E1A98311E28083317B855033089F33A" +
+	"E9C0654BB0B8CC1D"
+
+const benchG1024 = "AE1BC290E1F1AC20D8BF5B33A30966783314D580F008E899" +
+	"0B65F6AE9D6C939C915F9F94875AF110A39792C9B10FA684" +
+	"023110F59964D31ABA7C8DF09215D1996315A403402D30AA" +
+	"A919D79D2F67883CCA19ED26DE327CD118CBE92B45C8727E" +
+	"38FCAA4AE0A34FBF2CBA46DEF2A661214107EF10045F9636" +
+	"BCBD2AEC349FA374"
+
+const benchQ1024 = "F99E5B1FC3C8CB50CD7A9A3F89B3AF52BAF3F7BF"
+
+// 3072-bit P with a 256-bit subgroup.
+const benchP3072 = "E7BB439C046B7B9D58F0C891350E2A3AA6037B4D1316E0D5" +
+	"0C04C902C16461E1378DE5546906F2A330C23CE8FFF15EE7" +
+	"10A1C84ED9B3EE0ACD3390E3C43180209F6C5FD4788E5536" +
+	"6B705BFE18E8880E709E103E5668C5EDD4754D889CB73E0A" +
+	"D4956ADCC262C4B417A8711DFD0C365D7F38BFA180FDF96F" +
+	"EE560473F27C39B824B842517F6E0AD19B82C0F834AFCDAF" +
+	"CD7E3ABF54D924380308603F2620B384C15AEC6BA3A7EA3A" +
+	"152C112D4A8F4E6F83F2D27DB7CDA15664061E7AF1981C5B" +
+	"352C93F58A6D7C3512E6243FB0F417D67E5118BE36F5335D" +
+	"1332F7739365CE401841D6D504E593E944574F436242022E" +
+	"FAA173D552D10AB37B608BEFECA1F61B8D94A7C46C922A92" +
+	"EBA6D288F89EEAB67B65AD795B49D2FEF822F779BB33AD6F" +
+	"01D54E904412EDE5B2C5F1987D9F4EF8274F580A77D38FD1" +
+	"B0A37A9430C0FD192650AD9931AAF8EA1DCD3682BE0C4AC8" +
+	"DEC84E9C571E719839DDF49888729E3DADF0627D63BBCB6F" +
+	"649635F8F56EA1EF41F70113416A7BD1BB83697C166534CD"
+
+const benchG3072 = "A41C32B49B59EC2D9233273E106CBDC5FAFE2D8A12AFE70F" +
+	"28CEB5EDBE70BCCEB939C1D6C222DCB3257D817C109966AA" +
+	"8742F77C041668E1534EB6DF622F3E90221BD0E2FC15F3B2" +
+	"DB3E1B35E3B4A0BABFBC56BA32ED41CE6247F20CDDD35D32" +
+	"8E8A2F022365B5DFC578AF3592F3BEB7C9650DB9D6E006FE" +
+	"B9A7587DD08EB3C773CFB1ADD82515AA0CBFE67B38EC649F" +
+	"4BED5ACF328BB3596661607260E00594BB5E0003CFB2AFAB" +
+	"6A70EBB3503853B62223679E02B7BC08996428CB0B8BE382" +
+	"68AA49D1340F69F45620E57D64B9EF8DEF4455E9CF0DF1D2" +
+	"13A6D190B2340506A5B2F64E55838048CE806D84820E9948" +
+	"E926B2C1D361DF8D7C7187B9403DEF11CE62190B84D147B9" +
+	"E80F62C21B7CF20AEA5492E8D3DB200D8438CCC74649A54F" +
+	"E8D0A6D7D1DCECE82D3F096E685672E29E5E62312C9710D1" +
+	"DB39DC8BD301BBA1F03430F15F1309AB81A5C30D3DC3073A" +
+	"C81E608F12AEB93ABB5B6C573B89524B8C64099283DE36C8" +
+	"349F2C854570D10E795CB0AA57A3222D2D78B3F3AB8D6A18"
+
+const benchQ3072 = "EAEA20B635773477CA59636CDE7AEABB979892A7D75CEC69" +
+	"0F4323A4640EAFB9"
+
+// benchParams lists the parameter sets the benchmarks and the tests that
+// depend on the size of P are run over.
+var benchParams = []struct {
+	name    string
+	p, g, q string
+}{
+	{"1024", benchP1024, benchG1024, benchQ1024},
+	{"2048", testP, testG, testQ},
+	{"3072", benchP3072, benchG3072, benchQ3072},
+}
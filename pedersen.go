@@ -0,0 +1,173 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"math/big"
+)
+
+// PedersenKey is a key for Pedersen commitments to vectors of length up to
+// len(G). The commitment to a with randomness r is H^r G[0]^a[0] ...
+// G[l-1]^a[l-1], which hides a perfectly and binds the committer to a unless
+// it knows a discrete log relation between the generators. The generators are
+// derived with HashToGroup, so nobody knows such a relation.
+type PedersenKey struct {
+	params *KeyParameters
+	H      *big.Int
+	G      []*big.Int
+}
+
+// NewPedersenKey derives a commitment key for vectors of length n from the
+// seed domain. Keys derived from the same domain share their generators, so
+// the domain should identify the protocol that uses the key.
+func (params *KeyParameters) NewPedersenKey(domain string, n int) *PedersenKey {
+	ck := &PedersenKey{params: params, H: params.HashToGroup(domain, 0), G: make([]*big.Int, n)}
+	for i := range ck.G {
+		ck.G[i] = params.HashToGroup(domain, i+1)
+	}
+	return ck
+}
+
+// Commit outputs H^r G[0]^a[0] ... G[l-1]^a[l-1], where l = len(a). It
+// returns an error if a is longer than the key.
+func (ck *PedersenKey) Commit(a []*big.Int, r *big.Int) (*big.Int, error) {
+	if len(a) > len(ck.G) {
+		return nil, errors.New("vector is longer than the commitment key")
+	}
+	return ck.commit(a, r), nil
+}
+
+// commit is like Commit, but the caller must ensure that len(a) <= len(ck.G).
+func (ck *PedersenKey) commit(a []*big.Int, r *big.Int) *big.Int {
+	Z := new(big.Int).Exp(ck.H, r, ck.params.P)
+	var t big.Int
+	for i := range a {
+		t.Exp(ck.G[i], a[i], ck.params.P)
+		Z.Mul(Z, &t)
+		Z.Mod(Z, ck.params.P)
+	}
+	return Z
+}
+
+// CommitScalar outputs the commitment H^r G[0]^a to a single element of Z/q.
+// It returns an error if the key is for vectors of length 0.
+func (ck *PedersenKey) CommitScalar(a, r *big.Int) (*big.Int, error) {
+	return ck.Commit([]*big.Int{a}, r)
+}
+
+// CommitRandom commits to a with fresh randomness, which it outputs as the
+// opening of the commitment along with a.
+func (ck *PedersenKey) CommitRandom(a []*big.Int) (C, r *big.Int, err error) {
+	if len(a) > len(ck.G) {
+		return nil, nil, errors.New("vector is longer than the commitment key")
+	}
+	if r, err = ck.params.Sample(); err != nil {
+		return nil, nil, err
+	}
+	return ck.commit(a, r), r, nil
+}
+
+// Open reports whether (a, r) is an opening of the commitment C.
+func (ck *PedersenKey) Open(C *big.Int, a []*big.Int, r *big.Int) bool {
+	if len(a) > len(ck.G) || !ck.params.areScalars(a...) || !ck.params.areScalars(r) {
+		return false
+	}
+	return C != nil && ck.commit(a, r).Cmp(C) == 0
+}
+
+// Add outputs the product of the commitments C1 and C2, which is a commitment
+// to a1 + a2 with randomness r1 + r2 (mod Q) if (a1, r1) opens C1 and (a2, r2)
+// opens C2. Vectors of different lengths are added as if padded with zeros.
+func (ck *PedersenKey) Add(C1, C2 *big.Int) *big.Int {
+	Z := new(big.Int).Mul(C1, C2)
+	return Z.Mod(Z, ck.params.P)
+}
+
+// PedersenOpeningProof is a non-interactive proof of knowledge of an opening
+// of a Pedersen commitment. T is the prover's commitment and A and R its
+// responses.
+type PedersenOpeningProof struct {
+	T *big.Int
+	A []*big.Int
+	R *big.Int
+}
+
+// openingChallenge derives the challenge for a proof of knowledge of an
+// opening of C to a vector of length l.
+func (ck *PedersenKey) openingChallenge(C, T *big.Int, l int, context []byte) *big.Int {
+	th := ck.params.newTranscriptHash("pedersen opening")
+	th.writeInts(ck.H)
+	th.writeInts(ck.G[:l]...)
+	th.writeInts(C, T)
+	th.writeBytes(context)
+	return th.challenge(ck.params)
+}
+
+// ProveOpening outputs a proof that the prover knows an opening of C =
+// Commit(a, r) without revealing it. The proof is bound to context.
+func (ck *PedersenKey) ProveOpening(a []*big.Int, r *big.Int, context []byte) (*PedersenOpeningProof, error) {
+	if len(a) > len(ck.G) {
+		return nil, errors.New("vector is longer than the commitment key")
+	}
+	params := ck.params
+	wa, err := params.sampleVec(len(a))
+	if err != nil {
+		return nil, err
+	}
+	wr, err := params.Sample()
+	if err != nil {
+		return nil, err
+	}
+	proof := &PedersenOpeningProof{T: ck.commit(wa, wr), A: make([]*big.Int, len(a))}
+	c := ck.openingChallenge(ck.commit(a, r), proof.T, len(a), context)
+	for i := range a {
+		proof.A[i] = new(big.Int).Mul(c, a[i])
+		proof.A[i].Add(proof.A[i], wa[i])
+		proof.A[i].Mod(proof.A[i], params.Q)
+	}
+	proof.R = new(big.Int).Mul(c, r)
+	proof.R.Add(proof.R, wr)
+	proof.R.Mod(proof.R, params.Q)
+	return proof, nil
+}
+
+// VerifyOpening verifies a proof output by ProveOpening for the commitment C.
+func (ck *PedersenKey) VerifyOpening(C *big.Int, proof *PedersenOpeningProof, context []byte) bool {
+	params := ck.params
+	if proof == nil || len(proof.A) > len(ck.G) || !params.areElements(C, proof.T) ||
+		!params.areScalars(proof.A...) || !params.areScalars(proof.R) {
+		return false
+	}
+	c := ck.openingChallenge(C, proof.T, len(proof.A), context)
+	L := new(big.Int).Exp(C, c, params.P)
+	L.Mul(L, proof.T)
+	L.Mod(L, params.P)
+	return L.Cmp(ck.commit(proof.A, proof.R)) == 0
+}
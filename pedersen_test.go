@@ -0,0 +1,138 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// Test that keys are deterministic, that their generators are distinct
+// elements of <G>, and that different domains give different generators.
+func TestNewPedersenKey(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	ck := params.NewPedersenKey("test", 3)
+	again := params.NewPedersenKey("test", 3)
+	other := params.NewPedersenKey("other", 3)
+	gens := append([]*big.Int{ck.H}, ck.G...)
+	for i, X := range gens {
+		if !params.IsElement(X) || X.Cmp(params.G) == 0 {
+			t.Errorf("generator %d is not a fresh element of <G>", i)
+		}
+		for _, Y := range gens[:i] {
+			if X.Cmp(Y) == 0 {
+				t.Errorf("generator %d repeats", i)
+			}
+		}
+	}
+	if ck.H.Cmp(again.H) != 0 || ck.G[2].Cmp(again.G[2]) != 0 {
+		t.Error("NewPedersenKey() is not deterministic")
+	}
+	if ck.H.Cmp(other.H) == 0 || ck.G[0].Cmp(other.G[0]) == 0 {
+		t.Error("NewPedersenKey() outputs the same generators for different domains")
+	}
+}
+
+// Test opening and the homomorphic property.
+func TestPedersenCommit(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	ck := params.NewPedersenKey("test", 3)
+	a1 := []*big.Int{big.NewInt(1), big.NewInt(2), big.NewInt(3)}
+	a2 := []*big.Int{big.NewInt(10), new(big.Int).Sub(params.Q, big.NewInt(1))}
+	C1, r1, err := ck.CommitRandom(a1)
+	if err != nil {
+		t.Fatal("CommitRandom() fails:", err)
+	}
+	C2, r2, err := ck.CommitRandom(a2)
+	if err != nil {
+		t.Fatal("CommitRandom() fails:", err)
+	}
+	if !ck.Open(C1, a1, r1) || !ck.Open(C2, a2, r2) {
+		t.Fatal("Open() rejects a valid opening")
+	}
+	if ck.Open(C1, a2, r1) || ck.Open(C1, a1, r2) {
+		t.Error("Open() accepts an invalid opening")
+	}
+	if _, _, err := ck.CommitRandom(append(a1, a1...)); err == nil {
+		t.Error("CommitRandom() accepts a vector longer than the key")
+	}
+
+	sum := []*big.Int{big.NewInt(11), big.NewInt(1), big.NewInt(3)}
+	r := new(big.Int).Add(r1, r2)
+	r.Mod(r, params.Q)
+	if !ck.Open(ck.Add(C1, C2), sum, r) {
+		t.Error("Add() does not commit to the sum")
+	}
+	Cs, err := ck.CommitScalar(big.NewInt(5), r1)
+	if err != nil {
+		t.Fatal("CommitScalar() fails:", err)
+	}
+	if Cv, _ := ck.Commit([]*big.Int{big.NewInt(5)}, r1); Cs.Cmp(Cv) != 0 {
+		t.Error("CommitScalar() does not match Commit()")
+	}
+	if _, err := ck.Commit(append(a1, a1...), r1); err == nil {
+		t.Error("Commit() accepts a vector longer than the key")
+	}
+	if _, err := params.NewPedersenKey("test", 0).CommitScalar(big.NewInt(5), r1); err == nil {
+		t.Error("CommitScalar() accepts a key for vectors of length 0")
+	}
+}
+
+// Test that proofs of knowledge of an opening verify for the commitment and
+// context they were made for only.
+func TestPedersenOpeningProof(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	ck := params.NewPedersenKey("test", 4)
+	context := []byte("test")
+	a := []*big.Int{big.NewInt(7), big.NewInt(8), big.NewInt(9)}
+	C, r, err := ck.CommitRandom(a)
+	if err != nil {
+		t.Fatal("CommitRandom() fails:", err)
+	}
+	proof, err := ck.ProveOpening(a, r, context)
+	if err != nil {
+		t.Fatal("ProveOpening() fails:", err)
+	}
+	if !ck.VerifyOpening(C, proof, context) {
+		t.Error("VerifyOpening() rejects a valid proof")
+	}
+	if ck.VerifyOpening(C, proof, []byte("other")) {
+		t.Error("VerifyOpening() accepts a proof for another context")
+	}
+	if ck.VerifyOpening(ck.Add(C, ck.H), proof, context) {
+		t.Error("VerifyOpening() accepts a proof for another commitment")
+	}
+	proof.A[0] = new(big.Int).Add(proof.A[0], params.one)
+	if ck.VerifyOpening(C, proof, context) {
+		t.Error("VerifyOpening() accepts a modified proof")
+	}
+	if ck.VerifyOpening(C, nil, context) {
+		t.Error("VerifyOpening() accepts a nil proof")
+	}
+}
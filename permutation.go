@@ -0,0 +1,143 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Permutation is a permutation of [0..n-1], where n = len(p). Applying it to
+// a sequence moves the i-th element to position p[i]; this is the convention
+// of Mix, ReEncryptionMix and the shuffle proofs.
+type Permutation []int
+
+// IdentityPermutation returns the identity permutation of [0..n-1].
+func IdentityPermutation(n int) Permutation {
+	p := make(Permutation, n)
+	for i := range p {
+		p[i] = i
+	}
+	return p
+}
+
+// PermutationError is returned by Validate, and so by Mix and the other
+// functions that take a permutation, when a sequence is not a permutation of
+// [0..N-1]. Index is the first position i at which the sequence is invalid,
+// i.e., Value = p[i] is out of range or repeated, or -1 if the length Len of
+// the sequence is not N.
+type PermutationError struct {
+	Len, N int
+	Index  int
+	Value  int
+}
+
+func (e *PermutationError) Error() string {
+	switch {
+	case e.Index < 0:
+		return fmt.Sprintf("parameter is not a permutation: length %d, expected %d", e.Len, e.N)
+	case e.Value < 0 || e.Value >= e.N:
+		return fmt.Sprintf("parameter is not a permutation: %d maps to %d, out of range", e.Index, e.Value)
+	default:
+		return fmt.Sprintf("parameter is not a permutation: %d maps to %d, which is repeated", e.Index, e.Value)
+	}
+}
+
+// Validate returns a *PermutationError unless p is a permutation of
+// [0..n-1].
+func (p Permutation) Validate(n int) error {
+	if len(p) != n {
+		return &PermutationError{Len: len(p), N: n, Index: -1}
+	}
+	seen := make([]bool, n)
+	for i, j := range p {
+		if j < 0 || j >= n || seen[j] {
+			return &PermutationError{Len: len(p), N: n, Index: i, Value: j}
+		}
+		seen[j] = true
+	}
+	return nil
+}
+
+// Inverse returns the permutation q such that q[p[i]] = i.
+func (p Permutation) Inverse() Permutation {
+	q := make(Permutation, len(p))
+	for i, j := range p {
+		q[j] = i
+	}
+	return q
+}
+
+// Compose returns the permutation that applies p and then q, i.e., that maps
+// i to q[p[i]]. The permutations must have the same length.
+func (p Permutation) Compose(q Permutation) Permutation {
+	r := make(Permutation, len(p))
+	for i, j := range p {
+		r[i] = q[j]
+	}
+	return r
+}
+
+// Cycles returns the decomposition of p into disjoint cycles, including
+// fixed points as cycles of length one. Each cycle (i, p[i], p[p[i]], ...)
+// starts with its least element, and the cycles are ordered by their first
+// element.
+func (p Permutation) Cycles() [][]int {
+	var cycles [][]int
+	seen := make([]bool, len(p))
+	for i := range p {
+		if seen[i] {
+			continue
+		}
+		var cycle []int
+		for j := i; !seen[j]; j = p[j] {
+			seen[j] = true
+			cycle = append(cycle, j)
+		}
+		cycles = append(cycles, cycle)
+	}
+	return cycles
+}
+
+// Apply returns the sequence whose p[i]-th element is X[i]. The permutation
+// must be valid for len(X) (see Validate).
+func (p Permutation) Apply(X []*big.Int) []*big.Int {
+	return Permute(p, X)
+}
+
+// Permute returns the sequence whose p[i]-th element is x[i], for sequences
+// of any type, such as ciphertexts. The permutation must be valid for len(x)
+// (see Validate).
+func Permute[T any](p Permutation, x []T) []T {
+	y := make([]T, len(x))
+	for i := range x {
+		y[p[i]] = x[i]
+	}
+	return y
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+func TestPermutationValidate(t *testing.T) {
+	for _, test := range []struct {
+		p  Permutation
+		n  int
+		ok bool
+	}{
+		{Permutation{}, 0, true},
+		{Permutation{0}, 1, true},
+		{Permutation{2, 0, 1}, 3, true},
+		{Permutation{2, 0, 1}, 4, false},
+		{Permutation{2, 0, 1}, 2, false},
+		{Permutation{0, 0, 1}, 3, false},
+		{Permutation{0, 3, 1}, 3, false},
+		{Permutation{0, -1, 1}, 3, false},
+		{nil, 1, false},
+	} {
+		err := test.p.Validate(test.n)
+		if (err == nil) != test.ok {
+			t.Errorf("%v.Validate(%d) = %v", test.p, test.n, err)
+		}
+		var permErr *PermutationError
+		if err != nil && !errors.As(err, &permErr) {
+			t.Errorf("%v.Validate(%d) returns %T, want *PermutationError", test.p, test.n, err)
+		}
+	}
+}
+
+// Test Inverse and Compose against each other and against Apply.
+func TestPermutationInverseCompose(t *testing.T) {
+	p := Permutation{2, 0, 3, 1}
+	q := Permutation{1, 3, 0, 2}
+	id := IdentityPermutation(4)
+	if got := p.Compose(p.Inverse()); !reflect.DeepEqual(got, id) {
+		t.Errorf("p.Compose(p.Inverse()) = %v, want %v", got, id)
+	}
+	if got := p.Inverse().Compose(p); !reflect.DeepEqual(got, id) {
+		t.Errorf("p.Inverse().Compose(p) = %v, want %v", got, id)
+	}
+	if got, want := p.Compose(q), (Permutation{0, 1, 2, 3}); !reflect.DeepEqual(got, want) {
+		t.Errorf("p.Compose(q) = %v, want %v", got, want)
+	}
+
+	X := []*big.Int{big.NewInt(10), big.NewInt(11), big.NewInt(12), big.NewInt(13)}
+	if got, want := p.Apply(X), []*big.Int{X[1], X[3], X[0], X[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("p.Apply(X) = %v, want %v", got, want)
+	}
+	r := Permutation{3, 2, 0, 1}
+	if got, want := p.Compose(r).Apply(X), r.Apply(p.Apply(X)); !reflect.DeepEqual(got, want) {
+		t.Errorf("p.Compose(r).Apply(X) = %v, want %v", got, want)
+	}
+	if got := p.Inverse().Apply(p.Apply(X)); !reflect.DeepEqual(got, X) {
+		t.Errorf("p.Inverse().Apply(p.Apply(X)) = %v, want %v", got, X)
+	}
+	if got, want := Permute(p, []string{"a", "b", "c", "d"}), []string{"b", "d", "a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Permute(p, ...) = %v, want %v", got, want)
+	}
+}
+
+func TestPermutationCycles(t *testing.T) {
+	for _, test := range []struct {
+		p    Permutation
+		want [][]int
+	}{
+		{Permutation{}, nil},
+		{Permutation{0, 1}, [][]int{{0}, {1}}},
+		{Permutation{1, 2, 0}, [][]int{{0, 1, 2}}},
+		{Permutation{3, 2, 1, 0, 4}, [][]int{{0, 3}, {1, 2}, {4}}},
+	} {
+		if got := test.p.Cycles(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v.Cycles() = %v, want %v", test.p, got, test.want)
+		}
+	}
+}
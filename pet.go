@@ -0,0 +1,237 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// This file implements the plaintext equivalence test (PET) of Jakobsson and
+// Juels (ASIACRYPT 2000), which decides whether two ciphertexts (R1, C1) and
+// (R2, C2) encrypt the same message without revealing anything else about
+// the messages. The quotient (R1/R2, C1/C2) encrypts M1/M2. It is blinded by
+// raising it to a random exponent z, which maps 1 to 1 and any other element
+// of <G> to a uniformly random element of <G>, and then decrypted.
+//
+// Messages output by Encode need not be elements of <G>, in which case
+// neither need their quotient. Since the blinding is sound only within <G>,
+// the test first checks whether C1/C2 is in <G>. If it is not, then M1/M2 is
+// not either, so the messages differ. This is decided publicly, and so reveals
+// that M1/M2 is not in <G> in addition to the result.
+
+// petQuotient outputs the quotient (R1/R2, C1/C2) and whether C1/C2 is an
+// element of <G>.
+func (params *KeyParameters) petQuotient(R1, C1, R2, C2 *big.Int) (Rq, Cq *big.Int, inGroup bool, err error) {
+	if R1 == nil || C1 == nil || R2 == nil || C2 == nil {
+		return nil, nil, false, errors.New("missing value")
+	}
+	if !params.IsElement(R1) || !params.IsElement(R2) {
+		return nil, nil, false, errors.New("R is not an element of <G>")
+	}
+	if Rq, err = inverse(new(big.Int), R2, params.P); err != nil {
+		return nil, nil, false, err
+	}
+	Rq.Mul(Rq, R1)
+	Rq.Mod(Rq, params.P)
+	if Cq, err = inverse(new(big.Int), C2, params.P); err != nil {
+		return nil, nil, false, err
+	}
+	Cq.Mul(Cq, C1)
+	Cq.Mod(Cq, params.P)
+	return Rq, Cq, params.IsElement(Cq), nil
+}
+
+// petContext binds the proofs of a PET blinding to the pair of ciphertexts.
+func (params *KeyParameters) petContext(R1, C1, R2, C2 *big.Int, component string) []byte {
+	th := params.newTranscriptHash("pet " + component)
+	th.writeInts(R1, C1, R2, C2)
+	return th.h.Sum(nil)
+}
+
+// PETBlinding is a party's blinding (Rz, Cz) = (Rq^z, Cq^z) of the quotient
+// (Rq, Cq) of two ciphertexts. Z = G^z commits to the blinding exponent, and
+// ProofR and ProofC show that log_G Z = log_Rq Rz = log_Cq Cz.
+type PETBlinding struct {
+	Z, Rz, Cz      *big.Int
+	ProofR, ProofC *ChaumPedersenProof
+}
+
+// BlindPET outputs a blinding of the quotient of (R1, C1) and (R2, C2). It
+// returns an error if the quotient is not in <G>, in which case the messages
+// differ and no blinding is needed.
+func (params *KeyParameters) BlindPET(R1, C1, R2, C2 *big.Int) (*PETBlinding, error) {
+	Rq, Cq, inGroup, err := params.petQuotient(R1, C1, R2, C2)
+	if err != nil {
+		return nil, err
+	}
+	if !inGroup {
+		return nil, errors.New("quotient is not an element of <G>")
+	}
+	z, err := params.Sample()
+	if err != nil {
+		return nil, err
+	}
+	b := &PETBlinding{
+		Z:  new(big.Int).Exp(params.G, z, params.P),
+		Rz: new(big.Int).Exp(Rq, z, params.P),
+		Cz: new(big.Int).Exp(Cq, z, params.P),
+	}
+	if b.ProofR, err = params.ChaumPedersenProve(z, Rq, params.petContext(R1, C1, R2, C2, "R")); err != nil {
+		return nil, err
+	}
+	if b.ProofC, err = params.ChaumPedersenProve(z, Cq, params.petContext(R1, C1, R2, C2, "C")); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// VerifyPETBlinding verifies a blinding output by BlindPET for the ciphertexts
+// (R1, C1) and (R2, C2).
+func (params *KeyParameters) VerifyPETBlinding(R1, C1, R2, C2 *big.Int, b *PETBlinding) bool {
+	if b == nil || b.Z == nil || b.Rz == nil || b.Cz == nil {
+		return false
+	}
+	Rq, Cq, inGroup, err := params.petQuotient(R1, C1, R2, C2)
+	if err != nil || !inGroup {
+		return false
+	}
+	// A blinding by z = 0 would make any pair look equivalent.
+	if b.Z.Cmp(params.one) == 0 {
+		return false
+	}
+	return params.ChaumPedersenVerify(b.Z, Rq, b.Rz, b.ProofR, params.petContext(R1, C1, R2, C2, "R")) &&
+		params.ChaumPedersenVerify(b.Z, Cq, b.Cz, b.ProofC, params.petContext(R1, C1, R2, C2, "C"))
+}
+
+// CombinePETBlindings verifies the parties' blindings of the quotient of (R1,
+// C1) and (R2, C2) and outputs the product (R, C) of the valid ones, which
+// encrypts 1 if the messages are equal and a random element of <G> otherwise,
+// as long as one of the valid blindings is honest. Invalid and repeated
+// blindings are dropped, so that no party can prevent the test by submitting
+// a bad one. It returns an error if fewer than min valid blindings remain.
+func (params *KeyParameters) CombinePETBlindings(R1, C1, R2, C2 *big.Int, blindings []*PETBlinding, min int) (R, C *big.Int, err error) {
+	if min < 1 {
+		return nil, nil, errors.New("minimum number of blindings must be positive")
+	}
+	R = new(big.Int).Set(params.one)
+	C = new(big.Int).Set(params.one)
+	seen := make(map[string]bool)
+	for _, b := range blindings {
+		if !params.VerifyPETBlinding(R1, C1, R2, C2, b) || seen[b.Z.String()] {
+			continue
+		}
+		seen[b.Z.String()] = true
+		R.Mul(R, b.Rz)
+		R.Mod(R, params.P)
+		C.Mul(C, b.Cz)
+		C.Mod(C, params.P)
+	}
+	if len(seen) < min {
+		return nil, nil, errors.New(fmt.Sprintf("%d valid blindings, need %d", len(seen), min))
+	}
+	return R, C, nil
+}
+
+// PETProof is a proof of the result of a PET by a single key holder: the
+// blinding of the quotient and a proof that the blinded quotient decrypts to
+// M. It is nil if the quotient is not in <G>.
+type PETProof struct {
+	Blinding *PETBlinding
+	M        *big.Int
+	Proof    *ChaumPedersenProof
+}
+
+// PET decides whether (R1, C1) and (R2, C2) encrypt the same message and
+// outputs a proof of the result.
+func (sk *SecretKey) PET(R1, C1, R2, C2 *big.Int) (equal bool, proof *PETProof, err error) {
+	_, _, inGroup, err := sk.petQuotient(R1, C1, R2, C2)
+	if err != nil {
+		return false, nil, err
+	}
+	if !inGroup {
+		return false, nil, nil
+	}
+	proof = new(PETProof)
+	if proof.Blinding, err = sk.BlindPET(R1, C1, R2, C2); err != nil {
+		return false, nil, err
+	}
+	b := proof.Blinding
+	if proof.M, proof.Proof, err = sk.DecryptWithProof(b.Rz, b.Cz); err != nil {
+		return false, nil, err
+	}
+	return proof.M.Cmp(sk.one) == 0, proof, nil
+}
+
+// VerifyPET verifies a proof output by PET that the result of the test on (R1,
+// C1) and (R2, C2) is equal.
+func (pk *PublicKey) VerifyPET(R1, C1, R2, C2 *big.Int, equal bool, proof *PETProof) bool {
+	_, _, inGroup, err := pk.petQuotient(R1, C1, R2, C2)
+	if err != nil {
+		return false
+	}
+	if !inGroup {
+		return !equal
+	}
+	if proof == nil || proof.M == nil || !pk.VerifyPETBlinding(R1, C1, R2, C2, proof.Blinding) {
+		return false
+	}
+	b := proof.Blinding
+	if !pk.VerifyDecryption(b.Rz, b.Cz, proof.M, proof.Proof) {
+		return false
+	}
+	return equal == (proof.M.Cmp(pk.one) == 0)
+}
+
+// PET decides whether (R1, C1) and (R2, C2) encrypt the same message given
+// the trustees' blindings of the quotient and their partial decryptions of the
+// product of the valid blindings (see CombinePETBlindings). Invalid blindings
+// are dropped, and at least T valid ones are required: as long as fewer than T
+// trustees are corrupt, one of them is honest, so the test reveals nothing but
+// its result. Each share is verified, so the result is correct as long as T
+// shares are valid.
+func (tpk *ThresholdPublicKey) PET(R1, C1, R2, C2 *big.Int, blindings []*PETBlinding, shares []*DecryptionShare) (bool, error) {
+	_, _, inGroup, err := tpk.petQuotient(R1, C1, R2, C2)
+	if err != nil {
+		return false, err
+	}
+	if !inGroup {
+		return false, nil
+	}
+	R, C, err := tpk.CombinePETBlindings(R1, C1, R2, C2, blindings, tpk.T)
+	if err != nil {
+		return false, err
+	}
+	M, err := tpk.Decrypt(R, C, shares)
+	if err != nil {
+		return false, err
+	}
+	return M.Cmp(tpk.one) == 0, nil
+}
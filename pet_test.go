@@ -0,0 +1,238 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// testPETPair returns encryptions of a and b as encoded by testGroupEncoder,
+// where the encryption of b is also re-encrypted.
+func testPETPair(t *testing.T, pk *PublicKey, a, b string) (R1, C1, R2, C2 *big.Int) {
+	enc := testGroupEncoder(t, &pk.KeyParameters)
+	M1, err := enc.Encode([]byte(a))
+	if err != nil {
+		t.Fatal("Encode() fails:", err)
+	}
+	M2, err := enc.Encode([]byte(b))
+	if err != nil {
+		t.Fatal("Encode() fails:", err)
+	}
+	R1, C1 = pk.Encrypt(M1)
+	R2, C2 = pk.Encrypt(M2)
+	if R2, C2, err = pk.ReEncrypt(R2, C2); err != nil {
+		t.Fatal("ReEncrypt() fails:", err)
+	}
+	return
+}
+
+// Test the PET on equal and unequal messages.
+func TestPET(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+
+	for _, test := range []struct {
+		a, b  string
+		equal bool
+	}{
+		{"ok", "ok", true},
+		{"ok", "no", false},
+		{"", "", true},
+	} {
+		R1, C1, R2, C2 := testPETPair(t, pk, test.a, test.b)
+		equal, proof, err := sk.PET(R1, C1, R2, C2)
+		if err != nil {
+			t.Fatal("PET() fails:", err)
+		}
+		if equal != test.equal {
+			t.Errorf("PET(%q, %q) = %v, want %v", test.a, test.b, equal, test.equal)
+		}
+		if !pk.VerifyPET(R1, C1, R2, C2, equal, proof) {
+			t.Errorf("VerifyPET(%q, %q) rejects a valid proof", test.a, test.b)
+		}
+		if pk.VerifyPET(R1, C1, R2, C2, !equal, proof) {
+			t.Errorf("VerifyPET(%q, %q) accepts the wrong result", test.a, test.b)
+		}
+	}
+}
+
+// Test that the PET is correct when the quotient of the messages is not in
+// <G>.
+func TestPETOutsideGroup(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	M1 := big.NewInt(1)
+	M2 := new(big.Int).Sub(params.P, params.one) // -1 has order 2.
+	R1, C1 := pk.Encrypt(M1)
+	R2, C2 := pk.Encrypt(M2)
+
+	equal, proof, err := sk.PET(R1, C1, R2, C2)
+	if err != nil {
+		t.Fatal("PET() fails:", err)
+	}
+	if equal {
+		t.Error("PET() reports that 1 and -1 are equal")
+	}
+	if !pk.VerifyPET(R1, C1, R2, C2, false, proof) {
+		t.Error("VerifyPET() rejects a valid result")
+	}
+	if pk.VerifyPET(R1, C1, R2, C2, true, proof) {
+		t.Error("VerifyPET() accepts the wrong result")
+	}
+}
+
+// Test that a blinding by 0, which makes any pair look equivalent, is
+// rejected.
+func TestPETZeroBlinding(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	R1, C1, _ := pk.EncryptExp(big.NewInt(1))
+	R2, C2, _ := pk.EncryptExp(big.NewInt(2))
+
+	zero := new(big.Int)
+	Rq, Cq, _, _ := params.petQuotient(R1, C1, R2, C2)
+	b := &PETBlinding{
+		Z:  new(big.Int).Set(params.one),
+		Rz: new(big.Int).Set(params.one),
+		Cz: new(big.Int).Set(params.one),
+	}
+	b.ProofR, _ = params.ChaumPedersenProve(zero, Rq, params.petContext(R1, C1, R2, C2, "R"))
+	b.ProofC, _ = params.ChaumPedersenProve(zero, Cq, params.petContext(R1, C1, R2, C2, "C"))
+	if params.VerifyPETBlinding(R1, C1, R2, C2, b) {
+		t.Error("VerifyPETBlinding() accepts a blinding by 0")
+	}
+
+	M, proof, _ := sk.DecryptWithProof(b.Rz, b.Cz)
+	if pk.VerifyPET(R1, C1, R2, C2, true, &PETProof{b, M, proof}) {
+		t.Error("VerifyPET() accepts a blinding by 0")
+	}
+}
+
+// Test the threshold PET. The messages are elements of <G>, so that unequal
+// messages are not decided publicly.
+func TestThresholdPET(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	tpk, trustees := testDKG(t, params, 2, 3)
+
+	for _, test := range []struct {
+		a, b  int64
+		equal bool
+	}{
+		{1, 1, true},
+		{1, 2, false},
+	} {
+		R1, C1, _ := tpk.EncryptExp(big.NewInt(test.a))
+		R2, C2, _ := tpk.EncryptExp(big.NewInt(test.b))
+		blindings := make([]*PETBlinding, len(trustees))
+		for j := range trustees {
+			var err error
+			if blindings[j], err = params.BlindPET(R1, C1, R2, C2); err != nil {
+				t.Fatal("BlindPET() fails:", err)
+			}
+		}
+		R, C, err := params.CombinePETBlindings(R1, C1, R2, C2, blindings, tpk.T)
+		if err != nil {
+			t.Fatal("CombinePETBlindings() fails:", err)
+		}
+		var shares []*DecryptionShare
+		for _, tr := range trustees[:2] {
+			share, err := tr.PartialDecrypt([]*big.Int{R}, []*big.Int{C})
+			if err != nil {
+				t.Fatal("PartialDecrypt() fails:", err)
+			}
+			shares = append(shares, share)
+		}
+		equal, err := tpk.PET(R1, C1, R2, C2, blindings, shares)
+		if err != nil {
+			t.Fatal("PET() fails:", err)
+		}
+		if equal != test.equal {
+			t.Errorf("PET(%d, %d) = %v, want %v", test.a, test.b, equal, test.equal)
+		}
+
+		// A blinding for another pair is rejected.
+		R3, C3, _ := tpk.EncryptExp(big.NewInt(test.a))
+		if _, _, err := params.CombinePETBlindings(R3, C3, R2, C2, blindings, tpk.T); err == nil {
+			t.Error("CombinePETBlindings() accepts blindings for another pair")
+		}
+	}
+}
+
+// Test that invalid and repeated blindings are dropped rather than blocking
+// the threshold PET, as long as T valid ones remain.
+func TestThresholdPETBadBlinding(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	tpk, trustees := testDKG(t, params, 2, 3)
+	R1, C1, _ := tpk.EncryptExp(big.NewInt(1))
+	R2, C2, _ := tpk.EncryptExp(big.NewInt(1))
+	R3, C3, _ := tpk.EncryptExp(big.NewInt(1))
+
+	blindings := make([]*PETBlinding, 2)
+	for j := range blindings {
+		var err error
+		if blindings[j], err = params.BlindPET(R1, C1, R2, C2); err != nil {
+			t.Fatal("BlindPET() fails:", err)
+		}
+	}
+	bad, err := params.BlindPET(R3, C3, R2, C2) // For another pair.
+	if err != nil {
+		t.Fatal("BlindPET() fails:", err)
+	}
+
+	// The third trustee submits a bad blinding.
+	withBad := []*PETBlinding{blindings[0], bad, blindings[1], nil}
+	R, C, err := params.CombinePETBlindings(R1, C1, R2, C2, withBad, tpk.T)
+	if err != nil {
+		t.Fatal("CombinePETBlindings() fails:", err)
+	}
+	R0, C0, _ := params.CombinePETBlindings(R1, C1, R2, C2, blindings, tpk.T)
+	if R.Cmp(R0) != 0 || C.Cmp(C0) != 0 {
+		t.Error("CombinePETBlindings() does not drop the bad blinding")
+	}
+	var shares []*DecryptionShare
+	for _, tr := range trustees[:2] {
+		share, err := tr.PartialDecrypt([]*big.Int{R}, []*big.Int{C})
+		if err != nil {
+			t.Fatal("PartialDecrypt() fails:", err)
+		}
+		shares = append(shares, share)
+	}
+	if equal, err := tpk.PET(R1, C1, R2, C2, withBad, shares); err != nil {
+		t.Fatal("PET() fails:", err)
+	} else if !equal {
+		t.Error("PET() = false, want true")
+	}
+
+	// A repeated blinding does not count towards the threshold.
+	repeated := []*PETBlinding{blindings[0], blindings[0], bad}
+	if _, _, err := params.CombinePETBlindings(R1, C1, R2, C2, repeated, tpk.T); err == nil {
+		t.Error("CombinePETBlindings() counts a repeated blinding twice")
+	}
+}
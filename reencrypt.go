@@ -0,0 +1,399 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// DefaultShuffleRounds is the number of rounds of the re-encryption shuffle
+// proof recommended for use. A cheating prover is caught except with
+// probability 2^-rounds.
+const DefaultShuffleRounds = 80
+
+// ReEncrypt re-randomizes the ElGamal ciphertext (R, C) by multiplying it by
+// a fresh encryption of 1. The output decrypts to the same plaintext as the
+// input, but is unlinkable to it without the secret key.
+//
+// Both R and C must be elements of <G>, i.e., the plaintext must be too.
+// Otherwise ReEncrypt returns an error. Messages can be encoded in <G> with a
+// GroupEncoder, but only up to 4 bytes of them, since decoding computes a
+// discrete logarithm. Longer messages must be split across the elements of a
+// vector ciphertext (see EncryptVectorElements).
+func (pk *PublicKey) ReEncrypt(R, C *big.Int) (R2, C2 *big.Int, err error) {
+	if err := pk.checkGroupCiphertext(R, C); err != nil {
+		return nil, nil, err
+	}
+	s, err := pk.Sample()
+	if err != nil {
+		return nil, nil, err
+	}
+	R2, C2 = pk.reEncrypt(R, C, s)
+	return R2, C2, nil
+}
+
+// checkGroupCiphertext returns an error unless R and C are elements of <G>.
+// Re-encryption multiplies R and C by elements of <G>, so it leaves their
+// projections R^Q and C^Q onto the rest of Z/p^* unchanged. These are trivial
+// only if R and C are in <G>; otherwise they link the output of a
+// re-encryption to its input.
+func (params *KeyParameters) checkGroupCiphertext(R, C *big.Int) error {
+	if !params.IsElement(R) {
+		return errors.New("R is not an element of <G>")
+	}
+	if !params.IsElement(C) {
+		return errors.New("C is not an element of <G>")
+	}
+	return nil
+}
+
+// checkGroupCiphertexts returns a *CiphertextError unless every ciphertext
+// (R[i], C[i]) passes checkGroupCiphertext. R and C must have the same length.
+func (params *KeyParameters) checkGroupCiphertexts(R, C []*big.Int) error {
+	for i := range R {
+		if err := params.checkGroupCiphertext(R[i], C[i]); err != nil {
+			return &CiphertextError{i, err}
+		}
+	}
+	return nil
+}
+
+// reEncrypt outputs (R G^s, C Y^s).
+func (pk *PublicKey) reEncrypt(R, C, s *big.Int) (R2, C2 *big.Int) {
+	R2 = new(big.Int).Exp(pk.G, s, pk.P)
+	R2.Mul(R2, R)
+	R2.Mod(R2, pk.P)
+	C2 = new(big.Int).Exp(pk.Y, s, pk.P)
+	C2.Mul(C2, C)
+	C2.Mod(C2, pk.P)
+	return
+}
+
+// ReEncryptionMix re-encrypts the sequence of ElGamal ciphertexts {(R[i],
+// C[i])} and applies the specified permutation, so that the re-encryption of
+// the i-th input is the perm[i]-th output. Unlike Mix, it does not need the
+// secret key, so a batch can pass through several mix servers before it is
+// decrypted.
+//
+// It also outputs the randomness used to re-encrypt each input, which the
+// mix server needs in order to prove the shuffle with
+// ReEncryptionShuffleProve and must otherwise keep secret.
+//
+// It returns a *CiphertextError if a component of a ciphertext is not an
+// element of <G>. As for ReEncrypt, this limits the plaintexts to the 4-byte
+// messages of a GroupEncoder.
+func (pk *PublicKey) ReEncryptionMix(R, C []*big.Int, perm Permutation) (R2, C2, rands []*big.Int, err error) {
+	if len(R) != len(C) {
+		return nil, nil, nil, &LengthError{len(R), len(C)}
+	}
+	if err := perm.Validate(len(R)); err != nil {
+		return nil, nil, nil, err
+	}
+	if err := pk.checkGroupCiphertexts(R, C); err != nil {
+		return nil, nil, nil, err
+	}
+
+	R2 = make([]*big.Int, len(R))
+	C2 = make([]*big.Int, len(R))
+	rands = make([]*big.Int, len(R))
+	for i := range R {
+		if rands[i], err = pk.Sample(); err != nil {
+			return nil, nil, nil, err
+		}
+		R2[perm[i]], C2[perm[i]] = pk.reEncrypt(R[i], C[i], rands[i])
+	}
+	return R2, C2, rands, nil
+}
+
+// ReEncryptionShuffleProve implements the prover role in an interactive proof
+// that (R2, C2) is a re-encryption shuffle of (R, C), i.e., that there exist a
+// permutation perm and randomness rands such that (R2[perm[i]], C2[perm[i]])
+// = (R[i] G^rands[i], C[i] Y^rands[i]) for every i. The inputs perm and rands
+// are the prover's witness as output by ReEncryptionMix. It uses the same
+// transport as ILMPProve.
+//
+// The proof is the cut-and-choose protocol of Sako and Kilian (EUROCRYPT
+// 1995), with the rounds run in parallel:
+//
+//	P1. For each round j, re-encrypt and shuffle (R, C) under a fresh
+//	    permutation phi_j and randomness t_j, and send the result E_j.
+//	V1. Send a random bit b_j for each round.
+//	P2. If b_j = 0, open the shuffle from (R, C) to E_j by sending (phi_j,
+//	    t_j). Otherwise, open the shuffle from E_j to (R2, C2) by sending
+//	    (perm o phi_j^-1, rands - t_j).
+//	V2. Accept if every opened shuffle is correct.
+//
+// Each opening on its own is uniformly distributed, which makes the protocol
+// zero-knowledge. If (R2, C2) is not a shuffle of (R, C), then for each round
+// E_j can be opened correctly for at most one of the two challenges, so a
+// cheating prover is caught except with probability 2^-rounds.
+//
+// Every component of (R, C) and (R2, C2) must be an element of <G> (see
+// ReEncrypt); the prover aborts otherwise.
+func (pk *PublicKey) ReEncryptionShuffleProve(R, C, R2, C2 []*big.Int, perm Permutation, rands []*big.Int, rounds int, msg chan []big.Int) error {
+	if err := pk.checkShuffleElements(R, C, R2, C2); err != nil {
+		msg <- nil
+		return err
+	}
+	return pk.reEncryptionShuffleProve(R, C, R2, C2, 1, perm, rands, rounds, msg)
+}
+
+// reEncryptionShuffleProve implements the prover role of the re-encryption
+// shuffle proof for sequences of vectors of width k. The vector i consists of
+// the ciphertexts k*i, ..., k*i+k-1 of (R, C), and perm permutes the vectors.
+func (pk *PublicKey) reEncryptionShuffleProve(R, C, R2, C2 []*big.Int, k int, perm Permutation, rands []*big.Int, rounds int, msg chan []big.Int) error {
+	L := len(R)
+	if len(C) != L || len(R2) != L || len(C2) != L || len(rands) != L {
+		msg <- nil
+		return errors.New("input lengths do not match")
+	}
+	if k < 1 || L%k != 0 {
+		msg <- nil
+		return errors.New("input length is not a multiple of the width")
+	}
+	N := L / k
+	if err := perm.Validate(N); err != nil {
+		msg <- nil
+		return err
+	}
+	if rounds < 1 {
+		msg <- nil
+		return errors.New("number of rounds must be positive")
+	}
+
+	// P1
+	phi := make([]Permutation, rounds)
+	t := make([][]*big.Int, rounds)
+	E := make([]big.Int, 2*L*rounds)
+	for j := 0; j < rounds; j++ {
+		var err error
+		if phi[j], err = GeneratePerm(N); err != nil {
+			msg <- nil
+			return err
+		}
+		t[j] = make([]*big.Int, L)
+		ER, EC := E[2*L*j:2*L*j+L], E[2*L*j+L:2*L*(j+1)]
+		for i := 0; i < L; i++ {
+			if t[j][i], err = pk.Sample(); err != nil {
+				msg <- nil
+				return err
+			}
+			Ri, Ci := pk.reEncrypt(R[i], C[i], t[j][i])
+			h := phi[j][i/k]*k + i%k
+			ER[h].Set(Ri)
+			EC[h].Set(Ci)
+		}
+	}
+	msg <- E
+
+	// V1
+	b := <-msg
+	if b == nil {
+		return errors.New("channel closed by peer (V1)")
+	}
+	if len(b) != rounds {
+		msg <- nil
+		return errors.New(fmt.Sprintf("got %d challenges, expected %d", len(b), rounds))
+	}
+
+	// P2
+	n := N + L
+	open := make([]big.Int, n*rounds)
+	for j := 0; j < rounds; j++ {
+		psi, u := open[n*j:n*j+N], open[n*j+N:n*(j+1)]
+		switch b[j].Int64() {
+		case 0:
+			for i := 0; i < N; i++ {
+				psi[i].SetInt64(int64(phi[j][i]))
+			}
+			for i := 0; i < L; i++ {
+				u[i].Set(t[j][i])
+			}
+		case 1:
+			for i, h := range phi[j].Inverse().Compose(perm) {
+				psi[i].SetInt64(int64(h))
+			}
+			for i := 0; i < L; i++ {
+				h := phi[j][i/k]*k + i%k
+				u[h].Sub(rands[i], t[j][i])
+				u[h].Mod(&u[h], pk.Q)
+			}
+		default:
+			msg <- nil
+			return errors.New(fmt.Sprintf("challenge %d is not a bit", j))
+		}
+	}
+	msg <- open
+
+	return nil
+}
+
+// ReEncryptionShuffleVerify implements the verifier role in the interactive
+// proof that (R2, C2) is a re-encryption shuffle of (R, C). It takes as input
+// the public sequences and the number of rounds. It rejects the proof unless
+// every component of (R, C) and (R2, C2) is an element of <G>.
+func (pk *PublicKey) ReEncryptionShuffleVerify(R, C, R2, C2 []*big.Int, rounds int, msg chan []big.Int) (bool, error) {
+	if err := pk.checkShuffleElements(R, C, R2, C2); err != nil {
+		msg <- nil
+		return false, err
+	}
+	return pk.reEncryptionShuffleVerify(R, C, R2, C2, 1, rounds, msg)
+}
+
+// checkShuffleElements returns an error unless the inputs (R, C) and outputs
+// (R2, C2) of a re-encryption shuffle have the same length and consist of
+// elements of <G>.
+func (params *KeyParameters) checkShuffleElements(R, C, R2, C2 []*big.Int) error {
+	L := len(R)
+	if len(C) != L || len(R2) != L || len(C2) != L {
+		return errors.New("input lengths do not match")
+	}
+	if err := params.checkGroupCiphertexts(R, C); err != nil {
+		return errors.New(fmt.Sprintf("input %v", err))
+	}
+	if err := params.checkGroupCiphertexts(R2, C2); err != nil {
+		return errors.New(fmt.Sprintf("output %v", err))
+	}
+	return nil
+}
+
+// reEncryptionShuffleVerify implements the verifier role of the re-encryption
+// shuffle proof for sequences of vectors of width k.
+func (pk *PublicKey) reEncryptionShuffleVerify(R, C, R2, C2 []*big.Int, k, rounds int, msg chan []big.Int) (bool, error) {
+	L := len(R)
+	if len(C) != L || len(R2) != L || len(C2) != L {
+		msg <- nil
+		return false, errors.New("input lengths do not match")
+	}
+	if k < 1 || L%k != 0 {
+		msg <- nil
+		return false, errors.New("input length is not a multiple of the width")
+	}
+	if rounds < 1 {
+		msg <- nil
+		return false, errors.New("number of rounds must be positive")
+	}
+
+	// P1
+	E := <-msg
+	if E == nil {
+		return false, errors.New("channel closed by peer (P1)")
+	}
+
+	// V1
+	b := make([]big.Int, rounds)
+	coins := make([]byte, (rounds+7)/8)
+	if _, err := readRand(coins); err != nil {
+		msg <- nil
+		return false, err
+	}
+	for j := 0; j < rounds; j++ {
+		b[j].SetUint64(uint64(coins[j/8]>>uint(j%8)) & 1)
+	}
+	msg <- b
+
+	// P2
+	open := <-msg
+	if open == nil {
+		return false, errors.New("channel closed by peer (P2)")
+	}
+
+	// V2
+	return pk.reEncryptionShuffleCheck(R, C, R2, C2, k, E, b, open), nil
+}
+
+// reEncryptionShuffleCheck checks the prover's messages E and open of the
+// re-encryption shuffle proof for vectors of width k given the challenges b.
+func (pk *PublicKey) reEncryptionShuffleCheck(R, C, R2, C2 []*big.Int, k int, E, b, open []big.Int) bool {
+	L, rounds := len(R), len(b)
+	if k < 1 || L%k != 0 {
+		return false
+	}
+	N, n := L/k, L/k+L
+	if len(E) != 2*L*rounds || len(open) != n*rounds {
+		return false
+	}
+	for j := 0; j < rounds; j++ {
+		ER, EC := ptrs(E[2*L*j:2*L*j+L]), ptrs(E[2*L*j+L:2*L*(j+1)])
+		psi, u := open[n*j:n*j+N], ptrs(open[n*j+N:n*(j+1)])
+		perm := make(Permutation, N)
+		for i := 0; i < N; i++ {
+			if !psi[i].IsInt64() || psi[i].Int64() < 0 || psi[i].Int64() >= int64(N) {
+				return false
+			}
+			perm[i] = int(psi[i].Int64())
+		}
+		var ok bool
+		switch b[j].Int64() {
+		case 0:
+			ok = pk.isReEncryptionShuffle(R, C, ER, EC, k, perm, u)
+		case 1:
+			ok = pk.isReEncryptionShuffle(ER, EC, R2, C2, k, perm, u)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// isReEncryptionShuffle reports whether perm is a permutation of the vectors
+// of width k and (R2[h], C2[h]) = (R[i] G^u[i], C[i] Y^u[i]) for every i,
+// where h is the position of i after moving vector i/k to position
+// perm[i/k].
+func (pk *PublicKey) isReEncryptionShuffle(R, C, R2, C2 []*big.Int, k int, perm Permutation, u []*big.Int) bool {
+	if perm.Validate(len(R)/k) != nil {
+		return false
+	}
+	for i := range R {
+		h := perm[i/k]*k + i%k
+		if R[i] == nil || C[i] == nil || R2[h] == nil || C2[h] == nil {
+			return false
+		}
+		if u[i].Sign() < 0 || u[i].Cmp(pk.Q) >= 0 {
+			return false
+		}
+		Ri, Ci := pk.reEncrypt(R[i], C[i], u[i])
+		if Ri.Cmp(R2[h]) != 0 || Ci.Cmp(C2[h]) != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ptrs returns pointers to the elements of a message.
+func ptrs(msg []big.Int) []*big.Int {
+	out := make([]*big.Int, len(msg))
+	for i := range msg {
+		out[i] = &msg[i]
+	}
+	return out
+}
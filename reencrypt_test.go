@@ -0,0 +1,291 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"strconv"
+	"testing"
+)
+
+// Number of rounds of the re-encryption shuffle proof used for testing.
+const testShuffleRounds = 20
+
+// testCiphertexts returns a key pair and the encryptions of the messages "1",
+// ..., "N" as encoded by testGroupEncoder.
+func testCiphertexts(t *testing.T, params *KeyParameters, N int) (pk *PublicKey, sk *SecretKey, R, C []*big.Int) {
+	pk, sk = params.GenerateKeys()
+	enc := testGroupEncoder(t, params)
+	R = make([]*big.Int, N)
+	C = make([]*big.Int, N)
+	for i := 0; i < N; i++ {
+		X, err := enc.Encode([]byte(strconv.Itoa(i + 1)))
+		if err != nil {
+			t.Fatal("Encode() fails:", err)
+		}
+		R[i], C[i] = pk.Encrypt(X)
+	}
+	return
+}
+
+// Test that re-encryption preserves the plaintext.
+func TestReEncrypt(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk, R, C := testCiphertexts(t, params, 1)
+
+	R2, C2, err := pk.ReEncrypt(R[0], C[0])
+	if err != nil {
+		t.Fatal("ReEncrypt() fails:", err)
+	}
+	if R2.Cmp(R[0]) == 0 || C2.Cmp(C[0]) == 0 {
+		t.Error("ReEncrypt() did not change the ciphertext")
+	}
+	if sk.Decrypt(R2, C2).Cmp(sk.Decrypt(R[0], C[0])) != 0 {
+		t.Error("ReEncrypt() changed the plaintext")
+	}
+}
+
+// Test that the outputs of the re-encryption mix are the permuted inputs.
+func TestReEncryptionMix(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 10
+	pk, sk, R, C := testCiphertexts(t, params, N)
+
+	enc := testGroupEncoder(t, params)
+	perm := testPerm(t, N)
+	R2, C2, _, err := pk.ReEncryptionMix(R, C, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMix() fails:", err)
+	}
+	for i := 0; i < N; i++ {
+		msg, err := enc.Decode(sk.Decrypt(R2[perm[i]], C2[perm[i]]))
+		if err != nil {
+			t.Fatal("Decode() fails:", err)
+		}
+		if string(msg) != strconv.Itoa(i+1) {
+			t.Errorf("output %d is %q, expected %q", perm[i], msg, strconv.Itoa(i+1))
+		}
+	}
+
+	if _, _, _, err := pk.ReEncryptionMix(R, C, []int{0, 0, 1, 2, 3, 4, 5, 6, 7, 8}); err == nil {
+		t.Error("ReEncryptionMix() succeeds with a non-permutation: expected error")
+	}
+	if _, _, _, err := pk.ReEncryptionMix(R, C[1:], perm); err == nil {
+		t.Error("ReEncryptionMix() succeeds with mismatched lengths: expected error")
+	}
+}
+
+// Test the proof of a re-encryption shuffle.
+func TestReEncryptionShuffleProveVerify(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	for _, N := range []int{1, 2, 5} {
+		pk, _, R, C := testCiphertexts(t, params, N)
+		perm := testPerm(t, N)
+		R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+		if err != nil {
+			t.Fatal("ReEncryptionMix() fails:", err)
+		}
+
+		msg := make(chan []big.Int)
+		go func() {
+			if err := pk.ReEncryptionShuffleProve(R, C, R2, C2, perm, rands, testShuffleRounds, msg); err != nil {
+				t.Errorf("%d: prover: %s", N, err)
+			}
+		}()
+
+		if ok, err := pk.ReEncryptionShuffleVerify(R, C, R2, C2, testShuffleRounds, msg); err != nil {
+			t.Errorf("%d: verifier: %s", N, err)
+		} else if !ok {
+			t.Errorf("%d: failed to verify", N)
+		}
+	}
+}
+
+// Test that the proof fails if one of the outputs is replaced.
+func TestBadReEncryptionShuffleProveVerify(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 5
+	pk, _, R, C := testCiphertexts(t, params, N)
+	perm := testPerm(t, N)
+	R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMix() fails:", err)
+	}
+
+	X, _ := testGroupEncoder(t, params).Encode([]byte("M"))
+	R2[2], C2[2] = pk.Encrypt(X) // Bad!!
+
+	msg := make(chan []big.Int)
+	go func() {
+		if err := pk.ReEncryptionShuffleProve(R, C, R2, C2, perm, rands, testShuffleRounds, msg); err != nil {
+			t.Errorf("prover: %s", err)
+		}
+	}()
+
+	if ok, err := pk.ReEncryptionShuffleVerify(R, C, R2, C2, testShuffleRounds, msg); err != nil {
+		t.Errorf("verifier: %s", err)
+	} else if ok {
+		t.Error("verification succeeded, expected failure")
+	}
+}
+
+// Test that the prover and verifier refuse mismatched inputs.
+func TestReEncryptionShuffleMismatch(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 3
+	pk, _, R, C := testCiphertexts(t, params, N)
+	perm := testPerm(t, N)
+	R2, C2, rands, _ := pk.ReEncryptionMix(R, C, perm)
+
+	msg := make(chan []big.Int)
+	done := make(chan error)
+	go func() {
+		done <- pk.ReEncryptionShuffleProve(R, C, R2, C2[1:], perm, rands, testShuffleRounds, msg)
+	}()
+	if _, err := pk.ReEncryptionShuffleVerify(R, C, R2, C2, testShuffleRounds, msg); err == nil {
+		t.Error("verifier succeeds: expected error")
+	}
+	if err := <-done; err == nil {
+		t.Error("prover succeeds: expected error")
+	}
+}
+
+// Test that the prover aborts, rather than leaving the verifier waiting, if
+// it gets the wrong number of challenges.
+func TestReEncryptionShuffleRoundsMismatch(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 3
+	pk, _, R, C := testCiphertexts(t, params, N)
+	perm := testPerm(t, N)
+	R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMix() fails:", err)
+	}
+
+	msg := make(chan []big.Int)
+	done := make(chan error)
+	go func() {
+		done <- pk.ReEncryptionShuffleProve(R, C, R2, C2, perm, rands, testShuffleRounds, msg)
+	}()
+	if _, err := pk.ReEncryptionShuffleVerify(R, C, R2, C2, testShuffleRounds+1, msg); err == nil {
+		t.Error("verifier succeeds: expected error")
+	}
+	if err := <-done; err == nil {
+		t.Error("prover succeeds: expected error")
+	}
+}
+
+// Test that re-encryption rejects ciphertexts outside of <G>, such as
+// encryptions of the output of Encode.
+func TestReEncryptOutsideGroup(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 3
+	pk, _, R, C := testCiphertexts(t, params, N)
+	perm := testPerm(t, N)
+	R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMix() fails:", err)
+	}
+
+	X, err := params.Encode([]byte("1"))
+	if err != nil {
+		t.Fatal("Encode() fails:", err)
+	}
+	if params.IsElement(X) {
+		t.Skip("Encode() output is in <G>")
+	}
+	RX, CX := pk.Encrypt(X)
+	if _, _, err := pk.ReEncrypt(RX, CX); err == nil {
+		t.Error("ReEncrypt() succeeds for C not in <G>: expected error")
+	}
+	if _, _, err := pk.ReEncrypt(CX, R[0]); err == nil {
+		t.Error("ReEncrypt() succeeds for R not in <G>: expected error")
+	}
+
+	Cbad := append([]*big.Int{}, C...)
+	Cbad[1] = CX
+	_, _, _, err = pk.ReEncryptionMix(R, Cbad, perm)
+	if e, ok := err.(*CiphertextError); !ok || e.Index != 1 {
+		t.Errorf("ReEncryptionMix() = %v, want a *CiphertextError for index 1", err)
+	}
+
+	// The prover and verifier each refuse a statement outside <G>.
+	for _, test := range []struct {
+		name         string
+		R, C, R2, C2 []*big.Int
+	}{
+		{"input", R, Cbad, R2, C2},
+		{"output", R, C, R2, Cbad},
+	} {
+		msg := make(chan []big.Int)
+		go func() { <-msg }()
+		if err := pk.ReEncryptionShuffleProve(test.R, test.C, test.R2, test.C2, perm, rands, testShuffleRounds, msg); err == nil {
+			t.Errorf("%s: prover succeeds: expected error", test.name)
+		}
+		go func() { <-msg }()
+		if ok, err := pk.ReEncryptionShuffleVerify(test.R, test.C, test.R2, test.C2, testShuffleRounds, msg); ok || err == nil {
+			t.Errorf("%s: verifier = %v, %v: expected error", test.name, ok, err)
+		}
+	}
+}
+
+// Test that the projection C^Q onto the complement of <G>, which is invariant
+// under re-encryption, does not link the outputs of a re-encryption mix to its
+// inputs: it is trivial for every accepted ciphertext.
+func TestReEncryptionMixUnlinkable(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 5
+	pk, _, R, C := testCiphertexts(t, params, N)
+	R2, C2, _, err := pk.ReEncryptionMix(R, C, testPerm(t, N))
+	if err != nil {
+		t.Fatal("ReEncryptionMix() fails:", err)
+	}
+	tag := func(X *big.Int) string {
+		return new(big.Int).Exp(X, params.Q, params.P).String()
+	}
+	for i := 0; i < N; i++ {
+		for _, X := range []*big.Int{R[i], C[i], R2[i], C2[i]} {
+			if tag(X) != "1" {
+				t.Fatalf("ciphertext %d has a nontrivial projection", i)
+			}
+		}
+	}
+
+	// By contrast, with the output of Encode the projection survives
+	// re-encryption and identifies the ciphertext.
+	X, _ := params.Encode([]byte("1"))
+	RX, CX := pk.Encrypt(X)
+	_, CY := pk.reEncrypt(RX, CX, big.NewInt(1234))
+	if tag(CX) == "1" {
+		t.Skip("Encode() output is in <G>")
+	}
+	if tag(CY) != tag(CX) {
+		t.Error("re-encryption changed C^Q")
+	}
+}
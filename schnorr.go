@@ -0,0 +1,183 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// IsElement reports whether Y is an element of <G>, i.e., 0 < Y < P and
+// Y^Q = 1 mod P.
+func (params *KeyParameters) IsElement(Y *big.Int) bool {
+	if Y == nil || Y.Sign() <= 0 || Y.Cmp(params.P) >= 0 {
+		return false
+	}
+	return new(big.Int).Exp(Y, params.Q, params.P).Cmp(params.one) == 0
+}
+
+// SchnorrProve implements the prover role in Schnorr's interactive proof of
+// knowledge of x = log_G Y. It uses the same transport as ILMPProve.
+//
+// A mix server can use it to prove it knows the secret key behind its public
+// key, which rules out rogue-key attacks when keys are combined.
+func (params *KeyParameters) SchnorrProve(x *big.Int, msg chan []big.Int) error {
+	// P1
+	k, err := params.Sample()
+	if err != nil {
+		msg <- nil
+		return err
+	}
+	T := make([]big.Int, 1)
+	T[0].Exp(params.G, k, params.P)
+	msg <- T
+
+	// V1
+	c := <-msg
+	if c == nil {
+		return errors.New("channel closed by peer (V1)")
+	}
+	if len(c) != 1 {
+		msg <- nil
+		return errors.New(fmt.Sprintf("challenge has length %d (V1)", len(c)))
+	}
+
+	// P2
+	s := make([]big.Int, 1)
+	s[0].Mul(&c[0], x)
+	s[0].Add(&s[0], k)
+	s[0].Mod(&s[0], params.Q)
+	msg <- s
+
+	return nil
+}
+
+// SchnorrVerify implements the verifier role in Schnorr's interactive proof of
+// knowledge of log_G Y.
+func (params *KeyParameters) SchnorrVerify(Y *big.Int, msg chan []big.Int) (bool, error) {
+	// P1
+	T := <-msg
+	if T == nil {
+		return false, errors.New("channel closed by peer (P1)")
+	}
+
+	// V1
+	c := make([]big.Int, 1)
+	t, err := params.Sample()
+	if err != nil {
+		msg <- nil
+		return false, err
+	}
+	c[0].Set(t)
+	msg <- c
+
+	// P2
+	s := <-msg
+	if s == nil {
+		return false, errors.New("channel closed by peer (P2)")
+	}
+
+	// V2
+	if len(T) != 1 || len(s) != 1 {
+		return false, nil
+	}
+	return params.schnorrCheck(Y, &T[0], &c[0], &s[0]), nil
+}
+
+// schnorrCheck checks that Y is an element of <G>, that s is in Z/q, and that
+// G^s = T Y^c. Without the range check, s + Q would pass for s.
+func (params *KeyParameters) schnorrCheck(Y, T, c, s *big.Int) bool {
+	if !params.IsElement(Y) || !params.IsElement(T) || !params.areScalars(s) {
+		return false
+	}
+	var L, R big.Int
+	L.Exp(params.G, s, params.P)
+	R.Exp(Y, c, params.P)
+	R.Mul(&R, T)
+	R.Mod(&R, params.P)
+	return L.Cmp(&R) == 0
+}
+
+// SchnorrProof is a non-interactive proof of knowledge of a discrete log
+// obtained by applying the Fiat-Shamir transform to Schnorr's protocol. T is
+// the prover's commitment and S its response.
+type SchnorrProof struct {
+	T, S *big.Int
+}
+
+// schnorrChallenge derives the challenge for the non-interactive proof from Y,
+// the commitment T, and the context.
+func (params *KeyParameters) schnorrChallenge(Y, T *big.Int, context []byte) *big.Int {
+	th := params.newTranscriptHash("schnorr")
+	th.writeInts(Y, T)
+	th.writeBytes(context)
+	return th.challenge(params)
+}
+
+// SchnorrProveNI outputs a non-interactive proof of knowledge of x = log_G Y.
+// The proof is bound to context, which should identify the prover and the
+// purpose of the proof (e.g., the mix server's name and the election) so that
+// it cannot be replayed elsewhere.
+func (params *KeyParameters) SchnorrProveNI(x *big.Int, context []byte) (*SchnorrProof, error) {
+	k, err := params.Sample()
+	if err != nil {
+		return nil, err
+	}
+	Y := new(big.Int).Exp(params.G, x, params.P)
+	proof := new(SchnorrProof)
+	proof.T = new(big.Int).Exp(params.G, k, params.P)
+	c := params.schnorrChallenge(Y, proof.T, context)
+	proof.S = c.Mul(c, x)
+	proof.S.Add(proof.S, k)
+	proof.S.Mod(proof.S, params.Q)
+	return proof, nil
+}
+
+// SchnorrVerifyNI verifies a non-interactive proof of knowledge of log_G Y
+// bound to context.
+func (params *KeyParameters) SchnorrVerifyNI(Y *big.Int, proof *SchnorrProof, context []byte) bool {
+	if proof == nil || proof.T == nil || proof.S == nil {
+		return false
+	}
+	c := params.schnorrChallenge(Y, proof.T, context)
+	return params.schnorrCheck(Y, proof.T, c, proof.S)
+}
+
+// ProveKnowledge outputs a non-interactive proof that the holder of sk knows
+// the secret key X behind the public key G^X.
+func (sk *SecretKey) ProveKnowledge(context []byte) (*SchnorrProof, error) {
+	return sk.SchnorrProveNI(sk.X, context)
+}
+
+// VerifyKnowledge verifies a proof output by ProveKnowledge for the secret key
+// corresponding to pk.
+func (pk *PublicKey) VerifyKnowledge(proof *SchnorrProof, context []byte) bool {
+	return pk.SchnorrVerifyNI(pk.Y, proof, context)
+}
@@ -0,0 +1,146 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// Test the interactive proof of knowledge of the secret key.
+func TestSchnorrProveVerify(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+
+	msg := make(chan []big.Int)
+	go func() {
+		if err := params.SchnorrProve(sk.X, msg); err != nil {
+			t.Errorf("prover: %s", err)
+		}
+	}()
+
+	if ok, err := params.SchnorrVerify(pk.Y, msg); err != nil {
+		t.Errorf("verifier: %s", err)
+	} else if !ok {
+		t.Error("failed to verify")
+	}
+}
+
+// Test that a prover who does not know the secret key is rejected.
+func TestBadSchnorrProveVerify(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, _ := params.GenerateKeys()
+	_, sk := params.GenerateKeys() // Bad!!
+
+	msg := make(chan []big.Int)
+	go func() {
+		if err := params.SchnorrProve(sk.X, msg); err != nil {
+			t.Errorf("prover: %s", err)
+		}
+	}()
+
+	if ok, err := params.SchnorrVerify(pk.Y, msg); err != nil {
+		t.Errorf("verifier: %s", err)
+	} else if ok {
+		t.Error("verification succeeded, expected failure")
+	}
+}
+
+// Test that the prover refuses a challenge of the wrong length.
+func TestSchnorrMalformedChallenge(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	_, sk := params.GenerateKeys()
+
+	msg := make(chan []big.Int)
+	done := make(chan error)
+	go func() {
+		done <- params.SchnorrProve(sk.X, msg)
+	}()
+	<-msg
+	msg <- []big.Int{}
+	if s := <-msg; s != nil {
+		t.Error("prover responds: expected nil")
+	}
+	if err := <-done; err == nil {
+		t.Error("prover succeeds: expected error")
+	}
+}
+
+// Test that public keys outside of <G> are rejected, even if the prover knows
+// their discrete log with respect to G.
+func TestSchnorrNotElement(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	x, _ := params.Sample()
+	for _, Y := range []*big.Int{
+		new(big.Int),
+		new(big.Int).Set(params.P),
+		new(big.Int).Sub(params.P, params.one), // Order 2.
+	} {
+		proof, err := params.SchnorrProveNI(x, nil)
+		if err != nil {
+			t.Fatal("SchnorrProveNI() fails:", err)
+		}
+		if params.SchnorrVerifyNI(Y, proof, nil) {
+			t.Errorf("proof for Y = %v accepted", Y)
+		}
+	}
+}
+
+// Test the non-interactive proof of knowledge of the secret key.
+func TestSchnorrNI(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	context := []byte("mix server 1")
+
+	proof, err := sk.ProveKnowledge(context)
+	if err != nil {
+		t.Fatal("ProveKnowledge() fails:", err)
+	}
+	if !pk.VerifyKnowledge(proof, context) {
+		t.Error("failed to verify")
+	}
+
+	if pk.VerifyKnowledge(proof, []byte("mix server 2")) {
+		t.Error("proof accepted for the wrong context")
+	}
+
+	pk1, _ := params.GenerateKeys()
+	if pk1.VerifyKnowledge(proof, context) {
+		t.Error("proof accepted for the wrong key")
+	}
+
+	proof.S.Add(proof.S, params.one)
+	if pk.VerifyKnowledge(proof, context) {
+		t.Error("tampered proof accepted")
+	}
+
+	if pk.VerifyKnowledge(&SchnorrProof{}, context) || pk.VerifyKnowledge(nil, context) {
+		t.Error("empty proof accepted")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"crypto/rand"
+	"io"
+	"math/big"
+)
+
+// Scratch holds the buffers used by the prover or verifier role of the
+// interactive proofs. A long-running mix server can keep one Scratch per
+// concurrent proof and pass it to ILMPProveScratch, ILMPVerifyScratch,
+// Shuffle0ProveScratch, and Shuffle0VerifyScratch, so that the buffers are
+// reused rather than allocated anew for every proof. A Scratch must not be
+// used by more than one proof at a time.
+//
+// The messages sent to the peer are double-buffered: each proof writes them to
+// the buffers the proof before it did not use. Since a party cannot finish a
+// proof before the peer has answered it, the peer may keep the messages of a
+// proof until it has answered the next one.
+type Scratch struct {
+	// Outgoing messages of the current and previous proof.
+	out [2]outgoing
+	cur int
+
+	// Buffers for ILMP.
+	theta []big.Int
+
+	// Buffers for Shuffle0.
+	phi, psi []big.Int
+
+	// Buffers for batch inversion.
+	xInv, prefix []big.Int
+	inv, next    big.Int
+
+	// Temporaries.
+	u, v, w, z big.Int
+	num, den   big.Int
+	prod, quo  big.Int
+	buf        []byte
+}
+
+// outgoing holds the messages a party sends to its peer in a proof.
+type outgoing struct {
+	a, r  []big.Int // ILMP prover
+	gamma []big.Int // ILMP verifier
+	t     []big.Int // Shuffle0 verifier
+}
+
+// NewScratch returns an empty Scratch. Its buffers grow to fit the largest
+// batch they have been used for.
+func NewScratch() *Scratch {
+	return new(Scratch)
+}
+
+// nextProof switches to the outgoing buffers not used by the last proof. It
+// is called once at the start of each proof.
+func (s *Scratch) nextProof() {
+	s.cur ^= 1
+}
+
+// msgs returns the outgoing buffers of the current proof.
+func (s *Scratch) msgs() *outgoing {
+	return &s.out[s.cur]
+}
+
+// ints returns a slice of n integers, reusing the storage of buf if it is big
+// enough.
+func ints(buf []big.Int, n int) []big.Int {
+	if cap(buf) < n {
+		return make([]big.Int, n)
+	}
+	return buf[:n]
+}
+
+// bytes returns a slice of n bytes backed by the scratch buffer.
+func (s *Scratch) bytes(n int) []byte {
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	return s.buf[:n]
+}
+
+// mod sets z to x mod m for m > 0 and returns z. Unlike big.Int.Mod, it does
+// not allocate a quotient. z must not alias x.
+func (s *Scratch) mod(z, x, m *big.Int) *big.Int {
+	s.quo.QuoRem(x, m, z)
+	if z.Sign() < 0 {
+		z.Add(z, m)
+	}
+	return z
+}
+
+// mulMod sets z to x*y mod m for m > 0 and returns z. z may alias x or y.
+func (s *Scratch) mulMod(z, x, y, m *big.Int) *big.Int {
+	s.prod.Mul(x, y)
+	return s.mod(z, &s.prod, m)
+}
+
+// readRand fills b with random bytes.
+func readRand(b []byte) (int, error) {
+	return io.ReadFull(rand.Reader, b)
+}
+
+// sampleInto sets z to a random value from [1..Q-1]. Unlike Sample, it does
+// not allocate once the scratch buffer is big enough.
+func (params *KeyParameters) sampleInto(z *big.Int, s *Scratch) error {
+	bitLen := params.qMinusOne.BitLen()
+	b := s.bytes((bitLen + 7) / 8)
+	topBits := uint(bitLen % 8)
+	if topBits == 0 {
+		topBits = 8
+	}
+	// Rejection sampling from [0,Q-1), as in crypto/rand.Int.
+	for {
+		if _, err := readRand(b); err != nil {
+			return err
+		}
+		b[0] &= uint8(int(1<<topBits) - 1)
+		z.SetBytes(b)
+		if z.Cmp(params.qMinusOne) < 0 {
+			// Add 1 so that the value is in [1,Q-1].
+			z.Add(z, params.one)
+			return nil
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// Test that the messages of a proof run with a Scratch are left intact by the
+// next proof, so that the peer can still check them, and that the buffers are
+// reused by the proof after that.
+func TestScratchReuse(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	x, y, X, Y := benchILMPInstance(t, params, 10)
+	ps, vs := NewScratch(), NewScratch()
+	done := make(chan error)
+
+	// Play the verifier of the first proof, keeping the prover's messages.
+	msg := make(chan []big.Int)
+	go func() {
+		done <- params.ILMPProveScratch(x, y, msg, ps)
+	}()
+	A := <-msg
+	gamma := []big.Int{*testSample(t, params)}
+	msg <- gamma
+	r := <-msg
+	if err := <-done; err != nil {
+		t.Fatal("prover:", err)
+	}
+	A0, r0 := cloneMsg(A), cloneMsg(r)
+
+	run := func() {
+		go func() {
+			done <- params.ILMPProveScratch(x, y, msg, ps)
+		}()
+		if ok, err := params.ILMPVerifyScratch(X, Y, msg, vs); err != nil {
+			t.Fatal("verifier:", err)
+		} else if !ok {
+			t.Fatal("failed to verify")
+		}
+		if err := <-done; err != nil {
+			t.Fatal("prover:", err)
+		}
+	}
+
+	run()
+	for i := range A {
+		if A[i].Cmp(&A0[i]) != 0 {
+			t.Fatalf("A[%d] was overwritten by the next proof", i)
+		}
+	}
+	for i := range r {
+		if r[i].Cmp(&r0[i]) != 0 {
+			t.Fatalf("r[%d] was overwritten by the next proof", i)
+		}
+	}
+	if !params.ilmpCheck(X, Y, A, &gamma[0], r, NewScratch()) {
+		t.Error("first proof is rejected after the next proof")
+	}
+
+	run()
+	if out := ps.msgs(); &out.a[0] != &A[0] || &out.r[0] != &r[0] {
+		t.Error("prover's buffers were reallocated")
+	}
+}
+
+// The budget for the allocations of a run of Shuffle0 of length N with warm
+// Scratches, besides those made by big.Int.Exp, is N*scratchAllocsPerElement
+// plus scratchAllocsPerRun. Most of them are made by math/big when reducing
+// modulo Q.
+const (
+	scratchAllocsPerElement = 24
+	scratchAllocsPerRun     = 64
+)
+
+// Test that a run of Shuffle0 with warm Scratches stays within the allocation
+// budget. A run with fresh Scratches does not.
+func TestScratchAllocs(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 20
+	x, y, c, d, X, Y, C, D := testShuffle0Instance(t, params, N)
+	ps, vs := NewScratch(), NewScratch()
+	msg := make(chan []big.Int)
+	done := make(chan error)
+	run := func() {
+		go func() {
+			done <- params.Shuffle0ProveScratch(x, y, c, d, msg, ps)
+		}()
+		if ok, err := params.Shuffle0VerifyScratch(X, Y, C, D, msg, vs); err != nil || !ok {
+			t.Fatal("failed to verify:", err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal("prover:", err)
+		}
+	}
+
+	// Each element of the ILMP instance, of which there are 2N, costs the
+	// prover and the verifier two exponentiations each. The verifier makes
+	// two more to compute the instance.
+	e, k := new(big.Int), testSample(t, params)
+	expAllocs := testing.AllocsPerRun(10, func() { e.Exp(&X[0], k, params.P) })
+	budget := float64(8*N+2)*expAllocs + float64(N*scratchAllocsPerElement+scratchAllocsPerRun)
+
+	if allocs := testing.AllocsPerRun(10, run); allocs > budget {
+		t.Errorf("run with warm Scratches makes %v allocations, budget is %v", allocs, budget)
+	}
+	if allocs := testing.AllocsPerRun(10, func() {
+		ps, vs = NewScratch(), NewScratch()
+		run()
+	}); allocs <= budget {
+		t.Errorf("run with fresh Scratches makes %v allocations, expected more than the budget %v", allocs, budget)
+	}
+}
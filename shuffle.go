@@ -38,48 +38,99 @@ import (
 	"math/big"
 )
 
+// LengthError is returned by Mix and ReEncryptionMix when the sequences R and
+// C of a batch of ciphertexts have different lengths.
+type LengthError struct {
+	LenR, LenC int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("sequence length mismatch: |R|=%d, |C|=%d", e.LenR, e.LenC)
+}
+
+// CiphertextError is returned by Mix when the Index-th ciphertext of a batch
+// is malformed.
+type CiphertextError struct {
+	Index int
+	Err   error
+}
+
+func (e *CiphertextError) Error() string {
+	return fmt.Sprintf("ciphertext %d: %v", e.Index, e.Err)
+}
+
+// checkCiphertext returns an error unless R and C are elements of Z/p^*. If
+// strict is set, it also requires R to be an element of <G>, as it is for
+// every honestly generated ciphertext. (C need not be, since Encode's output
+// is not in general.)
+func (params *KeyParameters) checkCiphertext(R, C *big.Int, strict bool) error {
+	if R == nil || C == nil {
+		return errors.New("missing component")
+	}
+	if R.Sign() <= 0 || R.Cmp(params.P) >= 0 || C.Sign() <= 0 || C.Cmp(params.P) >= 0 {
+		return errors.New("component is not an element of Z/p^*")
+	}
+	if strict && !params.IsElement(R) {
+		return errors.New("R is not an element of <G>")
+	}
+	return nil
+}
+
 // Decrypts the sequence of ElGamal ciphertexts {(R[i], C[i])}, applies the
 // specified permutation, and outputs the resulting sequence.
-func (sk *SecretKey) Mix(R, C []*big.Int, perm []int) ([]*big.Int, error) {
+//
+// The inputs are validated before anything is decrypted: Mix returns a
+// *LengthError if R and C have different lengths, a *PermutationError if perm
+// is not a permutation of [0..len(R)-1], and a *CiphertextError if a
+// component of a ciphertext is missing or not an element of Z/p^*.
+func (sk *SecretKey) Mix(R, C []*big.Int, perm Permutation) ([]*big.Int, error) {
+	return sk.mix(R, C, perm, false)
+}
+
+// MixStrict is like Mix, but also returns a *CiphertextError if the R
+// component of a ciphertext is not an element of <G>. This rejects
+// ciphertexts that were not output by Encrypt or ReEncryptionMix, at the cost
+// of an exponentiation per ciphertext.
+func (sk *SecretKey) MixStrict(R, C []*big.Int, perm Permutation) ([]*big.Int, error) {
+	return sk.mix(R, C, perm, true)
+}
+
+func (sk *SecretKey) mix(R, C []*big.Int, perm Permutation, strict bool) ([]*big.Int, error) {
 	if len(R) != len(C) {
-		return nil, errors.New(fmt.Sprintf(
-			"sequence length mismatch: |R|=%d, |C|=%d", len(R), len(C)))
+		return nil, &LengthError{len(R), len(C)}
+	}
+	if err := perm.Validate(len(R)); err != nil {
+		return nil, err
+	}
+	for i := range R {
+		if err := sk.checkCiphertext(R[i], C[i], strict); err != nil {
+			return nil, &CiphertextError{i, err}
+		}
 	}
 
 	M := make([]*big.Int, len(R))
 	for i := 0; i < len(R); i++ {
-		if j := perm[i]; M[j] == nil && 0 <= j && j < len(R) {
-			M[j] = sk.Decrypt(R[i], C[i])
-		} else {
-			return nil, errors.New("parameter is not a permutation")
-		}
+		M[i] = sk.Decrypt(R[i], C[i])
 	}
-	return M, nil
+	return perm.Apply(M), nil
 }
 
-// GeneratePerm generates a pseudo-random permutation on n-vectors using the
-// Knuth (Fisher-Yates) shuffle.
-func GeneratePerm(n int) []int {
-	perm := make([]int, n)
-	for i := 0; i < n; i++ {
-		perm[i] = i
-	}
-	one := new(big.Int)
-	one.SetUint64(1)
+// GeneratePerm generates a uniformly random permutation of [0..n-1] using the
+// Fisher-Yates shuffle: for i = n-1, ..., 1, it swaps the i-th element with
+// the j-th, where j is drawn uniformly from [0..i] with crypto/rand.
+func GeneratePerm(n int) (Permutation, error) {
+	perm := IdentityPermutation(n)
 	max := new(big.Int)
-	max.SetUint64(uint64(n))
 	for i := n - 1; i >= 1; i-- {
-		max.Sub(max, one)
+		max.SetInt64(int64(i + 1))
 		r, err := rand.Int(rand.Reader, max)
 		if err != nil {
-			return nil
+			return nil, err
 		}
-		j := r.Uint64()
-		perm[i] ^= perm[j]
-		perm[j] ^= perm[i]
-		perm[i] ^= perm[j]
+		j := r.Int64()
+		perm[i], perm[j] = perm[j], perm[i]
 	}
-	return perm
+	return perm, nil
 }
 
 // ILMPProve implements the prover role in the interactive proof for ILMP. It
@@ -88,32 +139,66 @@ func GeneratePerm(n int) []int {
 // Communication is implemented using a Go channel. As such, it should be very
 // easy to overlay this code on a network connection.
 func (params *KeyParameters) ILMPProve(x, y []big.Int, msg chan []big.Int) error {
+	return params.ILMPProveScratch(x, y, msg, NewScratch())
+}
+
+// ILMPProveScratch is like ILMPProve, except that it uses the buffers in s
+// instead of allocating its own.
+func (params *KeyParameters) ILMPProveScratch(x, y []big.Int, msg chan []big.Int, s *Scratch) error {
+	s.nextProof()
+	return params.ilmpProve(x, y, msg, s)
+}
+
+func (params *KeyParameters) ilmpProve(x, y []big.Int, msg chan []big.Int, s *Scratch) error {
 	if len(x) != len(y) {
 		msg <- nil
 		return errors.New("input lengths do not match")
 	}
 
-	// P1
 	N := len(x)
-	theta := make([]big.Int, N+1)
+	if N < 2 {
+		msg <- nil
+		return errors.New(fmt.Sprintf("input length is %d, expected at least 2", N))
+	}
+
+	// The prover's solution involves the inverse of each x[i]. If any of the
+	// x[i] or y[i] is 0, then the instance is degenerate: whether it is in the
+	// language can be decided by inspection.
+	s.xInv = ints(s.xInv, N)
+	xInv := s.xInv
+	if err := s.batchInverse(xInv, x, params.Q); err != nil {
+		msg <- nil
+		return errors.New(fmt.Sprintf("x: %v", err))
+	}
+	for i := 0; i < N; i++ {
+		if s.mod(&s.z, &y[i], params.Q).Sign() == 0 {
+			msg <- nil
+			return errors.New(fmt.Sprintf("y: element %d is not invertible", i))
+		}
+	}
+
+	// P1
+	s.theta = ints(s.theta, N+1)
+	theta := s.theta
+	theta[0].SetUint64(0)
+	theta[N].SetUint64(0)
 	for i := 1; i < N; i++ {
-		t, err := params.Sample()
-		if err != nil {
+		if err := params.sampleInto(&theta[i], s); err != nil {
 			msg <- nil
 			return err
 		}
-		theta[i] = *t
 	}
 
-	A := make([]big.Int, N)
-	var X, Y big.Int
+	out := s.msgs()
+	out.a = ints(out.a, N)
+	A := out.a
+	X, Y, e := &s.u, &s.v, &s.w
 	for i := 0; i < N; i++ {
-		X.Mul(&x[i], &theta[i])
-		X.Exp(params.G, &X, params.P)
-		Y.Mul(&y[i], &theta[i+1])
-		Y.Exp(params.G, &Y, params.P)
-		A[i].Mul(&X, &Y)
-		A[i].Mod(&A[i], params.P)
+		s.mulMod(e, &x[i], &theta[i], params.Q)
+		X.Exp(params.G, e, params.P)
+		s.mulMod(e, &y[i], &theta[i+1], params.Q)
+		Y.Exp(params.G, e, params.P)
+		s.mulMod(&A[i], X, Y, params.P)
 	}
 	msg <- A
 
@@ -122,24 +207,27 @@ func (params *KeyParameters) ILMPProve(x, y []big.Int, msg chan []big.Int) error
 	if gamma == nil {
 		return errors.New("channel closed by peer (V1)")
 	}
+	if len(gamma) != 1 {
+		msg <- nil
+		return errors.New(fmt.Sprintf("challenge has length %d (V1)", len(gamma)))
+	}
 
 	// P2
-	r := make([]big.Int, N-1)
-	num := new(big.Int).SetUint64(1)
-	den := new(big.Int).SetUint64(1)
-
-	var z, q, inv big.Int
+	out.r = ints(out.r, N-1)
+	r := out.r
+	num := s.num.SetUint64(1)
+	denInv := s.den.SetUint64(1)
 	for i := N - 2; i >= 0; i-- {
-		num.Mul(num, &y[i+1])
-		den.Mul(den, &x[i+1])
-		z.GCD(&inv, &q, den, params.Q)
-		r[i].Mul(num, &inv)
-		r[i].Mul(&r[i], &gamma[0])
-		r[i].Mod(&r[i], params.Q)
+		s.mulMod(num, num, &y[i+1], params.Q)
+		s.mulMod(denInv, denInv, &xInv[i+1], params.Q)
+		s.mulMod(&r[i], num, denInv, params.Q)
+		s.mulMod(&r[i], &r[i], &gamma[0], params.Q)
 		if (N-i-1)%2 == 1 {
 			r[i].Sub(params.Q, &r[i])
 		}
 		r[i].Add(&r[i], &theta[i+1])
+		// The sum is in [0, 2Q), but the verifier only accepts [0, Q).
+		s.mod(&r[i], &r[i], params.Q)
 	}
 	msg <- r
 
@@ -149,13 +237,21 @@ func (params *KeyParameters) ILMPProve(x, y []big.Int, msg chan []big.Int) error
 // ILMPVerify implements the verifier role in the interactive proof for ILMP.
 // It takes as input the public sequences X and Y.
 func (params *KeyParameters) ILMPVerify(X, Y []big.Int, msg chan []big.Int) (bool, error) {
-	var err error
+	return params.ILMPVerifyScratch(X, Y, msg, NewScratch())
+}
+
+// ILMPVerifyScratch is like ILMPVerify, except that it uses the buffers in s
+// instead of allocating its own.
+func (params *KeyParameters) ILMPVerifyScratch(X, Y []big.Int, msg chan []big.Int, s *Scratch) (bool, error) {
+	s.nextProof()
+	return params.ilmpVerify(X, Y, msg, s)
+}
 
+func (params *KeyParameters) ilmpVerify(X, Y []big.Int, msg chan []big.Int, s *Scratch) (bool, error) {
 	if len(X) != len(Y) {
 		msg <- nil
 		return false, errors.New("input lengths do not match")
 	}
-	N := len(X)
 
 	// P1
 	A := <-msg
@@ -164,13 +260,13 @@ func (params *KeyParameters) ILMPVerify(X, Y []big.Int, msg chan []big.Int) (boo
 	}
 
 	// V1
-	gamma := make([]big.Int, 1)
-	t, err := params.Sample()
-	if err != nil {
+	out := s.msgs()
+	out.gamma = ints(out.gamma, 1)
+	gamma := out.gamma
+	if err := params.sampleInto(&gamma[0], s); err != nil {
 		msg <- nil
 		return false, err
 	}
-	gamma[0] = *t
 	msg <- gamma
 
 	// P2
@@ -179,78 +275,119 @@ func (params *KeyParameters) ILMPVerify(X, Y []big.Int, msg chan []big.Int) (boo
 		return false, errors.New("channel closed by peer (P2)")
 	}
 
-	var L, R big.Int
 	// V2
-	//
+	return params.ilmpCheck(X, Y, A, &gamma[0], r, s), nil
+}
+
+// ilmpCheck checks the verification equations of ILMP (step V2) for the
+// public sequences X and Y, the prover's first message A, the challenge
+// gamma, and the prover's response r.
+func (params *KeyParameters) ilmpCheck(X, Y, A []big.Int, gamma *big.Int, r []big.Int, s *Scratch) bool {
+	N := len(X)
+	if N < 2 || len(Y) != N || len(A) != N || len(r) != N-1 {
+		return false
+	}
+	// Only canonical values are accepted: otherwise A[i] + P or r[i] + Q
+	// would pass for A[i] or r[i], so that a proof has many encodings.
+	for i := range A {
+		if A[i].Sign() <= 0 || A[i].Cmp(params.P) >= 0 {
+			return false
+		}
+	}
+	for i := range r {
+		if r[i].Sign() < 0 || r[i].Cmp(params.Q) >= 0 {
+			return false
+		}
+	}
+
+	L, R := &s.u, &s.v
 	// First equation
-	var qMinusGamma big.Int
-	qMinusGamma.Sub(params.Q, &gamma[0])
+	qMinusGamma := &s.w
+	qMinusGamma.Sub(params.Q, gamma)
 	L.Exp(&Y[0], &r[0], params.P)
 	if (N-1)%2 == 1 {
-		R.Exp(&X[0], &qMinusGamma, params.P)
+		R.Exp(&X[0], qMinusGamma, params.P)
 	} else {
-		R.Exp(&X[0], &gamma[0], params.P)
+		R.Exp(&X[0], gamma, params.P)
 	}
-	R.Mul(&A[0], &R)
-	R.Mod(&R, params.P)
-	if L.Cmp(&R) != 0 {
-		return false, nil
+	s.mulMod(R, &A[0], R, params.P)
+	if L.Cmp(R) != 0 {
+		return false
 	}
 
 	// Intermediate equations
 	for i := 1; i < N-1; i++ {
 		L.Exp(&X[i], &r[i-1], params.P)
 		R.Exp(&Y[i], &r[i], params.P)
-		L.Mul(&L, &R)
-		L.Mod(&L, params.P)
+		s.mulMod(L, L, R, params.P)
 		if L.Cmp(&A[i]) != 0 {
-			return false, nil
+			return false
 		}
 	}
 
 	// Last equation
 	L.Exp(&X[N-1], &r[N-2], params.P)
-	R.Exp(&Y[N-1], &qMinusGamma, params.P)
-	R.Mul(&A[N-1], &R)
-	R.Mod(&R, params.P)
-	if L.Cmp(&R) != 0 {
-		return false, nil
+	R.Exp(&Y[N-1], qMinusGamma, params.P)
+	s.mulMod(R, &A[N-1], R, params.P)
+	if L.Cmp(R) != 0 {
+		return false
 	}
-	return true, nil
+	return true
 }
 
 // Shuffle0Prove implements the prover role for the interactive proof of
 // Shuffle0 (the simple k-shuffle).
 func (params *KeyParameters) Shuffle0Prove(x, y []big.Int, c, d *big.Int, msg chan []big.Int) error {
-	if len(x) != len(y) {
-		msg <- nil
-		return errors.New("input lengths do not match")
-	}
-	N := len(x)
+	return params.Shuffle0ProveScratch(x, y, c, d, msg, NewScratch())
+}
+
+// Shuffle0ProveScratch is like Shuffle0Prove, except that it uses the buffers
+// in s instead of allocating its own.
+func (params *KeyParameters) Shuffle0ProveScratch(x, y []big.Int, c, d *big.Int, msg chan []big.Int, s *Scratch) error {
+	s.nextProof()
+	return params.shuffle0Prove(x, y, c, d, msg, s)
+}
 
+func (params *KeyParameters) shuffle0Prove(x, y []big.Int, c, d *big.Int, msg chan []big.Int, s *Scratch) error {
 	// V1
 	gamma := <-msg
 	if gamma == nil {
 		return errors.New("channel closed by peer (V1)")
 	}
+	if len(gamma) != 1 {
+		msg <- nil
+		return errors.New(fmt.Sprintf("challenge has length %d (V1)", len(gamma)))
+	}
 	t := &gamma[0]
 
+	// The inputs are checked after the challenge is received, since the
+	// verifier speaks first: aborting before would leave both parties
+	// sending.
+	if len(x) != len(y) {
+		msg <- nil
+		return errors.New("input lengths do not match")
+	}
+	N := len(x)
+	if N < 1 {
+		msg <- nil
+		return errors.New("input is empty")
+	}
+
 	// P1
-	phi := make([]big.Int, 2*N)
-	psi := make([]big.Int, 2*N)
-	dt := new(big.Int).Mul(d, t)
-	ct := new(big.Int).Mul(c, t)
+	s.phi = ints(s.phi, 2*N)
+	s.psi = ints(s.psi, 2*N)
+	phi, psi := s.phi, s.psi
+	dt := s.u.Mul(d, t)
+	ct := s.v.Mul(c, t)
 
 	for i := 0; i < N; i++ {
-		phi[i].Sub(&x[i], dt)
-		phi[i].Mod(&phi[i], params.Q)
-		phi[N+i] = *c
-		psi[i].Sub(&y[i], ct)
-		psi[i].Mod(&psi[i], params.Q)
-		psi[N+i] = *d
+		s.mod(&phi[i], s.prod.Sub(&x[i], dt), params.Q)
+		phi[N+i].Set(c)
+		s.mod(&psi[i], s.prod.Sub(&y[i], ct), params.Q)
+		psi[N+i].Set(d)
 	}
 
-	if err := params.ILMPProve(phi, psi, msg); err != nil {
+	if err := params.ilmpProve(phi, psi, msg, s); err != nil {
 		return errors.New(fmt.Sprintf("ilmp: %v", err))
 	}
 
@@ -260,42 +397,41 @@ func (params *KeyParameters) Shuffle0Prove(x, y []big.Int, c, d *big.Int, msg ch
 // Shuffle0Verify implements the verifier role in the interactive proof of
 // Shuffle0 (the simple k-shuffle).
 func (params *KeyParameters) Shuffle0Verify(X, Y []big.Int, C, D *big.Int, msg chan []big.Int) (bool, error) {
+	return params.Shuffle0VerifyScratch(X, Y, C, D, msg, NewScratch())
+}
+
+// Shuffle0VerifyScratch is like Shuffle0Verify, except that it uses the
+// buffers in s instead of allocating its own.
+func (params *KeyParameters) Shuffle0VerifyScratch(X, Y []big.Int, C, D *big.Int, msg chan []big.Int, s *Scratch) (bool, error) {
+	s.nextProof()
+	return params.shuffle0Verify(X, Y, C, D, msg, s)
+}
+
+func (params *KeyParameters) shuffle0Verify(X, Y []big.Int, C, D *big.Int, msg chan []big.Int, s *Scratch) (bool, error) {
 
 	if len(X) != len(Y) {
 		msg <- nil
 		return false, errors.New("input lengths do not match")
 	}
-	N := len(X)
 
 	// V1
-	t, err := params.Sample()
+	out := s.msgs()
+	out.t = ints(out.t, 1)
+	gamma := out.t
+	t := &gamma[0]
+	if err := params.sampleInto(t, s); err != nil {
+		msg <- nil
+		return false, err
+	}
+	Phi, Psi, err := params.shuffle0Statement(X, Y, C, D, t, s)
 	if err != nil {
 		msg <- nil
 		return false, err
 	}
-	gamma := make([]big.Int, 1)
-	gamma[0] = *t
 	msg <- gamma
 
 	// P1
-	U := new(big.Int).Exp(D, t, params.P)
-	W := new(big.Int).Exp(C, t, params.P)
-	var Uinv, Winv, Q, Z big.Int
-	Z.GCD(&Uinv, &Q, U, params.P)
-	Z.GCD(&Winv, &Q, W, params.P)
-
-	Phi := make([]big.Int, 2*N)
-	Psi := make([]big.Int, 2*N)
-	for i := 0; i < N; i++ {
-		Phi[i].Mul(&X[i], &Uinv)
-		Phi[i].Mod(&Phi[i], params.P)
-		Phi[N+i] = *C
-		Psi[i].Mul(&Y[i], &Winv)
-		Psi[i].Mod(&Psi[i], params.P)
-		Psi[N+i] = *D
-	}
-
-	if ok, err := params.ILMPVerify(Phi, Psi, msg); err != nil {
+	if ok, err := params.ilmpVerify(Phi, Psi, msg, s); err != nil {
 		return false, errors.New(fmt.Sprintf("ilmp: %s", err))
 	} else if !ok {
 		return false, nil
@@ -303,3 +439,46 @@ func (params *KeyParameters) Shuffle0Verify(X, Y []big.Int, C, D *big.Int, msg c
 
 	return true, nil
 }
+
+// shuffle0Statement computes the sequences (X_1 U^-1, ..., X_n U^-1, C, ...,
+// C) and (Y_1 W^-1, ..., Y_n W^-1, D, ..., D), where U = D^t and W = C^t, for
+// which the prover runs ILMP in step P1 of Shuffle0. The sequences are backed
+// by s.
+func (params *KeyParameters) shuffle0Statement(X, Y []big.Int, C, D, t *big.Int, s *Scratch) (Phi, Psi []big.Int, err error) {
+	N := len(X)
+	if len(Y) != N {
+		return nil, nil, errors.New("input lengths do not match")
+	}
+
+	U := s.u.Exp(D, t, params.P)
+	W := s.v.Exp(C, t, params.P)
+	Uinv, Winv := &s.w, &s.z
+	if _, err := inverse(Uinv, U, params.P); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("D^t: %v", err))
+	}
+	if _, err := inverse(Winv, W, params.P); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("C^t: %v", err))
+	}
+
+	s.phi = ints(s.phi, 2*N)
+	s.psi = ints(s.psi, 2*N)
+	Phi, Psi = s.phi, s.psi
+	for i := 0; i < N; i++ {
+		s.mulMod(&Phi[i], &X[i], Uinv, params.P)
+		Phi[N+i].Set(C)
+		s.mulMod(&Psi[i], &Y[i], Winv, params.P)
+		Psi[N+i].Set(D)
+	}
+	return Phi, Psi, nil
+}
+
+// shuffle0Check checks a transcript of Shuffle0 for the public sequences X and
+// Y and the elements C and D: the verifier's challenge t, followed by the
+// transcript (A, gamma, r) of ILMP.
+func (params *KeyParameters) shuffle0Check(X, Y []big.Int, C, D, t *big.Int, A []big.Int, gamma *big.Int, r []big.Int, s *Scratch) bool {
+	Phi, Psi, err := params.shuffle0Statement(X, Y, C, D, t, s)
+	if err != nil {
+		return false
+	}
+	return params.ilmpCheck(Phi, Psi, A, gamma, r, s)
+}
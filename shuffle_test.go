@@ -29,7 +29,10 @@
 package shuffle
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -51,7 +54,7 @@ func TestMix(t *testing.T) {
 		R[i], C[i] = pk.Encrypt(X)
 	}
 
-	perm := GeneratePerm(n)
+	perm := testPerm(t, n)
 	t.Log(perm)
 	M, err := sk.Mix(R, C, perm)
 	if err != nil {
@@ -68,6 +71,236 @@ func TestMix(t *testing.T) {
 	}
 }
 
+// Test that Mix rejects malformed inputs with the corresponding typed error
+// instead of panicking.
+func TestMixErrors(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	R := make([]*big.Int, 3)
+	C := make([]*big.Int, 3)
+	for i := range R {
+		R[i], C[i] = pk.Encrypt(big.NewInt(int64(i + 2)))
+	}
+
+	var lengthErr *LengthError
+	if _, err := sk.Mix(R, C[:2], Permutation{0, 1, 2}); !errors.As(err, &lengthErr) {
+		t.Errorf("Mix() with |R| != |C| returns %v", err)
+	}
+
+	for _, perm := range []Permutation{
+		{0, 1},
+		{0, 1, 2, 3},
+		{0, 1, 3},
+		{0, 1, -1},
+		{1, 1, 2},
+		nil,
+	} {
+		var permErr *PermutationError
+		if _, err := sk.Mix(R, C, perm); !errors.As(err, &permErr) {
+			t.Errorf("Mix() with perm %v returns %v", perm, err)
+		}
+	}
+
+	var ctErr *CiphertextError
+	for _, test := range []struct {
+		i      int
+		X      *big.Int
+		strict bool
+	}{
+		{1, nil, false},
+		{2, new(big.Int), false},
+		{0, new(big.Int).Set(params.P), false},
+		{1, new(big.Int).Sub(params.P, params.one), true},
+	} {
+		R2 := append([]*big.Int(nil), R...)
+		R2[test.i] = test.X
+		if _, err := sk.MixStrict(R2, C, Permutation{2, 0, 1}); !errors.As(err, &ctErr) || ctErr.Index != test.i {
+			t.Errorf("MixStrict() with R[%d] = %v returns %v", test.i, test.X, err)
+		}
+		if _, err := sk.Mix(R2, C, Permutation{2, 0, 1}); test.strict && err != nil {
+			t.Errorf("Mix() with R[%d] = %v returns %v", test.i, test.X, err)
+		} else if !test.strict && !errors.As(err, &ctErr) {
+			t.Errorf("Mix() with R[%d] = %v returns %v", test.i, test.X, err)
+		}
+	}
+
+	M, err := sk.MixStrict(R, C, Permutation{2, 0, 1})
+	if err != nil {
+		t.Fatal("MixStrict() fails:", err)
+	}
+	for i, want := range []int64{3, 4, 2} {
+		if M[i].Int64() != want {
+			t.Errorf("M[%d] = %d, want %d", i, M[i], want)
+		}
+	}
+}
+
+// FuzzMix checks that Mix and MixStrict never panic on arbitrary permutations
+// and batches, that they fail with the typed error of the first check that
+// the inputs fail, and that they decrypt and permute correctly otherwise.
+// Each byte of perm is a signed position; each byte of batch selects, for the
+// R or C component in turn, a missing component, a small integer, a component
+// of a valid ciphertext, or an integer not less than P. The seed corpus is in
+// testdata/fuzz/FuzzMix.
+func FuzzMix(f *testing.F) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	poolR := make([]*big.Int, 4)
+	poolC := make([]*big.Int, 4)
+	for i := range poolR {
+		X, err := params.Encode([]byte{byte(i)})
+		if err != nil {
+			f.Fatal("Encode() fails:", err)
+		}
+		poolR[i], poolC[i] = pk.Encrypt(X)
+	}
+
+	f.Fuzz(func(t *testing.T, permBytes, batch []byte) {
+		perm := make(Permutation, len(permBytes))
+		for i, b := range permBytes {
+			perm[i] = int(int8(b))
+		}
+		var R, C []*big.Int
+		wellFormed, inGroup := true, true
+		for i, b := range batch {
+			var X *big.Int
+			switch b % 4 {
+			case 0:
+				wellFormed = false
+			case 1:
+				X = big.NewInt(int64(b))
+			case 2:
+				if i%2 == 0 {
+					X = poolR[(i/2)%len(poolR)]
+				} else {
+					X = poolC[(i/2)%len(poolC)]
+				}
+			case 3:
+				X = new(big.Int).Add(params.P, big.NewInt(int64(b)))
+				wellFormed = false
+			}
+			if i%2 == 0 {
+				inGroup = inGroup && X != nil && params.IsElement(X)
+				R = append(R, X)
+			} else {
+				C = append(C, X)
+			}
+		}
+
+		M, err := sk.Mix(R, C, perm)
+		M2, err2 := sk.MixStrict(R, C, perm)
+		var lengthErr *LengthError
+		var permErr *PermutationError
+		var ctErr *CiphertextError
+		switch {
+		case len(R) != len(C):
+			if !errors.As(err, &lengthErr) || !errors.As(err2, &lengthErr) {
+				t.Fatalf("got %v and %v, want *LengthError", err, err2)
+			}
+		case perm.Validate(len(R)) != nil:
+			if !errors.As(err, &permErr) || !errors.As(err2, &permErr) {
+				t.Fatalf("got %v and %v, want *PermutationError", err, err2)
+			}
+		case !wellFormed:
+			if !errors.As(err, &ctErr) || !errors.As(err2, &ctErr) {
+				t.Fatalf("got %v and %v, want *CiphertextError", err, err2)
+			}
+		default:
+			if err != nil {
+				t.Fatal("Mix() fails:", err)
+			}
+			if inGroup != (err2 == nil) {
+				t.Fatalf("MixStrict() returns %v for R in <G>: %t", err2, inGroup)
+			}
+			for i := range R {
+				if want := sk.Decrypt(R[i], C[i]); M[perm[i]].Cmp(want) != 0 || (inGroup && M2[perm[i]].Cmp(want) != 0) {
+					t.Fatalf("output %d is not the decryption of input %d", perm[i], i)
+				}
+			}
+		}
+	})
+}
+
+// testPerm returns a random permutation of [0..n-1].
+func testPerm(t testing.TB, n int) Permutation {
+	perm, err := GeneratePerm(n)
+	if err != nil {
+		t.Fatal("GeneratePerm() fails:", err)
+	}
+	return perm
+}
+
+// testSample returns a random element of [1..Q-1].
+func testSample(t testing.TB, params *KeyParameters) *big.Int {
+	x, err := params.Sample()
+	if err != nil {
+		t.Fatal("Sample() fails:", err)
+	}
+	return x
+}
+
+// Test that GeneratePerm outputs every permutation of small n with equal
+// probability, using Pearson's chi-squared test. The thresholds are the
+// critical values for a significance level of about 10^-6, so the test fails
+// spuriously with negligible probability. A biased generator, such as one
+// that draws j from [0..i-1] (Sattolo's algorithm) and so outputs only cyclic
+// permutations, fails with overwhelming probability.
+func TestGeneratePerm(t *testing.T) {
+	for _, test := range []struct {
+		n, trials int
+		threshold float64
+	}{
+		{1, 10, 0},
+		{2, 2000, 24},
+		{3, 6000, 36},
+		{4, 24000, 62},
+	} {
+		counts := make(map[string]int)
+		identity, fixed := 0, 0
+		for i := 0; i < test.trials; i++ {
+			perm := testPerm(t, test.n)
+			if err := perm.Validate(test.n); err != nil {
+				t.Fatalf("n=%d: GeneratePerm() outputs an invalid permutation: %s", test.n, err)
+			}
+			counts[fmt.Sprint(perm)]++
+			hasFixed := false
+			for j := range perm {
+				hasFixed = hasFixed || perm[j] == j
+			}
+			if hasFixed {
+				fixed++
+			}
+			if reflect.DeepEqual(perm, IdentityPermutation(test.n)) {
+				identity++
+			}
+		}
+
+		perms := 1
+		for k := 2; k <= test.n; k++ {
+			perms *= k
+		}
+		if len(counts) != perms {
+			t.Errorf("n=%d: got %d distinct permutations, want %d", test.n, len(counts), perms)
+		}
+		if identity == 0 || fixed == 0 {
+			t.Errorf("n=%d: got %d identities and %d permutations with fixed points", test.n, identity, fixed)
+		}
+		expected := float64(test.trials) / float64(perms)
+		chi2 := 0.0
+		for _, c := range counts {
+			d := float64(c) - expected
+			chi2 += d * d / expected
+		}
+		chi2 += float64(perms-len(counts)) * expected
+		if chi2 > test.threshold {
+			t.Errorf("n=%d: chi-squared statistic is %.2f, want at most %.2f", test.n, chi2, test.threshold)
+		}
+	}
+	if perm := testPerm(t, 0); len(perm) != 0 {
+		t.Errorf("GeneratePerm(0) = %v", perm)
+	}
+}
+
 // Test the ILMP protocol on various batch sizes.
 func TestSILMPP(t *testing.T) {
 	params := NewKeyParametersFromStrings(testP, testG, testQ)
@@ -227,7 +460,7 @@ func TestShuffle0ProveVerify(t *testing.T) {
 		x[i] = *t
 	}
 
-	pi := GeneratePerm(N)
+	pi := testPerm(t, N)
 	for i := 0; i < N; i++ {
 		y[i].Set(&x[pi[i]])
 	}
@@ -272,7 +505,7 @@ func TestBadShuffle0ProveVerify(t *testing.T) {
 		x[i] = *t
 	}
 
-	pi := GeneratePerm(N)
+	pi := testPerm(t, N)
 	for i := 0; i < N; i++ {
 		y[i].Set(&x[pi[i]])
 	}
@@ -301,3 +534,248 @@ func TestBadShuffle0ProveVerify(t *testing.T) {
 		t.Errorf("verification succeeded, expected failure")
 	}
 }
+
+// testShuffle0Instance generates an instance of Shuffle0 of length N. It
+// returns the prover's input (x, y, c, d) and the verifier's input (X, Y, C,
+// D).
+func testShuffle0Instance(t testing.TB, params *KeyParameters, N int) (x, y []big.Int, c, d *big.Int, X, Y []big.Int, C, D *big.Int) {
+	c = testSample(t, params)
+	d = testSample(t, params)
+	C = new(big.Int).Exp(params.G, c, params.P)
+	D = new(big.Int).Exp(params.G, d, params.P)
+
+	x = make([]big.Int, N)
+	y = make([]big.Int, N)
+	for i := 0; i < N; i++ {
+		x[i].Set(testSample(t, params))
+	}
+
+	pi := testPerm(t, N)
+	for i := 0; i < N; i++ {
+		y[i].Set(&x[pi[i]])
+	}
+
+	X = make([]big.Int, N)
+	Y = make([]big.Int, N)
+	for i := 0; i < N; i++ {
+		y[i].Mul(&y[i], c)
+		x[i].Mul(&x[i], d)
+		X[i].Exp(params.G, &x[i], params.P)
+		Y[i].Exp(params.G, &y[i], params.P)
+	}
+	return
+}
+
+// Test that the ILMP prover refuses degenerate inputs, i.e., sequences
+// containing 0.
+func TestILMPDegenerate(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+
+	N := 5
+	for _, bad := range []string{"x", "y"} {
+		for j := 0; j < N; j++ {
+			x := make([]big.Int, N)
+			y := make([]big.Int, N)
+			for i := 0; i < N; i++ {
+				x[i].SetInt64(int64(i) + 2)
+				y[i].SetInt64(int64(N-i) + 1)
+			}
+			if bad == "x" {
+				x[j].SetInt64(0)
+			} else {
+				y[j].Set(params.Q)
+			}
+
+			X := make([]big.Int, N)
+			Y := make([]big.Int, N)
+			for i := 0; i < N; i++ {
+				X[i].Exp(params.G, &x[i], params.P)
+				Y[i].Exp(params.G, &y[i], params.P)
+			}
+
+			msg := make(chan []big.Int)
+			done := make(chan error)
+			go func() {
+				done <- params.ILMPProve(x, y, msg)
+			}()
+
+			if ok, err := params.ILMPVerify(X, Y, msg); err == nil {
+				t.Errorf("%s[%d] = 0: verifier: ok = %v: expected error", bad, j, ok)
+			}
+			if err := <-done; err == nil {
+				t.Errorf("%s[%d] = 0: prover succeeds: expected error", bad, j)
+			}
+		}
+	}
+}
+
+// Test the ILMP protocol on inputs with repeated elements.
+func TestILMPDuplicates(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+
+	N := 6
+	c, _ := params.Sample()
+	x := make([]big.Int, N)
+	y := make([]big.Int, N)
+	for i := 0; i < N; i++ {
+		x[i].Set(c)
+		y[i].Set(c)
+	}
+
+	X := make([]big.Int, N)
+	Y := make([]big.Int, N)
+	for i := 0; i < N; i++ {
+		X[i].Exp(params.G, &x[i], params.P)
+		Y[i].Exp(params.G, &y[i], params.P)
+	}
+
+	msg := make(chan []big.Int)
+	go func() {
+		if err := params.ILMPProve(x, y, msg); err != nil {
+			t.Errorf("prover: %s", err)
+		}
+	}()
+
+	if ok, err := params.ILMPVerify(X, Y, msg); err != nil {
+		t.Errorf("verifier: %s", err)
+	} else if !ok {
+		t.Error("failed to verify")
+	}
+}
+
+// Test the Shuffle0 protocol on inputs with repeated elements.
+func TestShuffle0Duplicates(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+
+	c, _ := params.Sample()
+	d, _ := params.Sample()
+	C := new(big.Int).Exp(params.G, c, params.P)
+	D := new(big.Int).Exp(params.G, d, params.P)
+
+	N := 6
+	x := make([]big.Int, N)
+	y := make([]big.Int, N)
+	for i := 0; i < N; i++ {
+		t, _ := params.Sample()
+		x[i] = *t
+	}
+	x[1].Set(&x[0])
+	x[4].Set(&x[0])
+
+	pi := testPerm(t, N)
+	for i := 0; i < N; i++ {
+		y[i].Set(&x[pi[i]])
+	}
+
+	X := make([]big.Int, N)
+	Y := make([]big.Int, N)
+	for i := 0; i < N; i++ {
+		y[i].Mul(&y[i], c)
+		x[i].Mul(&x[i], d)
+		X[i].Exp(params.G, &x[i], params.P)
+		Y[i].Exp(params.G, &y[i], params.P)
+	}
+
+	msg := make(chan []big.Int)
+	go func() {
+		if err := params.Shuffle0Prove(x, y, c, d, msg); err != nil {
+			t.Errorf("prover: %s", err)
+		}
+	}()
+
+	if ok, err := params.Shuffle0Verify(X, Y, C, D, msg); err != nil {
+		t.Errorf("verifier: %s", err)
+	} else if !ok {
+		t.Error("failed to verify")
+	}
+}
+
+// Test that the Shuffle0 verifier refuses a degenerate D.
+func TestShuffle0Degenerate(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+
+	x, y, c, d, X, Y, C, _ := testShuffle0Instance(t, params, 4)
+	D := new(big.Int)
+
+	msg := make(chan []big.Int)
+	done := make(chan error)
+	go func() {
+		done <- params.Shuffle0Prove(x, y, c, d, msg)
+	}()
+
+	if _, err := params.Shuffle0Verify(X, Y, C, D, msg); err == nil {
+		t.Error("verifier succeeds: expected error")
+	}
+	if err := <-done; err == nil {
+		t.Error("prover succeeds: expected error")
+	}
+}
+
+// Test that the ILMP and Shuffle0 provers refuse inputs that are too short
+// and that the verifier returns an error rather than waiting forever.
+func TestShortInputs(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+
+	for N := 0; N < 2; N++ {
+		x, y, X, Y := benchILMPInstance(t, params, N)
+		msg := make(chan []big.Int)
+		done := make(chan error)
+		go func() {
+			done <- params.ILMPProve(x, y, msg)
+		}()
+		if _, err := params.ILMPVerify(X, Y, msg); err == nil {
+			t.Errorf("ILMP, N=%d: verifier succeeds: expected error", N)
+		}
+		if err := <-done; err == nil {
+			t.Errorf("ILMP, N=%d: prover succeeds: expected error", N)
+		}
+	}
+
+	x, y, c, d, X, Y, C, D := testShuffle0Instance(t, params, 0)
+	msg := make(chan []big.Int)
+	done := make(chan error)
+	go func() {
+		done <- params.Shuffle0Prove(x, y, c, d, msg)
+	}()
+	if _, err := params.Shuffle0Verify(X, Y, C, D, msg); err == nil {
+		t.Error("Shuffle0, N=0: verifier succeeds: expected error")
+	}
+	if err := <-done; err == nil {
+		t.Error("Shuffle0, N=0: prover succeeds: expected error")
+	}
+}
+
+// Test that the ILMP and Shuffle0 provers refuse a challenge of the wrong
+// length.
+func TestMalformedChallenge(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+
+	for _, gamma := range [][]big.Int{{}, make([]big.Int, 2)} {
+		x, y, _, _ := benchILMPInstance(t, params, 4)
+		msg := make(chan []big.Int)
+		done := make(chan error)
+		go func() {
+			done <- params.ILMPProve(x, y, msg)
+		}()
+		<-msg
+		msg <- gamma
+		if r := <-msg; r != nil {
+			t.Errorf("ILMP, |gamma|=%d: prover responds: expected nil", len(gamma))
+		}
+		if err := <-done; err == nil {
+			t.Errorf("ILMP, |gamma|=%d: prover succeeds: expected error", len(gamma))
+		}
+
+		x, y, c, d, _, _, _, _ := testShuffle0Instance(t, params, 4)
+		go func() {
+			done <- params.Shuffle0Prove(x, y, c, d, msg)
+		}()
+		msg <- gamma
+		if A := <-msg; A != nil {
+			t.Errorf("Shuffle0, |t|=%d: prover responds: expected nil", len(gamma))
+		}
+		if err := <-done; err == nil {
+			t.Errorf("Shuffle0, |t|=%d: prover succeeds: expected error", len(gamma))
+		}
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// ILMPSimulate is the honest-verifier zero-knowledge simulator for ILMP. Given
+// only the public sequences X and Y and the verifier's challenge gamma, it
+// outputs the prover's messages A and r of a transcript (A, gamma, r) that is
+// accepted by the verification equations.
+//
+// The simulator picks r_1, ..., r_{n-1} uniformly from [1..q-1] and solves
+// the verification equations for A. In a real run, each r_i = theta_i + e_i,
+// where theta_i is uniform in [1..q-1] and e_i is determined by the witness
+// and gamma; hence r_i is uniform on all but one element of Z/q. In both
+// cases A is determined by (gamma, r), so the two distributions are
+// statistically close.
+func (params *KeyParameters) ILMPSimulate(X, Y []big.Int, gamma *big.Int) (A, r []big.Int, err error) {
+	N := len(X)
+	if len(Y) != N {
+		return nil, nil, errors.New("input lengths do not match")
+	}
+	if N < 2 {
+		return nil, nil, errors.New("input length must be at least 2")
+	}
+	s := NewScratch()
+
+	r = make([]big.Int, N-1)
+	for i := 0; i < N-1; i++ {
+		if err := params.sampleInto(&r[i], s); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	A = make([]big.Int, N)
+	var L, R, e big.Int
+
+	// First equation: A_1 = Y_1^{r_1} / X_1^{e}, where e = -gamma if n-1 is
+	// odd and e = gamma otherwise.
+	e.Set(gamma)
+	if (N-1)%2 == 1 {
+		e.Sub(params.Q, gamma)
+	}
+	L.Exp(&Y[0], &r[0], params.P)
+	R.Exp(&X[0], &e, params.P)
+	if _, err := inverse(&R, &R, params.P); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("X[0]: %v", err))
+	}
+	s.mulMod(&A[0], &L, &R, params.P)
+
+	// Intermediate equations: A_i = X_i^{r_{i-1}} Y_i^{r_i}.
+	for i := 1; i < N-1; i++ {
+		L.Exp(&X[i], &r[i-1], params.P)
+		R.Exp(&Y[i], &r[i], params.P)
+		s.mulMod(&A[i], &L, &R, params.P)
+	}
+
+	// Last equation: A_n = X_n^{r_{n-1}} / Y_n^{-gamma}.
+	e.Sub(params.Q, gamma)
+	L.Exp(&X[N-1], &r[N-2], params.P)
+	R.Exp(&Y[N-1], &e, params.P)
+	if _, err := inverse(&R, &R, params.P); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Y[%d]: %v", N-1, err))
+	}
+	s.mulMod(&A[N-1], &L, &R, params.P)
+
+	return A, r, nil
+}
+
+// Shuffle0Simulate is the honest-verifier zero-knowledge simulator for
+// Shuffle0. Given only the public sequences X and Y, the elements C and D, and
+// the verifier's challenges t and gamma, it outputs the prover's messages A
+// and r of a transcript (t, A, gamma, r) that is accepted by the verification
+// equations. It runs ILMPSimulate on the sequences the verifier computes from
+// t.
+func (params *KeyParameters) Shuffle0Simulate(X, Y []big.Int, C, D, t, gamma *big.Int) (A, r []big.Int, err error) {
+	Phi, Psi, err := params.shuffle0Statement(X, Y, C, D, t, NewScratch())
+	if err != nil {
+		return nil, nil, err
+	}
+	if A, r, err = params.ILMPSimulate(Phi, Psi, gamma); err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("ilmp: %v", err))
+	}
+	return A, r, nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// testRandomElements returns N random elements of <G>.
+func testRandomElements(params *KeyParameters, N int) []big.Int {
+	X := make([]big.Int, N)
+	for i := 0; i < N; i++ {
+		x, _ := params.Sample()
+		X[i].Exp(params.G, x, params.P)
+	}
+	return X
+}
+
+// Test that simulated transcripts of ILMP are accepted by the verification
+// equations, even when the statement is false.
+func TestILMPSimulate(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	s := NewScratch()
+	for N := 2; N < 10; N++ {
+		X := testRandomElements(params, N)
+		Y := testRandomElements(params, N)
+		gamma, _ := params.Sample()
+
+		A, r, err := params.ILMPSimulate(X, Y, gamma)
+		if err != nil {
+			t.Fatalf("%d: ILMPSimulate() fails: %s", N, err)
+		}
+		for i := range r {
+			if r[i].Sign() <= 0 || r[i].Cmp(params.Q) >= 0 {
+				t.Errorf("%d: r[%d] is not in [1..Q-1]", N, i)
+			}
+		}
+		if !params.ilmpCheck(X, Y, A, gamma, r, s) {
+			t.Errorf("%d: simulated transcript is rejected", N)
+		}
+
+		// The transcript is bound to the challenge.
+		gamma.Add(gamma, params.one)
+		if params.ilmpCheck(X, Y, A, gamma, r, s) {
+			t.Errorf("%d: simulated transcript is accepted for the wrong challenge", N)
+		}
+	}
+}
+
+// Test that the simulator refuses inputs that are too short.
+func TestILMPSimulateShort(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	gamma, _ := params.Sample()
+	for N := 0; N < 2; N++ {
+		X := testRandomElements(params, N)
+		if _, _, err := params.ILMPSimulate(X, X, gamma); err == nil {
+			t.Errorf("%d: ILMPSimulate() succeeds: expected error", N)
+		}
+	}
+}
+
+// Test that transcripts of honest runs of ILMP are accepted by the same
+// verification equations that are used for simulated ones.
+func TestILMPCheckHonest(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 10
+	x, y, X, Y := benchILMPInstance(t, params, N)
+
+	msg := make(chan []big.Int)
+	go func() {
+		if err := params.ILMPProve(x, y, msg); err != nil {
+			t.Errorf("prover: %s", err)
+		}
+	}()
+
+	A := <-msg
+	gamma, _ := params.Sample()
+	msg <- []big.Int{*new(big.Int).Set(gamma)}
+	r := <-msg
+
+	if !params.ilmpCheck(X, Y, A, gamma, r, NewScratch()) {
+		t.Error("honest transcript is rejected")
+	}
+}
+
+// Test that simulated transcripts of Shuffle0 are accepted by the verification
+// equations, both for shuffles and for non-shuffles.
+func TestShuffle0Simulate(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	s := NewScratch()
+
+	N := 10
+	_, _, _, _, X, Y, C, D := testShuffle0Instance(t, params, N)
+	Z := testRandomElements(params, N)
+	for _, Y := range [][]big.Int{Y, Z} {
+		tt, _ := params.Sample()
+		gamma, _ := params.Sample()
+		A, r, err := params.Shuffle0Simulate(X, Y, C, D, tt, gamma)
+		if err != nil {
+			t.Fatal("Shuffle0Simulate() fails:", err)
+		}
+		if !params.shuffle0Check(X, Y, C, D, tt, A, gamma, r, s) {
+			t.Error("simulated transcript is rejected")
+		}
+
+		tt.Add(tt, params.one)
+		if params.shuffle0Check(X, Y, C, D, tt, A, gamma, r, s) {
+			t.Error("simulated transcript is accepted for the wrong challenge")
+		}
+	}
+}
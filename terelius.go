@@ -0,0 +1,322 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"math/big"
+)
+
+// This file implements the shuffle proof of Terelius and Wikstrom
+// (AFRICACRYPT 2010) in the form used by Verificatum, made non-interactive
+// with the Fiat-Shamir transform. The prover first commits to the permutation
+// matrix column by column: U[j] = G^r[j] H[perm[j]], where H[0], ..., H[N-1]
+// are derived with HashToGroup. The commitment does not depend on the
+// ciphertexts, so it can be computed offline.
+//
+// Given random e, the proof shows that U commits to a permutation matrix,
+// i.e., that prod U[j] / prod H[i] = G^r' for a known r' and that the
+// exponents e' such that prod U[j]^e[j] = G^r'' prod H[i]^e'[i] satisfy prod
+// e'[i] = prod e[i]. It then shows that prod (R2[i], C2[i])^e'[i] is a
+// re-encryption of prod (R[j], C[j])^e[j] with the same e'. The product is
+// proven with a chain of commitments CHat[i] = G^rHat[i] CHat[i-1]^e'[i],
+// starting from a further generator.
+//
+// As with BayerGrothProve, exponents are computed mod Q, so every ciphertext
+// must be an element of <G> x <G>.
+
+// tereliusWikstromKey derives the generators for N ciphertexts: H0 for the
+// chain of commitments and H[0], ..., H[N-1] for the permutation commitment.
+func (params *KeyParameters) tereliusWikstromKey(N int) (H0 *big.Int, H []*big.Int) {
+	ck := params.NewPedersenKey("terelius-wikstrom", N)
+	return ck.H, ck.G
+}
+
+// CommitPermutation outputs the commitment U to the permutation perm and the
+// randomness r used to compute it, which the prover needs and must otherwise
+// keep secret.
+func (params *KeyParameters) CommitPermutation(perm Permutation) (U, r []*big.Int, err error) {
+	N := len(perm)
+	if err := perm.Validate(N); err != nil {
+		return nil, nil, err
+	}
+	_, H := params.tereliusWikstromKey(N)
+	if r, err = params.sampleVec(N); err != nil {
+		return nil, nil, err
+	}
+	U = make([]*big.Int, N)
+	for j := range U {
+		U[j] = new(big.Int).Exp(params.G, r[j], params.P)
+		U[j].Mul(U[j], H[perm[j]])
+		U[j].Mod(U[j], params.P)
+	}
+	return U, r, nil
+}
+
+// TereliusWikstromProof is a non-interactive proof that a sequence of
+// ciphertexts is a re-encryption shuffle of another under the permutation
+// committed by a permutation commitment. CHat is the chain of commitments;
+// the T values are the prover's commitments and the K values its responses.
+type TereliusWikstromProof struct {
+	CHat           []*big.Int
+	T1, T2, T3     *big.Int
+	T4R, T4C       *big.Int
+	THat           []*big.Int
+	K1, K2, K3, K4 *big.Int
+	KHat, KPrime   []*big.Int
+}
+
+// tereliusWikstromTranscript starts the Fiat-Shamir transcript with the
+// statement and derives the vector e.
+func (pk *PublicKey) tereliusWikstromTranscript(U, R, C, R2, C2 []*big.Int, context []byte) (th *transcriptHash, e []*big.Int) {
+	th = pk.newTranscriptHash("terelius-wikstrom")
+	th.writeInts(pk.Y)
+	th.writeBytes(context)
+	th.writeInts(U...)
+	th.writeInts(R...)
+	th.writeInts(C...)
+	th.writeInts(R2...)
+	th.writeInts(C2...)
+	e = make([]*big.Int, len(U))
+	for i := range e {
+		th.writeInts(big.NewInt(int64(i)))
+		e[i] = th.challenge(&pk.KeyParameters)
+	}
+	return th, e
+}
+
+// TereliusWikstromProve outputs a proof that (R2, C2) is a re-encryption
+// shuffle of (R, C) under the permutation committed by U. The inputs perm and
+// r are as input to and output by CommitPermutation, and rands is as output by
+// ReEncryptionMix. The proof is bound to context.
+func (pk *PublicKey) TereliusWikstromProve(U []*big.Int, perm Permutation, r []*big.Int, R, C, R2, C2 []*big.Int, rands []*big.Int, context []byte) (*TereliusWikstromProof, error) {
+	N := len(R)
+	if len(C) != N || len(R2) != N || len(C2) != N || len(rands) != N ||
+		len(U) != N || len(r) != N || N == 0 {
+		return nil, errors.New("input lengths do not match or are zero")
+	}
+	if err := perm.Validate(N); err != nil {
+		return nil, err
+	}
+	params := &pk.KeyParameters
+	if !params.areElements(R...) || !params.areElements(C...) ||
+		!params.areElements(R2...) || !params.areElements(C2...) {
+		return nil, errors.New("ciphertext is not an element of <G> x <G>")
+	}
+	H0, H := params.tereliusWikstromKey(N)
+	th, e := pk.tereliusWikstromTranscript(U, R, C, R2, C2, context)
+
+	// ep[perm[j]] = e[j], so that prod U[j]^e[j] = G^<r, e> prod H[i]^ep[i].
+	ep := perm.Apply(e)
+
+	rHat, err := params.sampleVec(N)
+	if err != nil {
+		return nil, err
+	}
+	omega, err := params.sampleVec(4)
+	if err != nil {
+		return nil, err
+	}
+	omegaHat, err := params.sampleVec(N)
+	if err != nil {
+		return nil, err
+	}
+	omegaPrime, err := params.sampleVec(N)
+	if err != nil {
+		return nil, err
+	}
+
+	proof := &TereliusWikstromProof{
+		CHat: make([]*big.Int, N),
+		THat: make([]*big.Int, N),
+	}
+	var t big.Int
+	prev := H0
+	for i := 0; i < N; i++ {
+		proof.CHat[i] = new(big.Int).Exp(params.G, rHat[i], params.P)
+		proof.CHat[i].Mul(proof.CHat[i], t.Exp(prev, ep[i], params.P))
+		proof.CHat[i].Mod(proof.CHat[i], params.P)
+		proof.THat[i] = new(big.Int).Exp(params.G, omegaHat[i], params.P)
+		proof.THat[i].Mul(proof.THat[i], t.Exp(prev, omegaPrime[i], params.P))
+		proof.THat[i].Mod(proof.THat[i], params.P)
+		prev = proof.CHat[i]
+	}
+	proof.T1 = new(big.Int).Exp(params.G, omega[0], params.P)
+	proof.T2 = new(big.Int).Exp(params.G, omega[1], params.P)
+	proof.T3 = new(big.Int).Exp(params.G, omega[2], params.P)
+	proof.T3.Mul(proof.T3, params.expProd(H, omegaPrime))
+	proof.T3.Mod(proof.T3, params.P)
+	negOmega4 := new(big.Int).Sub(params.Q, omega[3])
+	proof.T4R, proof.T4C = pk.encryptWith(params.one, negOmega4)
+	params.mulCt(proof.T4R, proof.T4C, params.expProd(R2, omegaPrime), params.expProd(C2, omegaPrime))
+
+	th.writeInts(proof.CHat...)
+	th.writeInts(proof.T1, proof.T2, proof.T3, proof.T4R, proof.T4C)
+	th.writeInts(proof.THat...)
+	v := th.challenge(params)
+
+	// The randomness of the last commitment of the chain, computed by Horner's
+	// rule.
+	rHatAll := new(big.Int)
+	for i := 0; i < N; i++ {
+		rHatAll.Mul(rHatAll, ep[i])
+		rHatAll.Add(rHatAll, rHat[i])
+		rHatAll.Mod(rHatAll, params.Q)
+	}
+	ones := make([]*big.Int, N)
+	for i := range ones {
+		ones[i] = params.one
+	}
+	witness := []*big.Int{
+		params.combine(r, ones),
+		rHatAll,
+		params.combine(r, e),
+		params.combine(rands, e),
+	}
+	K := make([]*big.Int, 4)
+	for l := range K {
+		K[l] = new(big.Int).Mul(v, witness[l])
+		K[l].Add(K[l], omega[l])
+		K[l].Mod(K[l], params.Q)
+	}
+	proof.K1, proof.K2, proof.K3, proof.K4 = K[0], K[1], K[2], K[3]
+	proof.KHat = make([]*big.Int, N)
+	proof.KPrime = make([]*big.Int, N)
+	for i := 0; i < N; i++ {
+		proof.KHat[i] = new(big.Int).Mul(v, rHat[i])
+		proof.KHat[i].Add(proof.KHat[i], omegaHat[i])
+		proof.KHat[i].Mod(proof.KHat[i], params.Q)
+		proof.KPrime[i] = new(big.Int).Mul(v, ep[i])
+		proof.KPrime[i].Add(proof.KPrime[i], omegaPrime[i])
+		proof.KPrime[i].Mod(proof.KPrime[i], params.Q)
+	}
+	return proof, nil
+}
+
+// TereliusWikstromVerify verifies a proof output by TereliusWikstromProve that
+// (R2, C2) is a re-encryption shuffle of (R, C) under the permutation
+// committed by U.
+func (pk *PublicKey) TereliusWikstromVerify(U, R, C, R2, C2 []*big.Int, proof *TereliusWikstromProof, context []byte) bool {
+	N := len(R)
+	if len(C) != N || len(R2) != N || len(C2) != N || len(U) != N || N == 0 || proof == nil {
+		return false
+	}
+	params := &pk.KeyParameters
+	if len(proof.CHat) != N || len(proof.THat) != N || len(proof.KHat) != N || len(proof.KPrime) != N ||
+		!params.areElements(U...) || !params.areElements(proof.CHat...) || !params.areElements(proof.THat...) ||
+		!params.areElements(proof.T1, proof.T2, proof.T3, proof.T4R, proof.T4C) ||
+		!params.areScalars(proof.K1, proof.K2, proof.K3, proof.K4) ||
+		!params.areScalars(proof.KHat...) || !params.areScalars(proof.KPrime...) {
+		return false
+	}
+	if !params.areElements(R...) || !params.areElements(C...) ||
+		!params.areElements(R2...) || !params.areElements(C2...) {
+		return false
+	}
+	H0, H := params.tereliusWikstromKey(N)
+	th, e := pk.tereliusWikstromTranscript(U, R, C, R2, C2, context)
+	th.writeInts(proof.CHat...)
+	th.writeInts(proof.T1, proof.T2, proof.T3, proof.T4R, proof.T4C)
+	th.writeInts(proof.THat...)
+	v := th.challenge(params)
+
+	// check outputs whether X^v T = Z.
+	check := func(X, T, Z *big.Int) bool {
+		L := new(big.Int).Exp(X, v, params.P)
+		L.Mul(L, T)
+		L.Mod(L, params.P)
+		return L.Cmp(Z) == 0
+	}
+	ones := make([]*big.Int, N)
+	for i := range ones {
+		ones[i] = params.one
+	}
+
+	// U commits to a matrix whose rows sum to 1.
+	X := params.expProd(U, ones)
+	Hinv, err := inverse(new(big.Int), params.expProd(H, ones), params.P)
+	if err != nil {
+		return false
+	}
+	X.Mul(X, Hinv)
+	X.Mod(X, params.P)
+	if !check(X, proof.T1, new(big.Int).Exp(params.G, proof.K1, params.P)) {
+		return false
+	}
+
+	// The committed exponents have the same product as e.
+	prodE := new(big.Int).Set(params.one)
+	for i := range e {
+		prodE.Mul(prodE, e[i])
+		prodE.Mod(prodE, params.Q)
+	}
+	if X, err = inverse(new(big.Int), new(big.Int).Exp(H0, prodE, params.P), params.P); err != nil {
+		return false
+	}
+	X.Mul(X, proof.CHat[N-1])
+	X.Mod(X, params.P)
+	if !check(X, proof.T2, new(big.Int).Exp(params.G, proof.K2, params.P)) {
+		return false
+	}
+
+	// prod U[j]^e[j] commits to the exponents.
+	Z := new(big.Int).Exp(params.G, proof.K3, params.P)
+	Z.Mul(Z, params.expProd(H, proof.KPrime))
+	Z.Mod(Z, params.P)
+	if !check(params.expProd(U, e), proof.T3, Z) {
+		return false
+	}
+
+	// The outputs raised to the exponents re-encrypt the inputs raised to e.
+	negK4 := new(big.Int).Sub(params.Q, proof.K4)
+	ZR, ZC := pk.encryptWith(params.one, negK4)
+	params.mulCt(ZR, ZC, params.expProd(R2, proof.KPrime), params.expProd(C2, proof.KPrime))
+	if !check(params.expProd(R, e), proof.T4R, ZR) || !check(params.expProd(C, e), proof.T4C, ZC) {
+		return false
+	}
+
+	// The chain of commitments is computed with the exponents.
+	prev := H0
+	for i := 0; i < N; i++ {
+		Z := new(big.Int).Exp(params.G, proof.KHat[i], params.P)
+		Z.Mul(Z, new(big.Int).Exp(prev, proof.KPrime[i], params.P))
+		Z.Mod(Z, params.P)
+		if !check(proof.CHat[i], proof.THat[i], Z) {
+			return false
+		}
+		prev = proof.CHat[i]
+	}
+	return true
+}
+
+// Len outputs the number of group elements and the number of elements of Z/q
+// in the proof.
+func (proof *TereliusWikstromProof) Len() (elements, scalars int) {
+	return len(proof.CHat) + len(proof.THat) + 5, len(proof.KHat) + len(proof.KPrime) + 4
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// Test that a proof verifies when the permutation is committed before the
+// ciphertexts are known.
+func TestTereliusWikstromProveVerify(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	context := []byte("test")
+	for _, N := range []int{1, 2, 5} {
+		perm := testPerm(t, N)
+		U, r, err := params.CommitPermutation(perm)
+		if err != nil {
+			t.Fatalf("N=%d: CommitPermutation() fails: %s", N, err)
+		}
+		pk, R, C, _, _, _, _ := testBayerGrothInstance(t, params, N)
+		R2, C2, rands, err := pk.ReEncryptionMix(R, C, perm)
+		if err != nil {
+			t.Fatalf("N=%d: ReEncryptionMix() fails: %s", N, err)
+		}
+		proof, err := pk.TereliusWikstromProve(U, perm, r, R, C, R2, C2, rands, context)
+		if err != nil {
+			t.Fatalf("N=%d: TereliusWikstromProve() fails: %s", N, err)
+		}
+		if !pk.TereliusWikstromVerify(U, R, C, R2, C2, proof, context) {
+			t.Errorf("N=%d: TereliusWikstromVerify() rejects a valid proof", N)
+		}
+		if elements, scalars := proof.Len(); elements != 2*N+5 || scalars != 2*N+4 {
+			t.Errorf("N=%d: Len() = %d, %d; want %d, %d", N, elements, scalars, 2*N+5, 2*N+4)
+		}
+		if pk.TereliusWikstromVerify(U, R, C, R2, C2, proof, []byte("other")) {
+			t.Errorf("N=%d: TereliusWikstromVerify() accepts a proof for another context", N)
+		}
+	}
+}
+
+// Test that the verifier rejects a modified output, a commitment to a
+// different permutation and a commitment that is not to a permutation.
+func TestTereliusWikstromRejects(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	context := []byte("test")
+	N := 4
+	pk, R, C, R2, C2, perm, rands := testBayerGrothInstance(t, params, N)
+	U, r, err := params.CommitPermutation(perm)
+	if err != nil {
+		t.Fatal("CommitPermutation() fails:", err)
+	}
+	proof, err := pk.TereliusWikstromProve(U, perm, r, R, C, R2, C2, rands, context)
+	if err != nil {
+		t.Fatal("TereliusWikstromProve() fails:", err)
+	}
+
+	// Replace an output with an encryption of another message.
+	R3 := append([]*big.Int(nil), R2...)
+	C3 := append([]*big.Int(nil), C2...)
+	if R3[0], C3[0], err = pk.EncryptExp(big.NewInt(int64(N + 1))); err != nil {
+		t.Fatal("EncryptExp() fails:", err)
+	}
+	if pk.TereliusWikstromVerify(U, R, C, R3, C3, proof, context) {
+		t.Error("TereliusWikstromVerify() accepts a modified output")
+	}
+	if proof, err := pk.TereliusWikstromProve(U, perm, r, R, C, R3, C3, rands, context); err != nil {
+		t.Fatal("TereliusWikstromProve() fails:", err)
+	} else if pk.TereliusWikstromVerify(U, R, C, R3, C3, proof, context) {
+		t.Error("TereliusWikstromVerify() accepts a proof of a false statement")
+	}
+
+	// Commit to another permutation.
+	other := []int{perm[1], perm[0], perm[2], perm[3]}
+	U2, r2, err := params.CommitPermutation(other)
+	if err != nil {
+		t.Fatal("CommitPermutation() fails:", err)
+	}
+	if pk.TereliusWikstromVerify(U2, R, C, R2, C2, proof, context) {
+		t.Error("TereliusWikstromVerify() accepts a proof for another commitment")
+	}
+	if proof, err := pk.TereliusWikstromProve(U2, other, r2, R, C, R2, C2, rands, context); err != nil {
+		t.Fatal("TereliusWikstromProve() fails:", err)
+	} else if pk.TereliusWikstromVerify(U2, R, C, R2, C2, proof, context) {
+		t.Error("TereliusWikstromVerify() accepts a proof under the wrong permutation")
+	}
+
+	// Commit to a matrix with two ones in the same row, bypassing the check in
+	// CommitPermutation.
+	_, H := params.tereliusWikstromKey(N)
+	U3 := append([]*big.Int(nil), U...)
+	U3[1] = new(big.Int).Exp(params.G, r[1], params.P)
+	U3[1].Mul(U3[1], H[perm[0]])
+	U3[1].Mod(U3[1], params.P)
+	bad := append([]int(nil), perm...)
+	bad[1] = perm[0]
+	if proof, err := pk.TereliusWikstromProve(U3, perm, r, R, C, R2, C2, rands, context); err != nil {
+		t.Fatal("TereliusWikstromProve() fails:", err)
+	} else if pk.TereliusWikstromVerify(U3, R, C, R2, C2, proof, context) {
+		t.Error("TereliusWikstromVerify() accepts a commitment to a non-permutation")
+	}
+
+	if _, _, err := params.CommitPermutation(bad); err == nil {
+		t.Error("CommitPermutation() accepts a non-permutation")
+	}
+}
@@ -0,0 +1,376 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// This file implements t-of-n threshold ElGamal. The n trustees, numbered 1,
+// ..., n, run Pedersen's distributed key generation protocol [Pedersen,
+// EUROCRYPT 1991], in which each trustee deals a Feldman verifiable secret
+// sharing of a random exponent. The joint secret key X is the sum of the dealt
+// exponents and is never reconstructed: trustee j holds a share X_j = f(j) of
+// a polynomial f of degree t-1 with f(0) = X. Any t trustees can decrypt by
+// publishing partial decryptions, each with a proof of correctness, which are
+// combined by Lagrange interpolation in the exponent.
+
+// Dealing is the public part of a trustee's contribution to distributed key
+// generation. Commitments[k] = G^{a_k}, where a_0, ..., a_{t-1} are the
+// coefficients of the trustee's polynomial. Proof is a proof of knowledge of
+// a_0, which prevents a trustee from choosing its contribution as a function
+// of the others'.
+type Dealing struct {
+	Commitments []*big.Int
+	Proof       *SchnorrProof
+}
+
+// dealingContext binds the proof of knowledge in a dealing to the dealer.
+func dealingContext(i int) []byte {
+	return []byte(fmt.Sprintf("dkg trustee %d", i))
+}
+
+// Deal implements trustee i's role in distributed key generation of a t-of-n
+// key. It outputs the trustee's public dealing and the shares, where
+// shares[j-1] must be sent to trustee j over a private channel.
+func (params *KeyParameters) Deal(i, t, n int) (dealing *Dealing, shares []*big.Int, err error) {
+	if t < 1 || n < t {
+		return nil, nil, errors.New(fmt.Sprintf("invalid threshold %d of %d", t, n))
+	}
+	if i < 1 || i > n {
+		return nil, nil, errors.New(fmt.Sprintf("invalid trustee %d", i))
+	}
+
+	a := make([]*big.Int, t)
+	dealing = &Dealing{Commitments: make([]*big.Int, t)}
+	for k := range a {
+		if a[k], err = params.Sample(); err != nil {
+			return nil, nil, err
+		}
+		dealing.Commitments[k] = new(big.Int).Exp(params.G, a[k], params.P)
+	}
+	if dealing.Proof, err = params.SchnorrProveNI(a[0], dealingContext(i)); err != nil {
+		return nil, nil, err
+	}
+
+	// Evaluate the polynomial at 1, ..., n by Horner's rule.
+	shares = make([]*big.Int, n)
+	for j := range shares {
+		x := big.NewInt(int64(j + 1))
+		s := new(big.Int)
+		for k := t - 1; k >= 0; k-- {
+			s.Mul(s, x)
+			s.Add(s, a[k])
+			s.Mod(s, params.Q)
+		}
+		shares[j] = s
+	}
+	return dealing, shares, nil
+}
+
+// VerifyDealing checks that trustee i's dealing is well formed for threshold
+// t.
+func (params *KeyParameters) VerifyDealing(i, t int, dealing *Dealing) bool {
+	if dealing == nil || len(dealing.Commitments) != t {
+		return false
+	}
+	for _, A := range dealing.Commitments {
+		if A == nil || !params.IsElement(A) {
+			return false
+		}
+	}
+	return params.SchnorrVerifyNI(dealing.Commitments[0], dealing.Proof, dealingContext(i))
+}
+
+// evalCommitments computes G^{f(j)} from the commitments G^{a_k} to the
+// coefficients of f.
+func (params *KeyParameters) evalCommitments(j int, commitments []*big.Int) *big.Int {
+	x := big.NewInt(int64(j))
+	xk := new(big.Int).Set(params.one)
+	Z := new(big.Int).Set(params.one)
+	var t big.Int
+	for _, A := range commitments {
+		t.Exp(A, xk, params.P)
+		Z.Mul(Z, &t)
+		Z.Mod(Z, params.P)
+		xk.Mul(xk, x)
+		xk.Mod(xk, params.Q)
+	}
+	return Z
+}
+
+// VerifyShare checks the share that trustee j received against the dealer's
+// dealing. If the check fails, trustee j should publish a complaint against the
+// dealer.
+func (params *KeyParameters) VerifyShare(j int, share *big.Int, dealing *Dealing) bool {
+	if share == nil || share.Sign() < 0 || share.Cmp(params.Q) >= 0 {
+		return false
+	}
+	L := new(big.Int).Exp(params.G, share, params.P)
+	return L.Cmp(params.evalCommitments(j, dealing.Commitments)) == 0
+}
+
+// ThresholdPublicKey is a t-of-n ElGamal public key. Messages are encrypted
+// under the embedded PublicKey as usual. VerificationKeys[j-1] = G^{X_j} is
+// the public key corresponding to trustee j's share, which is used to check
+// the trustee's partial decryptions.
+type ThresholdPublicKey struct {
+	PublicKey
+	T, N             int
+	VerificationKeys []*big.Int
+
+	qual []*Dealing
+}
+
+// NewThresholdPublicKey computes the joint public key from the dealings, where
+// dealings[i-1] is trustee i's dealing. A dealing that is nil excludes the
+// trustee from the key, as when it has been disqualified after a complaint.
+// Every other dealing must be valid.
+func (params *KeyParameters) NewThresholdPublicKey(t, n int, dealings []*Dealing) (*ThresholdPublicKey, error) {
+	if t < 1 || n < t {
+		return nil, errors.New(fmt.Sprintf("invalid threshold %d of %d", t, n))
+	}
+	if len(dealings) != n {
+		return nil, errors.New(fmt.Sprintf("got %d dealings, want %d", len(dealings), n))
+	}
+
+	tpk := &ThresholdPublicKey{T: t, N: n, qual: dealings}
+	tpk.KeyParameters = *params
+	tpk.Y = new(big.Int).Set(params.one)
+	qualified := 0
+	for i, d := range dealings {
+		if d == nil {
+			continue
+		}
+		if !params.VerifyDealing(i+1, t, d) {
+			return nil, errors.New(fmt.Sprintf("dealing %d is invalid", i+1))
+		}
+		tpk.Y.Mul(tpk.Y, d.Commitments[0])
+		tpk.Y.Mod(tpk.Y, params.P)
+		qualified++
+	}
+	if qualified == 0 {
+		return nil, errors.New("no qualified dealings")
+	}
+
+	tpk.VerificationKeys = make([]*big.Int, n)
+	for j := range tpk.VerificationKeys {
+		Y := new(big.Int).Set(params.one)
+		for _, d := range dealings {
+			if d != nil {
+				Y.Mul(Y, params.evalCommitments(j+1, d.Commitments))
+				Y.Mod(Y, params.P)
+			}
+		}
+		tpk.VerificationKeys[j] = Y
+	}
+	return tpk, nil
+}
+
+// verificationKey returns the public key corresponding to trustee j's share.
+func (tpk *ThresholdPublicKey) verificationKey(j int) *PublicKey {
+	return &PublicKey{KeyParameters: tpk.KeyParameters, Y: tpk.VerificationKeys[j-1]}
+}
+
+// Trustee holds trustee Index's share of a threshold secret key. The embedded
+// SecretKey has the share as its exponent.
+type Trustee struct {
+	SecretKey
+	Index int
+}
+
+// NewTrustee combines the shares that trustee j received, where shares[i-1]
+// was dealt by trustee i, into the trustee's share of the joint secret key.
+// Shares from disqualified dealers are ignored. It returns an error naming the
+// dealer of the first invalid share.
+func (tpk *ThresholdPublicKey) NewTrustee(j int, shares []*big.Int) (*Trustee, error) {
+	if j < 1 || j > tpk.N {
+		return nil, errors.New(fmt.Sprintf("invalid trustee %d", j))
+	}
+	if len(shares) != tpk.N {
+		return nil, errors.New(fmt.Sprintf("got %d shares, want %d", len(shares), tpk.N))
+	}
+	X := new(big.Int)
+	for i, d := range tpk.qual {
+		if d == nil {
+			continue
+		}
+		if !tpk.VerifyShare(j, shares[i], d) {
+			return nil, errors.New(fmt.Sprintf("share from trustee %d is invalid", i+1))
+		}
+		X.Add(X, shares[i])
+		X.Mod(X, tpk.Q)
+	}
+
+	tr := &Trustee{Index: j}
+	tr.KeyParameters = tpk.KeyParameters
+	tr.X = X
+	tr.qMinusX = new(big.Int).Sub(tpk.Q, X)
+	return tr, nil
+}
+
+// DecryptionShare is trustee Index's partial decryption of a batch of
+// ciphertexts {(R[i], C[i])}: Partial[i] = C[i] / R[i]^{X_j}, where X_j is the
+// trustee's share. Proof shows that each partial decryption is correct with
+// respect to the trustee's verification key.
+type DecryptionShare struct {
+	Index   int
+	Partial []*big.Int
+	Proof   *ChaumPedersenProof
+}
+
+// PartialDecrypt outputs the trustee's partial decryption of the batch of
+// ciphertexts {(R[i], C[i])}.
+func (tr *Trustee) PartialDecrypt(R, C []*big.Int) (*DecryptionShare, error) {
+	partial, proof, err := tr.DecryptBatchWithProof(R, C)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptionShare{Index: tr.Index, Partial: partial, Proof: proof}, nil
+}
+
+// VerifyDecryptionShare checks a trustee's partial decryption of the batch of
+// ciphertexts {(R[i], C[i])}.
+func (tpk *ThresholdPublicKey) VerifyDecryptionShare(R, C []*big.Int, share *DecryptionShare) bool {
+	if share == nil || share.Index < 1 || share.Index > tpk.N {
+		return false
+	}
+	return tpk.verificationKey(share.Index).VerifyDecryptionBatch(R, C, share.Partial, share.Proof)
+}
+
+// lagrange computes the Lagrange coefficient for evaluating at 0 the
+// polynomial interpolated from its values at the points in indices, for the
+// point j.
+func (params *KeyParameters) lagrange(j int, indices []int) (*big.Int, error) {
+	num := new(big.Int).Set(params.one)
+	den := new(big.Int).Set(params.one)
+	var t big.Int
+	for _, m := range indices {
+		if m == j {
+			continue
+		}
+		num.Mul(num, t.SetInt64(int64(m)))
+		num.Mod(num, params.Q)
+		den.Mul(den, t.SetInt64(int64(m-j)))
+		den.Mod(den, params.Q)
+	}
+	if _, err := inverse(den, den, params.Q); err != nil {
+		return nil, err
+	}
+	num.Mul(num, den)
+	return num.Mod(num, params.Q), nil
+}
+
+// Combine decrypts the batch of ciphertexts {(R[i], C[i])} from the trustees'
+// partial decryptions. It checks each share and uses the first T valid shares
+// from distinct trustees; invalid shares are skipped, so that a dishonest
+// trustee cannot prevent decryption as long as T trustees are honest.
+func (tpk *ThresholdPublicKey) Combine(R, C []*big.Int, shares []*DecryptionShare) ([]*big.Int, error) {
+	if len(R) != len(C) {
+		return nil, errors.New(fmt.Sprintf(
+			"sequence length mismatch: |R|=%d, |C|=%d", len(R), len(C)))
+	}
+	var valid []*DecryptionShare
+	var indices []int
+	seen := make(map[int]bool)
+	for _, share := range shares {
+		if len(valid) == tpk.T {
+			break
+		}
+		if share == nil || seen[share.Index] || !tpk.VerifyDecryptionShare(R, C, share) {
+			continue
+		}
+		seen[share.Index] = true
+		valid = append(valid, share)
+		indices = append(indices, share.Index)
+	}
+	if len(valid) < tpk.T {
+		return nil, errors.New(fmt.Sprintf(
+			"got %d valid decryption shares, need %d", len(valid), tpk.T))
+	}
+
+	// S[i] = prod_j (C[i] / Partial[i])^{lambda_j} = R[i]^X.
+	S := make([]*big.Int, len(R))
+	for i := range S {
+		S[i] = new(big.Int).Set(tpk.one)
+	}
+	var D big.Int
+	for _, share := range valid {
+		lambda, err := tpk.lagrange(share.Index, indices)
+		if err != nil {
+			return nil, err
+		}
+		for i := range R {
+			Dji, err := tpk.sharedSecret(C[i], share.Partial[i])
+			if err != nil {
+				return nil, err
+			}
+			D.Exp(Dji, lambda, tpk.P)
+			S[i].Mul(S[i], &D)
+			S[i].Mod(S[i], tpk.P)
+		}
+	}
+
+	M := make([]*big.Int, len(R))
+	for i := range M {
+		if _, err := inverse(S[i], S[i], tpk.P); err != nil {
+			return nil, err
+		}
+		M[i] = S[i].Mul(S[i], C[i])
+		M[i].Mod(M[i], tpk.P)
+	}
+	return M, nil
+}
+
+// Decrypt decrypts the ciphertext (R, C) from the trustees' partial
+// decryptions of it. It is the threshold analogue of SecretKey.Decrypt.
+func (tpk *ThresholdPublicKey) Decrypt(R, C *big.Int, shares []*DecryptionShare) (*big.Int, error) {
+	M, err := tpk.Combine([]*big.Int{R}, []*big.Int{C}, shares)
+	if err != nil {
+		return nil, err
+	}
+	return M[0], nil
+}
+
+// Mix decrypts the sequence of ElGamal ciphertexts {(R[i], C[i])} from the
+// trustees' partial decryptions of it, applies the specified permutation, and
+// outputs the resulting sequence. It is the threshold analogue of
+// SecretKey.Mix.
+func (tpk *ThresholdPublicKey) Mix(R, C []*big.Int, perm Permutation, shares []*DecryptionShare) ([]*big.Int, error) {
+	if err := perm.Validate(len(R)); err != nil {
+		return nil, err
+	}
+	M, err := tpk.Combine(R, C, shares)
+	if err != nil {
+		return nil, err
+	}
+	return perm.Apply(M), nil
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"math/big"
+	"testing"
+)
+
+// testDKG runs distributed key generation for a t-of-n key among honest
+// trustees and returns the public key and the trustees.
+func testDKG(t *testing.T, params *KeyParameters, thresh, n int) (*ThresholdPublicKey, []*Trustee) {
+	dealings := make([]*Dealing, n)
+	shares := make([][]*big.Int, n) // shares[j][i] is dealt by i+1 to j+1
+	for j := range shares {
+		shares[j] = make([]*big.Int, n)
+	}
+	for i := 0; i < n; i++ {
+		d, s, err := params.Deal(i+1, thresh, n)
+		if err != nil {
+			t.Fatal("Deal() fails:", err)
+		}
+		dealings[i] = d
+		for j := range s {
+			shares[j][i] = s[j]
+		}
+	}
+	tpk, err := params.NewThresholdPublicKey(thresh, n, dealings)
+	if err != nil {
+		t.Fatal("NewThresholdPublicKey() fails:", err)
+	}
+	trustees := make([]*Trustee, n)
+	for j := range trustees {
+		if trustees[j], err = tpk.NewTrustee(j+1, shares[j]); err != nil {
+			t.Fatal("NewTrustee() fails:", err)
+		}
+	}
+	return tpk, trustees
+}
+
+// Test that any T trustees can decrypt.
+func TestThresholdDecrypt(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	tpk, trustees := testDKG(t, params, 3, 5)
+
+	M, _ := params.Encode([]byte("threshold"))
+	R, C := tpk.Encrypt(M)
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}} {
+		var shares []*DecryptionShare
+		for _, j := range subset {
+			share, err := trustees[j].PartialDecrypt([]*big.Int{R}, []*big.Int{C})
+			if err != nil {
+				t.Fatal("PartialDecrypt() fails:", err)
+			}
+			shares = append(shares, share)
+		}
+		got, err := tpk.Decrypt(R, C, shares)
+		if err != nil {
+			t.Fatalf("Decrypt() with trustees %v fails: %s", subset, err)
+		}
+		if got.Cmp(M) != 0 {
+			t.Errorf("Decrypt() with trustees %v: got %s, want %s", subset, got, M)
+		}
+	}
+}
+
+// Test that the shares reconstruct the joint secret key and match the
+// verification keys.
+func TestThresholdKeys(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	tpk, trustees := testDKG(t, params, 2, 3)
+
+	for j, tr := range trustees {
+		Y := new(big.Int).Exp(params.G, tr.X, params.P)
+		if Y.Cmp(tpk.VerificationKeys[j]) != 0 {
+			t.Errorf("trustee %d: share does not match verification key", j+1)
+		}
+	}
+	X := new(big.Int)
+	for _, j := range []int{1, 3} {
+		lambda, err := params.lagrange(j, []int{1, 3})
+		if err != nil {
+			t.Fatal("lagrange() fails:", err)
+		}
+		X.Add(X, lambda.Mul(lambda, trustees[j-1].X))
+	}
+	X.Mod(X, params.Q)
+	if new(big.Int).Exp(params.G, X, params.P).Cmp(tpk.Y) != 0 {
+		t.Error("shares do not interpolate to the joint secret key")
+	}
+}
+
+// Test that fewer than T shares, duplicate shares, and invalid shares do not
+// suffice to decrypt, and that invalid shares are skipped.
+func TestThresholdBadShares(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	tpk, trustees := testDKG(t, params, 2, 3)
+
+	M, _ := params.Encode([]byte("threshold"))
+	R, C := tpk.Encrypt(M)
+	share := make([]*DecryptionShare, 3)
+	for j := range share {
+		var err error
+		if share[j], err = trustees[j].PartialDecrypt([]*big.Int{R}, []*big.Int{C}); err != nil {
+			t.Fatal("PartialDecrypt() fails:", err)
+		}
+	}
+	bad := &DecryptionShare{Index: 2, Partial: []*big.Int{new(big.Int).Set(C)}, Proof: share[1].Proof}
+
+	if _, err := tpk.Decrypt(R, C, share[:1]); err == nil {
+		t.Error("Decrypt() succeeds with too few shares")
+	}
+	if _, err := tpk.Decrypt(R, C, []*DecryptionShare{share[0], share[0]}); err == nil {
+		t.Error("Decrypt() succeeds with duplicate shares")
+	}
+	if _, err := tpk.Decrypt(R, C, []*DecryptionShare{share[0], bad}); err == nil {
+		t.Error("Decrypt() succeeds with an invalid share")
+	}
+	got, err := tpk.Decrypt(R, C, []*DecryptionShare{bad, share[0], share[2]})
+	if err != nil {
+		t.Fatal("Decrypt() fails:", err)
+	}
+	if got.Cmp(M) != 0 {
+		t.Error("Decrypt() output is incorrect")
+	}
+}
+
+// Test that a trustee detects an invalid share and that an invalid dealing is
+// rejected.
+func TestDKGBadDealing(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	d, s, err := params.Deal(1, 2, 3)
+	if err != nil {
+		t.Fatal("Deal() fails:", err)
+	}
+	if !params.VerifyShare(2, s[1], d) {
+		t.Error("VerifyShare() rejects a valid share")
+	}
+	if params.VerifyShare(2, s[2], d) {
+		t.Error("VerifyShare() accepts a share for another trustee")
+	}
+	if !params.VerifyDealing(1, 2, d) {
+		t.Error("VerifyDealing() rejects a valid dealing")
+	}
+	if params.VerifyDealing(2, 2, d) {
+		t.Error("VerifyDealing() accepts a dealing for another trustee")
+	}
+	if params.VerifyDealing(1, 3, d) {
+		t.Error("VerifyDealing() accepts a dealing for another threshold")
+	}
+	if _, err := params.NewThresholdPublicKey(2, 3, []*Dealing{d, d, nil}); err == nil {
+		t.Error("NewThresholdPublicKey() accepts a replayed dealing")
+	}
+
+	// Trustee 2 is disqualified; trustee 3 receives a bad share from 1.
+	tpk, err := params.NewThresholdPublicKey(2, 3, []*Dealing{d, nil, nil})
+	if err != nil {
+		t.Fatal("NewThresholdPublicKey() fails:", err)
+	}
+	if _, err := tpk.NewTrustee(3, []*big.Int{s[1], nil, nil}); err == nil {
+		t.Error("NewTrustee() accepts an invalid share")
+	}
+	if _, err := tpk.NewTrustee(3, []*big.Int{s[2], nil, nil}); err != nil {
+		t.Error("NewTrustee() fails:", err)
+	}
+}
+
+// Test the threshold analogue of Mix.
+func TestThresholdMix(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	tpk, trustees := testDKG(t, params, 2, 3)
+	N := 5
+	R := make([]*big.Int, N)
+	C := make([]*big.Int, N)
+	M := make([]*big.Int, N)
+	for i := range R {
+		M[i], _ = params.Encode([]byte{byte('a' + i)})
+		R[i], C[i] = tpk.Encrypt(M[i])
+	}
+	var shares []*DecryptionShare
+	for _, tr := range trustees[1:] {
+		share, err := tr.PartialDecrypt(R, C)
+		if err != nil {
+			t.Fatal("PartialDecrypt() fails:", err)
+		}
+		shares = append(shares, share)
+	}
+	perm := testPerm(t, N)
+	out, err := tpk.Mix(R, C, perm, shares)
+	if err != nil {
+		t.Fatal("Mix() fails:", err)
+	}
+	for i := range M {
+		if out[perm[i]].Cmp(M[i]) != 0 {
+			t.Errorf("output %d is incorrect", perm[i])
+		}
+	}
+}
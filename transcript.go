@@ -0,0 +1,303 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Names of the protocols whose transcripts can be checked by CheckTranscript.
+const (
+	ProtocolILMP     = "ILMP"
+	ProtocolShuffle0 = "Shuffle0"
+)
+
+// Roles of the sender of a message.
+const (
+	FromProver   = "prover"
+	FromVerifier = "verifier"
+)
+
+// Message is a message sent by one party to the other during an interactive
+// proof. A nil Values indicates that the sender aborted.
+type Message struct {
+	From   string     `json:"from"`
+	Values []*big.Int `json:"values"`
+}
+
+// Transcript is a record of a run of one of the interactive proofs: the name
+// of the protocol, the public statement, and the messages exchanged by the
+// prover and verifier. It can be serialized with encoding/json and later
+// checked by CheckTranscript.
+//
+// The statement of ILMP consists of X and Y, and the statement of Shuffle0
+// consists of X, Y, C, and D.
+type Transcript struct {
+	Protocol string     `json:"protocol"`
+	X        []*big.Int `json:"x"`
+	Y        []*big.Int `json:"y"`
+	C        *big.Int   `json:"c,omitempty"`
+	D        *big.Int   `json:"d,omitempty"`
+	Messages []Message  `json:"messages"`
+}
+
+// NewILMPTranscript returns a transcript of ILMP for the public sequences X
+// and Y and the recorded messages.
+func NewILMPTranscript(X, Y []big.Int, msgs []Message) *Transcript {
+	return &Transcript{
+		Protocol: ProtocolILMP,
+		X:        copyInts(X),
+		Y:        copyInts(Y),
+		Messages: msgs,
+	}
+}
+
+// NewShuffle0Transcript returns a transcript of Shuffle0 for the public
+// sequences X and Y, the elements C and D, and the recorded messages.
+func NewShuffle0Transcript(X, Y []big.Int, C, D *big.Int, msgs []Message) *Transcript {
+	return &Transcript{
+		Protocol: ProtocolShuffle0,
+		X:        copyInts(X),
+		Y:        copyInts(Y),
+		C:        new(big.Int).Set(C),
+		D:        new(big.Int).Set(D),
+		Messages: msgs,
+	}
+}
+
+// copyInts returns a deep copy of a message.
+func copyInts(msg []big.Int) []*big.Int {
+	if msg == nil {
+		return nil
+	}
+	out := make([]*big.Int, len(msg))
+	for i := range msg {
+		out[i] = new(big.Int).Set(&msg[i])
+	}
+	return out
+}
+
+// fromInts converts a message from its serialized form. It returns an error if
+// any value is missing.
+func fromInts(vals []*big.Int) ([]big.Int, error) {
+	out := make([]big.Int, len(vals))
+	for i := range vals {
+		if vals[i] == nil {
+			return nil, errors.New(fmt.Sprintf("value %d is missing", i))
+		}
+		out[i].Set(vals[i])
+	}
+	return out, nil
+}
+
+// Recorder is a transport that relays messages between a prover and a
+// verifier and records each of them. The prover communicates over the Prover
+// channel and the verifier over the Verifier channel:
+//
+//	rec := NewRecorder()
+//	go params.ILMPProve(x, y, rec.Prover)
+//	ok, err := params.ILMPVerify(X, Y, rec.Verifier)
+//	tr := NewILMPTranscript(X, Y, rec.Close())
+//
+// Messages are copied as they are relayed, so the transcript is not affected
+// if either party reuses its buffers.
+//
+// After Close, the Recorder behaves like a peer that has aborted: it discards
+// the messages sent on either channel and answers each receive with nil, so
+// that a party that is still running returns rather than blocking forever.
+type Recorder struct {
+	Prover, Verifier chan []big.Int
+
+	msgs []Message
+	quit chan bool
+	done chan bool
+}
+
+// NewRecorder returns a Recorder and starts relaying messages.
+func NewRecorder() *Recorder {
+	rec := &Recorder{
+		Prover:   make(chan []big.Int),
+		Verifier: make(chan []big.Int),
+		quit:     make(chan bool),
+		done:     make(chan bool),
+	}
+	go rec.relay()
+	return rec
+}
+
+func (rec *Recorder) relay() {
+	rec.record()
+	close(rec.done)
+	for {
+		select {
+		case <-rec.Prover:
+		case <-rec.Verifier:
+		case rec.Prover <- nil:
+		case rec.Verifier <- nil:
+		}
+	}
+}
+
+// record relays and records messages until the Recorder is closed.
+func (rec *Recorder) record() {
+	for {
+		var msg []big.Int
+		var to chan []big.Int
+		var from string
+		select {
+		case msg = <-rec.Prover:
+			from, to = FromProver, rec.Verifier
+		case msg = <-rec.Verifier:
+			from, to = FromVerifier, rec.Prover
+		case <-rec.quit:
+			return
+		}
+		rec.msgs = append(rec.msgs, Message{From: from, Values: copyInts(msg)})
+		select {
+		case to <- msg:
+		case <-rec.quit:
+			return
+		}
+	}
+}
+
+// Close stops relaying and returns the messages recorded so far. It should be
+// called once both parties are finished.
+func (rec *Recorder) Close() []Message {
+	close(rec.quit)
+	<-rec.done
+	return rec.msgs
+}
+
+// expectMessages checks that the messages of a transcript were sent by the
+// given parties in order and have the given lengths. It returns the messages.
+func expectMessages(msgs []Message, from []string, lens []int) ([][]big.Int, error) {
+	if len(msgs) != len(from) {
+		return nil, errors.New(fmt.Sprintf("got %d messages, expected %d", len(msgs), len(from)))
+	}
+	out := make([][]big.Int, len(msgs))
+	for i := range msgs {
+		if msgs[i].From != from[i] {
+			return nil, errors.New(fmt.Sprintf("message %d is from %s, expected %s", i, msgs[i].From, from[i]))
+		}
+		if msgs[i].Values == nil {
+			return nil, errors.New(fmt.Sprintf("message %d: %s aborted", i, from[i]))
+		}
+		if len(msgs[i].Values) != lens[i] {
+			return nil, errors.New(fmt.Sprintf("message %d has length %d, expected %d", i, len(msgs[i].Values), lens[i]))
+		}
+		var err error
+		if out[i], err = fromInts(msgs[i].Values); err != nil {
+			return nil, errors.New(fmt.Sprintf("message %d: %v", i, err))
+		}
+	}
+	return out, nil
+}
+
+// CheckTranscript re-runs the verifier's checks on a stored transcript. It
+// returns an error if the transcript is malformed, e.g., if it is for an
+// unknown protocol or a message is missing, and false if the transcript is
+// well-formed but the verification equations do not hold.
+//
+// A valid transcript convinces its reader only if the reader trusts that the
+// verifier's challenges were chosen at random after the preceding prover
+// message; the simulators show that anyone can produce valid transcripts for
+// challenges they pick themselves.
+func (params *KeyParameters) CheckTranscript(tr *Transcript) (bool, error) {
+	if tr == nil {
+		return false, errors.New("transcript is missing")
+	}
+	X, err := fromInts(tr.X)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("X: %v", err))
+	}
+	Y, err := fromInts(tr.Y)
+	if err != nil {
+		return false, errors.New(fmt.Sprintf("Y: %v", err))
+	}
+	if len(X) != len(Y) {
+		return false, errors.New("input lengths do not match")
+	}
+	N := len(X)
+	s := NewScratch()
+
+	switch tr.Protocol {
+	case ProtocolILMP:
+		if N < 2 {
+			return false, errors.New("input length must be at least 2")
+		}
+		msgs, err := expectMessages(tr.Messages,
+			[]string{FromProver, FromVerifier, FromProver},
+			[]int{N, 1, N - 1})
+		if err != nil {
+			return false, err
+		}
+		A, gamma, r := msgs[0], &msgs[1][0], msgs[2]
+		if err := params.checkChallenge(gamma); err != nil {
+			return false, errors.New(fmt.Sprintf("gamma: %v", err))
+		}
+		return params.ilmpCheck(X, Y, A, gamma, r, s), nil
+
+	case ProtocolShuffle0:
+		if tr.C == nil || tr.D == nil {
+			return false, errors.New("C or D is missing")
+		}
+		if N < 1 {
+			return false, errors.New("input length must be at least 1")
+		}
+		msgs, err := expectMessages(tr.Messages,
+			[]string{FromVerifier, FromProver, FromVerifier, FromProver},
+			[]int{1, 2 * N, 1, 2*N - 1})
+		if err != nil {
+			return false, err
+		}
+		t, A, gamma, r := &msgs[0][0], msgs[1], &msgs[2][0], msgs[3]
+		if err := params.checkChallenge(t); err != nil {
+			return false, errors.New(fmt.Sprintf("t: %v", err))
+		}
+		if err := params.checkChallenge(gamma); err != nil {
+			return false, errors.New(fmt.Sprintf("gamma: %v", err))
+		}
+		return params.shuffle0Check(X, Y, tr.C, tr.D, t, A, gamma, r, s), nil
+	}
+
+	return false, errors.New(fmt.Sprintf("unknown protocol %q", tr.Protocol))
+}
+
+// checkChallenge returns an error unless c is in [1, Q-1], the range from
+// which the verifier samples its challenges. For a challenge of 0, the
+// verification equations can be satisfied without a witness.
+func (params *KeyParameters) checkChallenge(c *big.Int) error {
+	if c.Sign() <= 0 || c.Cmp(params.Q) >= 0 {
+		return errors.New("challenge is not in [1, Q-1]")
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+// testRecordShuffle0 records an honest run of Shuffle0 of length N.
+func testRecordShuffle0(t *testing.T, params *KeyParameters, N int) *Transcript {
+	x, y, c, d, X, Y, C, D := testShuffle0Instance(t, params, N)
+	rec := NewRecorder()
+	go func() {
+		if err := params.Shuffle0Prove(x, y, c, d, rec.Prover); err != nil {
+			t.Errorf("prover: %s", err)
+		}
+	}()
+	if ok, err := params.Shuffle0Verify(X, Y, C, D, rec.Verifier); err != nil {
+		t.Fatalf("verifier: %s", err)
+	} else if !ok {
+		t.Fatal("failed to verify")
+	}
+	return NewShuffle0Transcript(X, Y, C, D, rec.Close())
+}
+
+// Test recording a run of ILMP and checking the transcript after it has been
+// serialized.
+func TestRecordILMP(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	x, y, X, Y := benchILMPInstance(t, params, 10)
+
+	// Reuse the scratch space until the buffers of the first run are
+	// overwritten, to make sure the recorder copies the messages.
+	ps, vs := NewScratch(), NewScratch()
+	var tr *Transcript
+	for i := 0; i < 3; i++ {
+		rec := NewRecorder()
+		go func() {
+			if err := params.ILMPProveScratch(x, y, rec.Prover, ps); err != nil {
+				t.Errorf("prover: %s", err)
+			}
+		}()
+		if ok, err := params.ILMPVerifyScratch(X, Y, rec.Verifier, vs); err != nil {
+			t.Fatalf("verifier: %s", err)
+		} else if !ok {
+			t.Fatal("failed to verify")
+		}
+		if tr == nil {
+			tr = NewILMPTranscript(X, Y, rec.Close())
+		} else {
+			rec.Close()
+		}
+	}
+
+	if len(tr.Messages) != 3 {
+		t.Fatalf("recorded %d messages, expected 3", len(tr.Messages))
+	}
+
+	data, err := json.Marshal(tr)
+	if err != nil {
+		t.Fatal("json.Marshal() fails:", err)
+	}
+	var tr1 Transcript
+	if err := json.Unmarshal(data, &tr1); err != nil {
+		t.Fatal("json.Unmarshal() fails:", err)
+	}
+	if ok, err := params.CheckTranscript(&tr1); err != nil {
+		t.Fatal("CheckTranscript() fails:", err)
+	} else if !ok {
+		t.Error("transcript is rejected")
+	}
+}
+
+// Test recording a run of Shuffle0 and checking the transcript.
+func TestRecordShuffle0(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	tr := testRecordShuffle0(t, params, 5)
+	if len(tr.Messages) != 4 {
+		t.Fatalf("recorded %d messages, expected 4", len(tr.Messages))
+	}
+	if ok, err := params.CheckTranscript(tr); err != nil {
+		t.Fatal("CheckTranscript() fails:", err)
+	} else if !ok {
+		t.Error("transcript is rejected")
+	}
+}
+
+// Test that tampered transcripts are rejected.
+func TestCheckTranscriptTampered(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	tr := testRecordShuffle0(t, params, 5)
+
+	// Wrong response.
+	r := tr.Messages[3].Values
+	r[0].Add(r[0], params.one)
+	if ok, err := params.CheckTranscript(tr); err != nil {
+		t.Error("CheckTranscript() fails:", err)
+	} else if ok {
+		t.Error("transcript with wrong response is accepted")
+	}
+	r[0].Sub(r[0], params.one)
+
+	// Wrong statement.
+	tr.Y[0] = new(big.Int).Mul(tr.Y[0], params.G)
+	if ok, _ := params.CheckTranscript(tr); ok {
+		t.Error("transcript with wrong statement is accepted")
+	}
+
+	malformed := []func(tr *Transcript){
+		func(tr *Transcript) { tr.Protocol = "Shuffle1" },
+		func(tr *Transcript) { tr.Messages = tr.Messages[:3] },
+		func(tr *Transcript) { tr.Messages[0].From = FromProver },
+		func(tr *Transcript) { tr.Messages[1].Values = tr.Messages[1].Values[1:] },
+		func(tr *Transcript) { tr.Messages[2].Values = nil },
+		func(tr *Transcript) { tr.Messages[2].Values[0] = nil },
+		func(tr *Transcript) { tr.X = tr.X[1:] },
+		func(tr *Transcript) { tr.D = nil },
+		func(tr *Transcript) { tr.Messages[0].Values[0].SetInt64(0) },
+		func(tr *Transcript) { tr.Messages[2].Values[0].Set(params.Q) },
+	}
+	for i, tamper := range malformed {
+		tr := testRecordShuffle0(t, params, 3)
+		tamper(tr)
+		if _, err := params.CheckTranscript(tr); err == nil {
+			t.Errorf("%d: CheckTranscript() succeeds on malformed transcript: expected error", i)
+		}
+	}
+}
+
+// Test that a transcript of ILMP with the challenge 0, which anyone can
+// produce, is rejected.
+func TestCheckTranscriptZeroChallenge(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 4
+	X := testRandomElements(params, N)
+	Y := testRandomElements(params, N)
+
+	// For gamma = 0, the verification equations are X[i]^r[i-1] Y[i]^r[i] =
+	// A[i], where r[-1] = r[N-1] = 0.
+	r := make([]big.Int, N-1)
+	for i := range r {
+		r[i].Set(testSample(t, params))
+	}
+	A := make([]big.Int, N)
+	var L, R big.Int
+	for i := 0; i < N; i++ {
+		A[i].SetInt64(1)
+		if i > 0 {
+			L.Exp(&X[i], &r[i-1], params.P)
+			A[i].Mul(&A[i], &L).Mod(&A[i], params.P)
+		}
+		if i < N-1 {
+			R.Exp(&Y[i], &r[i], params.P)
+			A[i].Mul(&A[i], &R).Mod(&A[i], params.P)
+		}
+	}
+	if !params.ilmpCheck(X, Y, A, new(big.Int), r, NewScratch()) {
+		t.Fatal("forged transcript does not satisfy the verification equations")
+	}
+
+	tr := NewILMPTranscript(X, Y, []Message{
+		{FromProver, copyInts(A)},
+		{FromVerifier, []*big.Int{new(big.Int)}},
+		{FromProver, copyInts(r)},
+	})
+	if _, err := params.CheckTranscript(tr); err == nil {
+		t.Error("CheckTranscript() succeeds on a challenge of 0: expected error")
+	}
+	if _, err := params.CheckTranscript(nil); err == nil {
+		t.Error("CheckTranscript(nil) succeeds: expected error")
+	}
+}
+
+// Test that a party that is still running when the Recorder is closed
+// returns.
+func TestRecordClose(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	x, y, _, _ := benchILMPInstance(t, params, 4)
+
+	// The verifier gives up after the first message.
+	rec := NewRecorder()
+	done := make(chan error)
+	go func() {
+		done <- params.ILMPProve(x, y, rec.Prover)
+	}()
+	<-rec.Verifier
+	rec.Close()
+	if err := <-done; err == nil {
+		t.Error("prover succeeds: expected error")
+	}
+
+	// The prover starts after the Recorder is closed.
+	go func() {
+		done <- params.ILMPProve(x, y, rec.Prover)
+	}()
+	if err := <-done; err == nil {
+		t.Error("prover succeeds: expected error")
+	}
+}
+
+// Test that an aborted run is recorded.
+func TestRecordAbort(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	x, y, X, Y := benchILMPInstance(t, params, 4)
+	x[2].SetInt64(0) // Bad!!
+
+	rec := NewRecorder()
+	go params.ILMPProve(x, y, rec.Prover)
+	if _, err := params.ILMPVerify(X, Y, rec.Verifier); err == nil {
+		t.Error("verifier succeeds: expected error")
+	}
+	tr := NewILMPTranscript(X, Y, rec.Close())
+	if len(tr.Messages) != 1 || tr.Messages[0].Values != nil {
+		t.Fatalf("recorded %v, expected a single abort", tr.Messages)
+	}
+	if _, err := params.CheckTranscript(tr); err == nil {
+		t.Error("CheckTranscript() succeeds: expected error")
+	}
+}
+
+// Test that simulated transcripts pass the offline checker.
+func TestCheckSimulatedTranscript(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	X := testRandomElements(params, 4)
+	Y := testRandomElements(params, 4)
+	C := testRandomElements(params, 1)
+	D := testRandomElements(params, 1)
+	tt, _ := params.Sample()
+	gamma, _ := params.Sample()
+
+	A, r, err := params.Shuffle0Simulate(X, Y, &C[0], &D[0], tt, gamma)
+	if err != nil {
+		t.Fatal("Shuffle0Simulate() fails:", err)
+	}
+	tr := NewShuffle0Transcript(X, Y, &C[0], &D[0], []Message{
+		{FromVerifier, []*big.Int{tt}},
+		{FromProver, copyInts(A)},
+		{FromVerifier, []*big.Int{gamma}},
+		{FromProver, copyInts(r)},
+	})
+	if ok, err := params.CheckTranscript(tr); err != nil {
+		t.Fatal("CheckTranscript() fails:", err)
+	} else if !ok {
+		t.Error("simulated transcript is rejected")
+	}
+}
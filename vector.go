@@ -0,0 +1,327 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// VectorCiphertext is an encryption of a message that is too long for a
+// single group element. The message is split into chunks, and (R[l], C[l]) is
+// the ElGamal encryption of the l-th chunk. The number of chunks is the width
+// of the ciphertext. Vector ciphertexts are mixed as a unit, so every chunk of
+// a message ends up in the same position.
+//
+// Vector ciphertexts are verifiable only if every chunk is an element of <G>.
+// ReEncryptionMixVector and the vector shuffle proof reject any other chunk,
+// since re-encrypting it would link the output to the input (see ReEncrypt).
+// EncryptVector encodes the chunks with Encode, whose output is in general not
+// in <G>, so its ciphertexts can only be decrypted with MixVector, which proves
+// nothing. A vector that is to be mixed verifiably must be encoded with
+// GroupEncoder.EncodeVector and encrypted with EncryptVectorElements, which
+// limits each chunk to 4 bytes. Longer messages are better mixed verifiably as
+// hybrid ciphertexts (see ReEncryptionMixHybrid).
+//
+// The vector shuffle proof is the cut-and-choose proof of
+// ReEncryptionShuffleProve, run over whole vectors. It is not the general
+// k-shuffle, which is not implemented.
+type VectorCiphertext struct {
+	R, C []*big.Int
+}
+
+// splitVector splits msg into k chunks of at most max bytes. Unused chunks
+// are empty, so that every message splits into the same width.
+func splitVector(msg []byte, k, max int) ([][]byte, error) {
+	if k < 1 {
+		return nil, errors.New("width must be positive")
+	}
+	if len(msg) > k*max {
+		return nil, errors.New("message too big")
+	}
+	chunks := make([][]byte, k)
+	for l := range chunks {
+		lo, hi := l*max, (l+1)*max
+		if lo > len(msg) {
+			lo = len(msg)
+		}
+		if hi > len(msg) {
+			hi = len(msg)
+		}
+		chunks[l] = msg[lo:hi]
+	}
+	return chunks, nil
+}
+
+// joinVector decodes each of the chunks M with decode and concatenates them.
+func joinVector(M []*big.Int, decode func(*big.Int) ([]byte, error)) ([]byte, error) {
+	var msg []byte
+	for l := range M {
+		chunk, err := decode(M[l])
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("chunk %d: %v", l, err))
+		}
+		msg = append(msg, chunk...)
+	}
+	return msg, nil
+}
+
+// EncodeVector splits msg into k chunks of at most MaxMsgBytes and encodes
+// each as in Encode. Unused chunks encode the empty string, so that every
+// message encodes to the same width.
+func (params *KeyParameters) EncodeVector(msg []byte, k int) ([]*big.Int, error) {
+	chunks, err := splitVector(msg, k, params.MaxMsgBytes())
+	if err != nil {
+		return nil, err
+	}
+	M := make([]*big.Int, k)
+	for l := range M {
+		if M[l], err = params.Encode(chunks[l]); err != nil {
+			return nil, err
+		}
+	}
+	return M, nil
+}
+
+// DecodeVector outputs the message encoded by EncodeVector.
+func (params *KeyParameters) DecodeVector(M []*big.Int) ([]byte, error) {
+	return joinVector(M, params.Decode)
+}
+
+// EncodeVector splits msg into k chunks of at most e.MaxBytes and encodes
+// each as an element of <G>. Unused chunks encode the empty string, so that
+// every message encodes to the same width.
+func (e *GroupEncoder) EncodeVector(msg []byte, k int) ([]*big.Int, error) {
+	chunks, err := splitVector(msg, k, e.MaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	M := make([]*big.Int, k)
+	for l := range M {
+		if M[l], err = e.Encode(chunks[l]); err != nil {
+			return nil, err
+		}
+	}
+	return M, nil
+}
+
+// DecodeVector outputs the message encoded by EncodeVector.
+func (e *GroupEncoder) DecodeVector(M []*big.Int) ([]byte, error) {
+	return joinVector(M, e.Decode)
+}
+
+// EncryptVector encrypts msg as a vector ciphertext of width k, encoding its
+// chunks with EncodeVector. The output can be mixed with MixVector, but not
+// re-encrypted or proven (see VectorCiphertext).
+func (pk *PublicKey) EncryptVector(msg []byte, k int) (*VectorCiphertext, error) {
+	M, err := pk.EncodeVector(msg, k)
+	if err != nil {
+		return nil, err
+	}
+	return pk.EncryptVectorElements(M)
+}
+
+// EncryptVectorElements encrypts the encoded chunks M, such as the output of
+// GroupEncoder.EncodeVector, as a vector ciphertext.
+func (pk *PublicKey) EncryptVectorElements(M []*big.Int) (*VectorCiphertext, error) {
+	if len(M) == 0 {
+		return nil, errors.New("width must be positive")
+	}
+	ct := &VectorCiphertext{R: make([]*big.Int, len(M)), C: make([]*big.Int, len(M))}
+	for l := range M {
+		if ct.R[l], ct.C[l] = pk.Encrypt(M[l]); ct.R[l] == nil {
+			return nil, errors.New("failed to sample randomness")
+		}
+	}
+	return ct, nil
+}
+
+// DecryptVector decrypts a vector ciphertext output by EncryptVector.
+func (sk *SecretKey) DecryptVector(ct *VectorCiphertext) ([]byte, error) {
+	M, err := sk.DecryptVectorElements(ct)
+	if err != nil {
+		return nil, err
+	}
+	return sk.DecodeVector(M)
+}
+
+// DecryptVectorElements decrypts each chunk of a vector ciphertext.
+func (sk *SecretKey) DecryptVectorElements(ct *VectorCiphertext) ([]*big.Int, error) {
+	if ct == nil || len(ct.R) != len(ct.C) {
+		return nil, errors.New("malformed ciphertext")
+	}
+	M := make([]*big.Int, len(ct.R))
+	for l := range M {
+		M[l] = sk.Decrypt(ct.R[l], ct.C[l])
+	}
+	return M, nil
+}
+
+// flattenVectors concatenates the components of a sequence of vector
+// ciphertexts, all of which must have the same width, and outputs the width.
+func flattenVectors(cts []*VectorCiphertext) (R, C []*big.Int, k int, err error) {
+	if len(cts) == 0 {
+		return nil, nil, 0, errors.New("no ciphertexts")
+	}
+	for i, ct := range cts {
+		if ct == nil || len(ct.R) != len(ct.C) || len(ct.R) == 0 {
+			return nil, nil, 0, errors.New(fmt.Sprintf("ciphertext %d is malformed", i))
+		}
+		if i == 0 {
+			k = len(ct.R)
+		} else if len(ct.R) != k {
+			return nil, nil, 0, errors.New(fmt.Sprintf(
+				"width mismatch: ciphertext %d has width %d, expected %d", i, len(ct.R), k))
+		}
+		R = append(R, ct.R...)
+		C = append(C, ct.C...)
+	}
+	return R, C, k, nil
+}
+
+// MixVector decrypts the sequence of vector ciphertexts, applies the specified
+// permutation, and outputs the resulting sequence of messages. It is the
+// vector analogue of Mix and, like Mix, is not verifiable.
+func (sk *SecretKey) MixVector(cts []*VectorCiphertext, perm Permutation) ([][]byte, error) {
+	if _, _, _, err := flattenVectors(cts); err != nil {
+		return nil, err
+	}
+	if err := perm.Validate(len(cts)); err != nil {
+		return nil, err
+	}
+	msgs := make([][]byte, len(cts))
+	for i, ct := range cts {
+		msg, err := sk.DecryptVector(ct)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("ciphertext %d: %v", i, err))
+		}
+		msgs[i] = msg
+	}
+	return Permute(perm, msgs), nil
+}
+
+// ReEncryptionMixVector re-encrypts every chunk of the sequence of vector
+// ciphertexts and applies the specified permutation to the vectors, so that
+// the re-encryption of the i-th input is the perm[i]-th output. It also
+// outputs the randomness used for each chunk, which the mix server needs in
+// order to prove the shuffle with ReEncryptionShuffleProveVector.
+//
+// It returns a *CiphertextError if a component of a chunk is not an element of
+// <G> (see VectorCiphertext).
+func (pk *PublicKey) ReEncryptionMixVector(cts []*VectorCiphertext, perm Permutation) (out []*VectorCiphertext, rands [][]*big.Int, err error) {
+	if _, _, _, err = flattenVectors(cts); err != nil {
+		return nil, nil, err
+	}
+	if err := perm.Validate(len(cts)); err != nil {
+		return nil, nil, err
+	}
+	for i, ct := range cts {
+		for l := range ct.R {
+			if err := pk.checkGroupCiphertext(ct.R[l], ct.C[l]); err != nil {
+				return nil, nil, &CiphertextError{i, errors.New(fmt.Sprintf("chunk %d: %v", l, err))}
+			}
+		}
+	}
+	out = make([]*VectorCiphertext, len(cts))
+	rands = make([][]*big.Int, len(cts))
+	for i, ct := range cts {
+		v := &VectorCiphertext{R: make([]*big.Int, len(ct.R)), C: make([]*big.Int, len(ct.R))}
+		rands[i] = make([]*big.Int, len(ct.R))
+		for l := range ct.R {
+			if rands[i][l], err = pk.Sample(); err != nil {
+				return nil, nil, err
+			}
+			v.R[l], v.C[l] = pk.reEncrypt(ct.R[l], ct.C[l], rands[i][l])
+		}
+		out[perm[i]] = v
+	}
+	return out, rands, nil
+}
+
+// ReEncryptionShuffleProveVector implements the prover role in an interactive
+// proof that out is a re-encryption shuffle of the vector ciphertexts in, with
+// every chunk of a vector moved to the same position. It is the protocol of
+// ReEncryptionShuffleProve, in which each round shuffles whole vectors. The
+// inputs perm and rands are the prover's witness as output by
+// ReEncryptionMixVector. Every chunk of in and out must be in <G>.
+func (pk *PublicKey) ReEncryptionShuffleProveVector(in, out []*VectorCiphertext, perm Permutation, rands [][]*big.Int, rounds int, msg chan []big.Int) error {
+	R, C, k, err := flattenVectors(in)
+	if err != nil {
+		msg <- nil
+		return err
+	}
+	R2, C2, k2, err := flattenVectors(out)
+	if err != nil {
+		msg <- nil
+		return err
+	}
+	if k2 != k || len(rands) != len(in) {
+		msg <- nil
+		return errors.New("input lengths do not match")
+	}
+	var flat []*big.Int
+	for i := range rands {
+		if len(rands[i]) != k {
+			msg <- nil
+			return errors.New("input lengths do not match")
+		}
+		flat = append(flat, rands[i]...)
+	}
+	if err := pk.checkShuffleElements(R, C, R2, C2); err != nil {
+		msg <- nil
+		return err
+	}
+	return pk.reEncryptionShuffleProve(R, C, R2, C2, k, perm, flat, rounds, msg)
+}
+
+// ReEncryptionShuffleVerifyVector implements the verifier role in the
+// interactive proof that out is a re-encryption shuffle of the vector
+// ciphertexts in.
+func (pk *PublicKey) ReEncryptionShuffleVerifyVector(in, out []*VectorCiphertext, rounds int, msg chan []big.Int) (bool, error) {
+	R, C, k, err := flattenVectors(in)
+	if err != nil {
+		msg <- nil
+		return false, err
+	}
+	R2, C2, k2, err := flattenVectors(out)
+	if err != nil {
+		msg <- nil
+		return false, err
+	}
+	if k2 != k {
+		msg <- nil
+		return false, errors.New("width mismatch")
+	}
+	if err := pk.checkShuffleElements(R, C, R2, C2); err != nil {
+		msg <- nil
+		return false, err
+	}
+	return pk.reEncryptionShuffleVerify(R, C, R2, C2, k, rounds, msg)
+}
@@ -0,0 +1,261 @@
+// Copyright (c) 2016, Christopher Patton. All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice,
+// this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice,
+// this list of conditions and the following disclaimer in the documentation
+// and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors
+// may be used to endorse or promote products derived from this software without
+// specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS"
+// AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE
+// IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE
+// ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE
+// LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR
+// CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF
+// SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS
+// INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN
+// CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE)
+// ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE
+// POSSIBILITY OF SUCH DAMAGE.
+
+package shuffle
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+)
+
+// testVectorCiphertexts returns a key pair and vector encryptions of width k
+// of N messages of different lengths.
+func testVectorCiphertexts(t *testing.T, params *KeyParameters, N, k int) (pk *PublicKey, sk *SecretKey, msgs [][]byte, cts []*VectorCiphertext) {
+	pk, sk = params.GenerateKeys()
+	msgs = make([][]byte, N)
+	cts = make([]*VectorCiphertext, N)
+	for i := range msgs {
+		msgs[i] = bytes.Repeat([]byte{byte('a' + i)}, (k*params.MaxMsgBytes()*(i+1))/N)
+		var err error
+		if cts[i], err = pk.EncryptVector(msgs[i], k); err != nil {
+			t.Fatal("EncryptVector() fails:", err)
+		}
+	}
+	return
+}
+
+// testGroupVectorCiphertexts returns a key pair, the encoder, and vector
+// encryptions in <G> of width k of N messages of different lengths.
+func testGroupVectorCiphertexts(t *testing.T, params *KeyParameters, N, k int) (pk *PublicKey, sk *SecretKey, enc *GroupEncoder, msgs [][]byte, cts []*VectorCiphertext) {
+	pk, sk = params.GenerateKeys()
+	enc = testGroupEncoder(t, params)
+	msgs = make([][]byte, N)
+	cts = make([]*VectorCiphertext, N)
+	for i := range msgs {
+		msgs[i] = bytes.Repeat([]byte{byte('a' + i)}, (k*enc.MaxBytes*(i+1))/N)
+		M, err := enc.EncodeVector(msgs[i], k)
+		if err != nil {
+			t.Fatal("EncodeVector() fails:", err)
+		}
+		if cts[i], err = pk.EncryptVectorElements(M); err != nil {
+			t.Fatal("EncryptVectorElements() fails:", err)
+		}
+	}
+	return
+}
+
+// Test that messages of every length up to the capacity round-trip.
+func TestEncodeVector(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	max := params.MaxMsgBytes()
+	k := 3
+	for _, n := range []int{0, 1, max - 1, max, max + 1, 2 * max, k * max} {
+		msg := bytes.Repeat([]byte{0xab}, n)
+		M, err := params.EncodeVector(msg, k)
+		if err != nil {
+			t.Fatalf("EncodeVector() fails for %d bytes: %s", n, err)
+		}
+		if len(M) != k {
+			t.Fatalf("EncodeVector() output width %d, want %d", len(M), k)
+		}
+		got, err := params.DecodeVector(M)
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Errorf("DecodeVector() fails for %d bytes: %v", n, err)
+		}
+	}
+	if _, err := params.EncodeVector(make([]byte, k*max+1), k); err == nil {
+		t.Error("EncodeVector() accepts a message that is too long")
+	}
+	if _, err := params.EncodeVector(nil, 0); err == nil {
+		t.Error("EncodeVector() accepts width 0")
+	}
+}
+
+// Test that messages round-trip through the vector encoding in <G>.
+func TestGroupEncoderVector(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	enc := testGroupEncoder(t, params)
+	k := 3
+	for _, n := range []int{0, 1, enc.MaxBytes, enc.MaxBytes + 1, k * enc.MaxBytes} {
+		msg := bytes.Repeat([]byte{0xab}, n)
+		M, err := enc.EncodeVector(msg, k)
+		if err != nil {
+			t.Fatalf("EncodeVector() fails for %d bytes: %s", n, err)
+		}
+		for l := range M {
+			if !params.IsElement(M[l]) {
+				t.Fatalf("chunk %d is not an element of <G>", l)
+			}
+		}
+		got, err := enc.DecodeVector(M)
+		if err != nil || !bytes.Equal(got, msg) {
+			t.Errorf("DecodeVector() fails for %d bytes: %v", n, err)
+		}
+	}
+	if _, err := enc.EncodeVector(make([]byte, k*enc.MaxBytes+1), k); err == nil {
+		t.Error("EncodeVector() accepts a message that is too long")
+	}
+}
+
+// Test that MixVector outputs the permuted messages.
+func TestMixVector(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 4
+	_, sk, msgs, cts := testVectorCiphertexts(t, params, N, 3)
+
+	perm := testPerm(t, N)
+	out, err := sk.MixVector(cts, perm)
+	if err != nil {
+		t.Fatal("MixVector() fails:", err)
+	}
+	for i := range msgs {
+		if !bytes.Equal(out[perm[i]], msgs[i]) {
+			t.Errorf("output %d is incorrect", perm[i])
+		}
+	}
+}
+
+// Test the proof of a re-encryption shuffle of vector ciphertexts.
+func TestReEncryptionShuffleVector(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 4
+	pk, sk, enc, msgs, cts := testGroupVectorCiphertexts(t, params, N, 3)
+
+	perm := testPerm(t, N)
+	out, rands, err := pk.ReEncryptionMixVector(cts, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMixVector() fails:", err)
+	}
+	for i := range msgs {
+		M, err := sk.DecryptVectorElements(out[perm[i]])
+		if err != nil {
+			t.Fatal("DecryptVectorElements() fails:", err)
+		}
+		if got, err := enc.DecodeVector(M); err != nil || !bytes.Equal(got, msgs[i]) {
+			t.Errorf("output %d is incorrect", perm[i])
+		}
+	}
+
+	msg := make(chan []big.Int)
+	go pk.ReEncryptionShuffleProveVector(cts, out, perm, rands, testShuffleRounds, msg)
+	if ok, err := pk.ReEncryptionShuffleVerifyVector(cts, out, testShuffleRounds, msg); !ok || err != nil {
+		t.Error("ReEncryptionShuffleVerifyVector() fails:", err)
+	}
+}
+
+// Test that a shuffle that moves the chunks of a vector to different
+// positions is rejected, even though each chunk is a correct re-encryption.
+func TestReEncryptionShuffleVectorSplit(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 3
+	pk, _, _, _, cts := testGroupVectorCiphertexts(t, params, N, 2)
+
+	perm := []int{1, 2, 0}
+	out, rands, err := pk.ReEncryptionMixVector(cts, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMixVector() fails:", err)
+	}
+	// Swap the second chunks of two outputs.
+	out[0].R[1], out[1].R[1] = out[1].R[1], out[0].R[1]
+	out[0].C[1], out[1].C[1] = out[1].C[1], out[0].C[1]
+
+	msg := make(chan []big.Int)
+	go pk.ReEncryptionShuffleProveVector(cts, out, perm, rands, testShuffleRounds, msg)
+	if ok, _ := pk.ReEncryptionShuffleVerifyVector(cts, out, testShuffleRounds, msg); ok {
+		t.Error("ReEncryptionShuffleVerifyVector() accepts a split vector")
+	}
+
+	// The same ciphertexts do form a shuffle when flattened.
+	R, C, _, _ := flattenVectors(cts)
+	R2, C2, _, _ := flattenVectors(out)
+	flatPerm := []int{2, 1, 4, 5, 0, 3}
+	if !pk.isReEncryptionShuffle(R, C, R2, C2, 1, flatPerm, flatRands(rands)) {
+		t.Error("flattened ciphertexts are not a shuffle")
+	}
+}
+
+// flatRands concatenates the randomness of each vector.
+func flatRands(rands [][]*big.Int) []*big.Int {
+	var out []*big.Int
+	for i := range rands {
+		out = append(out, rands[i]...)
+	}
+	return out
+}
+
+// Test that vectors of different widths are rejected.
+func TestVectorWidthMismatch(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	pk, sk := params.GenerateKeys()
+	a, _ := pk.EncryptVector([]byte("a"), 1)
+	b, _ := pk.EncryptVector([]byte("b"), 2)
+	if _, _, _, err := flattenVectors([]*VectorCiphertext{a, b}); err == nil {
+		t.Error("flattenVectors() accepts a width mismatch")
+	}
+	if _, err := sk.MixVector([]*VectorCiphertext{a, b}, []int{1, 0}); err == nil {
+		t.Error("MixVector() accepts a width mismatch")
+	}
+}
+
+// Test that the re-encryption mix and shuffle proof of vector ciphertexts
+// reject chunks outside of <G>, such as the output of EncryptVector.
+func TestReEncryptionVectorOutsideGroup(t *testing.T) {
+	params := NewKeyParametersFromStrings(testP, testG, testQ)
+	N := 3
+	pk, _, _, _, cts := testGroupVectorCiphertexts(t, params, N, 2)
+	perm := testPerm(t, N)
+	out, rands, err := pk.ReEncryptionMixVector(cts, perm)
+	if err != nil {
+		t.Fatal("ReEncryptionMixVector() fails:", err)
+	}
+
+	bad, err := pk.EncryptVector([]byte("1"), 2)
+	if err != nil {
+		t.Fatal("EncryptVector() fails:", err)
+	}
+	if params.IsElement(bad.C[0]) {
+		t.Skip("Encode() output is in <G>")
+	}
+	in := append([]*VectorCiphertext{}, cts...)
+	in[2] = bad
+	_, _, err = pk.ReEncryptionMixVector(in, perm)
+	if e, ok := err.(*CiphertextError); !ok || e.Index != 2 {
+		t.Errorf("ReEncryptionMixVector() = %v, want a *CiphertextError for index 2", err)
+	}
+
+	msg := make(chan []big.Int)
+	go func() { <-msg }()
+	if err := pk.ReEncryptionShuffleProveVector(in, out, perm, rands, testShuffleRounds, msg); err == nil {
+		t.Error("prover succeeds: expected error")
+	}
+	go func() { <-msg }()
+	if ok, err := pk.ReEncryptionShuffleVerifyVector(in, out, testShuffleRounds, msg); ok || err == nil {
+		t.Errorf("verifier = %v, %v: expected error", ok, err)
+	}
+}